@@ -3,47 +3,149 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"log/slog"
 	"os"
 
+	"github.com/inecas/obs-mcp/pkg/auth"
+	"github.com/inecas/obs-mcp/pkg/config"
 	"github.com/inecas/obs-mcp/pkg/http"
+	"github.com/inecas/obs-mcp/pkg/logging"
 	"github.com/inecas/obs-mcp/pkg/mcp"
 	"github.com/inecas/obs-mcp/pkg/prometheus"
+	"github.com/inecas/obs-mcp/pkg/templates"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
 )
 
 func main() {
 	// Parse command line flags
-	var listen = flag.String("listen", "", "Listen address for HTTP mode (e.g., :9100, 127.0.0.1:8080)")
+	var listen = flag.String("listen", "", "Listen address for HTTP mode (e.g., :9100, 127.0.0.1:8080); /health and /metrics are served there without authentication")
+	var configFile = flag.String("config", "", "Path to a YAML file configuring the datasources and the tool policy; defaults to PROMETHEUS_URL")
+	var enabledTools = flag.String("enabled-tools", "", "Comma separated list of the only tools to expose (overrides the config file)")
+	var disabledTools = flag.String("disabled-tools", "", "Comma separated list of tools not to expose (overrides the config file)")
+	var maxRange = flag.String("max-range", "", "Maximum time range a query may cover, e.g. 7d (overrides the config file)")
+	var minStep = flag.String("min-step", "", "Minimum range query step, e.g. 30s (overrides the config file)")
+	var rateLimit = flag.Float64("rate-limit", 0, "Tool calls per second allowed for each client, 0 for no limit (overrides the config file)")
+	var rateBurst = flag.Int("rate-burst", 0, "Tool calls a client can make at once, defaults to the rate limit (overrides the config file)")
+	var maxConcurrentQueries = flag.Int("max-concurrent-queries", 0, "Maximum number of concurrent Prometheus queries, 0 for no limit (overrides the config file)")
+	var queueTimeout = flag.Duration("queue-timeout", 0, "How long queries wait for a free slot when the concurrency limit is reached (default 30s)")
+	var record = flag.String("record", "", "Directory to record every Prometheus request and response into")
+	var replay = flag.String("replay", "", "Directory of a recording to answer Prometheus requests from, instead of querying the datasources")
+	var stateful = flag.Bool("stateful", false, "Keep a query history per session for the rerun_query tool; in HTTP mode this also enables sessions")
+	var queryTemplates = flag.String("query-templates", "", "YAML file of query templates added to the built-in ones (overrides the config file)")
+	var logLevel = flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	var logFormat = flag.String("log-format", logging.FormatText, "Log format: text or json")
 	flag.Parse()
 
-	// Get Prometheus URL from environment variable
-	prometheusURL := os.Getenv("PROMETHEUS_URL")
+	// Logs go to stderr, stdout carries the protocol in stdio mode
+	logger, err := logging.New(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fatal("Invalid logging flags", err)
+	}
+	slog.SetDefault(logger)
+
+	// Load the datasources from the config file, or from PROMETHEUS_URL without one
+	cfg := config.FromEnv()
+	if *configFile != "" {
+		cfg, err = config.Load(*configFile)
+		if err != nil {
+			fatal("Failed to load config", err)
+		}
+	}
+
+	// Apply the tool policy flags over the config file
+	if *enabledTools != "" {
+		cfg.Policy.EnabledTools = config.ParseToolList(*enabledTools)
+	}
+	if *disabledTools != "" {
+		cfg.Policy.DisabledTools = config.ParseToolList(*disabledTools)
+	}
+	if *maxRange != "" {
+		if cfg.Policy.MaxRange, err = model.ParseDuration(*maxRange); err != nil {
+			fatal("Invalid --max-range", err)
+		}
+	}
+	if *minStep != "" {
+		if cfg.Policy.MinStep, err = model.ParseDuration(*minStep); err != nil {
+			fatal("Invalid --min-step", err)
+		}
+	}
+
+	// Apply the limit flags over the config file
+	if *rateLimit > 0 {
+		cfg.Limits.RateLimit = *rateLimit
+	}
+	if *rateBurst > 0 {
+		cfg.Limits.RateBurst = *rateBurst
+	}
+	if *maxConcurrentQueries > 0 {
+		cfg.Limits.MaxConcurrentQueries = *maxConcurrentQueries
+	}
+	if *queueTimeout > 0 {
+		cfg.Limits.QueueTimeout = model.Duration(*queueTimeout)
+	}
+
+	// Apply the traffic recording flags over the config file
+	if *record != "" {
+		cfg.Traffic.Record = *record
+	}
+	if *replay != "" {
+		cfg.Traffic.Replay = *replay
+	}
+
+	if *stateful {
+		cfg.Sessions.Stateful = true
+	}
+
+	if *queryTemplates != "" {
+		cfg.QueryTemplates = *queryTemplates
+	}
 
-	// Create Prometheus client
-	promClient, err := prometheus.NewPrometheusClient(prometheusURL)
+	// The flags may conflict with each other or with the config file, e.g.
+	// --record with a replay configured
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+	library, err := templates.Load(cfg.QueryTemplates)
+	if err != nil {
+		fatal("Failed to load query templates", err)
+	}
+
+	// Create Prometheus clients
+	datasources, err := prometheus.NewDatasources(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create Prometheus client: %v", err)
+		fatal("Failed to create Prometheus clients", err)
 	}
 
 	// Create MCP server
-	mcpServer, err := mcp.NewMCPServer(promClient)
+	mcpServer, err := mcp.NewMCPServer(datasources, cfg.Policy, cfg.Limits, cfg.Sessions, library)
 	if err != nil {
-		log.Fatalf("Failed to create MCP server: %v", err)
+		fatal("Failed to create MCP server", err)
 	}
 
 	// Choose server mode based on flags
 	if *listen != "" {
 		// HTTP mode
+		authenticator, err := auth.NewFromConfig(cfg.Auth)
+		if err != nil {
+			fatal("Failed to create authenticator", err)
+		}
+
 		ctx := context.Background()
-		if err := http.Serve(ctx, mcpServer, *listen); err != nil {
-			log.Fatalf("HTTP server failed: %v", err)
+		if err := http.Serve(ctx, mcpServer, *listen, authenticator, cfg.Sessions.Stateful); err != nil {
+			fatal("HTTP server failed", err)
 		}
 	} else {
 		// Start server on stdio (default mode)
 		stdioServer := server.NewStdioServer(mcpServer)
+		stdioServer.SetErrorLogger(slog.NewLogLogger(logger.Handler(), slog.LevelError))
 		if err := stdioServer.Listen(context.Background(), os.Stdin, os.Stdout); err != nil {
-			log.Fatalf("Server failed: %v", err)
+			fatal("Server failed", err)
 		}
 	}
 }
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
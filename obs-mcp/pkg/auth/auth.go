@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+)
+
+// ErrInvalidToken is returned for tokens no authenticator accepts.
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// Identity is the authenticated caller of the MCP endpoint.
+type Identity struct {
+	Username string   `json:"username"`
+	UID      string   `json:"uid,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	// Method names the authenticator which accepted the token.
+	Method string `json:"method"`
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the authenticated identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the identity of the caller, if the request was
+// authenticated.
+func IdentityFrom(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+// Authenticator validates bearer tokens. It returns ErrInvalidToken when the
+// token is not accepted, and other errors when it could not be checked.
+type Authenticator interface {
+	AuthenticateToken(ctx context.Context, token string) (*Identity, error)
+}
+
+// chain tries authenticators in order until one accepts the token.
+type chain []Authenticator
+
+func (c chain) AuthenticateToken(ctx context.Context, token string) (*Identity, error) {
+	var errs []error
+	for _, authenticator := range c {
+		identity, err := authenticator.AuthenticateToken(ctx, token)
+		if err == nil {
+			return identity, nil
+		}
+		if !errors.Is(err, ErrInvalidToken) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, ErrInvalidToken
+}
+
+// NewFromConfig creates the authenticators of cfg. It returns nil when
+// authentication is not configured.
+func NewFromConfig(cfg config.AuthConfig) (Authenticator, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	var authenticators chain
+	if len(cfg.StaticTokens) > 0 {
+		static, err := NewStaticTokenAuthenticator(cfg.StaticTokens)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, static)
+	}
+	if cfg.TokenReview != nil {
+		tokenReview, err := NewTokenReviewAuthenticator(*cfg.TokenReview)
+		if err != nil {
+			return nil, fmt.Errorf("error creating token review authenticator: %w", err)
+		}
+		authenticators = append(authenticators, tokenReview)
+	}
+	return authenticators, nil
+}
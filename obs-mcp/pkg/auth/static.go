@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+)
+
+type staticToken struct {
+	hash     [sha256.Size]byte
+	identity Identity
+}
+
+// StaticTokenAuthenticator accepts a fixed set of bearer tokens.
+type StaticTokenAuthenticator struct {
+	tokens []staticToken
+}
+
+// NewStaticTokenAuthenticator reads the configured tokens. Token files are
+// read once, at startup.
+func NewStaticTokenAuthenticator(tokens []config.StaticToken) (*StaticTokenAuthenticator, error) {
+	a := &StaticTokenAuthenticator{}
+	for _, token := range tokens {
+		value := string(token.Token)
+		if token.TokenFile != "" {
+			content, err := os.ReadFile(token.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("error reading token file: %w", err)
+			}
+			value = strings.TrimSpace(string(content))
+		}
+		if value == "" {
+			return nil, fmt.Errorf("static token of %s is empty", token.Username)
+		}
+
+		a.tokens = append(a.tokens, staticToken{
+			hash:     sha256.Sum256([]byte(value)),
+			identity: Identity{Username: token.Username, Groups: token.Groups, Method: "static"},
+		})
+	}
+	return a, nil
+}
+
+func (a *StaticTokenAuthenticator) AuthenticateToken(_ context.Context, token string) (*Identity, error) {
+	// Compare hashes in constant time so that neither the tokens nor their
+	// length leak through timing.
+	hash := sha256.Sum256([]byte(token))
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(hash[:], t.hash[:]) == 1 {
+			identity := t.identity
+			return &identity, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
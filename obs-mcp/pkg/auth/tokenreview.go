@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	"github.com/inecas/obs-mcp/pkg/metrics"
+	promconfig "github.com/prometheus/common/config"
+)
+
+const (
+	tokenReviewPath = "/apis/authentication.k8s.io/v1/tokenreviews"
+	// maxCachedReviews bounds the memory used by the review cache.
+	maxCachedReviews = 1000
+)
+
+// tokenReview is the subset of the authentication.k8s.io/v1 TokenReview
+// object used by the authenticator.
+type tokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       tokenReviewSpec   `json:"spec"`
+	Status     tokenReviewStatus `json:"status,omitempty"`
+}
+
+type tokenReviewSpec struct {
+	Token     string   `json:"token"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type tokenReviewStatus struct {
+	Authenticated bool     `json:"authenticated"`
+	User          userInfo `json:"user,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+type userInfo struct {
+	Username string   `json:"username"`
+	UID      string   `json:"uid"`
+	Groups   []string `json:"groups"`
+}
+
+type cachedReview struct {
+	identity *Identity
+	expires  time.Time
+}
+
+// TokenReviewAuthenticator validates bearer tokens by creating TokenReviews
+// in a Kubernetes API server, caching the results for a while.
+type TokenReviewAuthenticator struct {
+	url       string
+	audiences []string
+	client    *http.Client
+	cacheTTL  time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedReview
+	now   func() time.Time
+}
+
+func NewTokenReviewAuthenticator(cfg config.TokenReviewConfig) (*TokenReviewAuthenticator, error) {
+	client, err := promconfig.NewClientFromConfig(cfg.HTTPClientConfig, "obs-mcp-token-review")
+	if err != nil {
+		return nil, err
+	}
+	return &TokenReviewAuthenticator{
+		url:       strings.TrimSuffix(cfg.URL, "/") + tokenReviewPath,
+		audiences: cfg.Audiences,
+		client:    client,
+		cacheTTL:  time.Duration(cfg.CacheTTL),
+		cache:     map[[sha256.Size]byte]cachedReview{},
+		now:       time.Now,
+	}, nil
+}
+
+func (a *TokenReviewAuthenticator) AuthenticateToken(ctx context.Context, token string) (*Identity, error) {
+	key := sha256.Sum256([]byte(token))
+	if identity, ok := a.cached(key); ok {
+		if identity == nil {
+			return nil, ErrInvalidToken
+		}
+		return identity, nil
+	}
+
+	status, err := a.review(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity *Identity
+	if status.Authenticated {
+		identity = &Identity{
+			Username: status.User.Username,
+			UID:      status.User.UID,
+			Groups:   status.User.Groups,
+			Method:   "tokenreview",
+		}
+	}
+	a.store(key, identity)
+
+	if identity == nil {
+		return nil, ErrInvalidToken
+	}
+	return identity, nil
+}
+
+func (a *TokenReviewAuthenticator) review(ctx context.Context, token string) (*tokenReviewStatus, error) {
+	body, err := json.Marshal(tokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+		Spec:       tokenReviewSpec{Token: token, Audiences: a.audiences},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error creating token review: %w", err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error reading token review: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token review failed with status %s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+
+	var review tokenReview
+	if err := json.Unmarshal(content, &review); err != nil {
+		return nil, fmt.Errorf("error decoding token review: %w", err)
+	}
+	return &review.Status, nil
+}
+
+// cached returns the cached result for key; a nil identity means the token
+// was rejected.
+func (a *TokenReviewAuthenticator) cached(key [sha256.Size]byte) (*Identity, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.cache[key]
+	hit := ok && !a.now().After(entry.expires)
+	metrics.ObserveCacheLookup("token_review", hit)
+	return entry.identity, hit
+}
+
+func (a *TokenReviewAuthenticator) store(key [sha256.Size]byte, identity *Identity) {
+	if a.cacheTTL <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if len(a.cache) >= maxCachedReviews {
+		for k, entry := range a.cache {
+			if now.After(entry.expires) {
+				delete(a.cache, k)
+			}
+		}
+		if len(a.cache) >= maxCachedReviews {
+			a.cache = map[[sha256.Size]byte]cachedReview{}
+		}
+	}
+	a.cache[key] = cachedReview{identity: identity, expires: now.Add(a.cacheTTL)}
+}
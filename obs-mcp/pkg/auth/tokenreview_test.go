@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+const serviceAccountToken = "obs-mcp-sa-token"
+
+// fakeAPIServer answers TokenReviews, accepting only the "valid" token.
+func fakeAPIServer(t *testing.T, reviews *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != tokenReviewPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+serviceAccountToken {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		reviews.Add(1)
+
+		var review tokenReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			t.Errorf("invalid token review request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if review.Kind != "TokenReview" || review.APIVersion != "authentication.k8s.io/v1" {
+			t.Errorf("unexpected object %s %s", review.APIVersion, review.Kind)
+		}
+
+		switch {
+		case review.Spec.Token == "backend-error":
+			http.Error(w, "etcdserver: request timed out", http.StatusInternalServerError)
+			return
+		case review.Spec.Token == "valid" && !slices.Contains(review.Spec.Audiences, "wrong-audience"):
+			review.Status = tokenReviewStatus{
+				Authenticated: true,
+				User: userInfo{
+					Username: "system:serviceaccount:monitoring:assistant",
+					UID:      "1234",
+					Groups:   []string{"system:serviceaccounts", "system:authenticated"},
+				},
+			}
+		default:
+			review.Status = tokenReviewStatus{Error: "token is invalid"}
+		}
+		review.Spec.Token = ""
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+}
+
+func newTestAuthenticator(t *testing.T, url string, audiences []string) *TokenReviewAuthenticator {
+	cfg := config.TokenReviewConfig{
+		URL:       url,
+		Audiences: audiences,
+		CacheTTL:  model.Duration(time.Minute),
+		HTTPClientConfig: promconfig.HTTPClientConfig{
+			Authorization: &promconfig.Authorization{Type: "Bearer", Credentials: serviceAccountToken},
+		},
+	}
+	a, err := NewTokenReviewAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	return a
+}
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	var reviews atomic.Int32
+	server := fakeAPIServer(t, &reviews)
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		token     string
+		audiences []string
+		wantUser  string
+		wantErr   error
+		wantOther bool
+	}{
+		{name: "valid token", token: "valid", wantUser: "system:serviceaccount:monitoring:assistant"},
+		{name: "valid token for audience", token: "valid", audiences: []string{"obs-mcp"}, wantUser: "system:serviceaccount:monitoring:assistant"},
+		{name: "wrong audience", token: "valid", audiences: []string{"wrong-audience"}, wantErr: ErrInvalidToken},
+		{name: "invalid token", token: "forged", wantErr: ErrInvalidToken},
+		{name: "backend failure", token: "backend-error", wantOther: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuthenticator(t, server.URL+"/", tt.audiences)
+			identity, err := a.AuthenticateToken(context.Background(), tt.token)
+
+			switch {
+			case tt.wantOther:
+				if err == nil || errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("expected a backend error, got %v", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if identity.Username != tt.wantUser || identity.UID != "1234" || identity.Method != "tokenreview" {
+					t.Fatalf("unexpected identity %+v", identity)
+				}
+				if !slices.Contains(identity.Groups, "system:authenticated") {
+					t.Fatalf("groups not propagated: %v", identity.Groups)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenReviewAuthenticatorCache(t *testing.T) {
+	var reviews atomic.Int32
+	server := fakeAPIServer(t, &reviews)
+	defer server.Close()
+
+	a := newTestAuthenticator(t, server.URL, nil)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	for _, token := range []string{"valid", "valid", "forged", "forged"} {
+		a.AuthenticateToken(context.Background(), token)
+	}
+	if got := reviews.Load(); got != 2 {
+		t.Fatalf("expected accepted and rejected tokens to be cached, got %d reviews", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := a.AuthenticateToken(context.Background(), "valid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := reviews.Load(); got != 3 {
+		t.Fatalf("expected an expired entry to be reviewed again, got %d reviews", got)
+	}
+
+	// Failures to reach the API server are not cached
+	a.AuthenticateToken(context.Background(), "backend-error")
+	a.AuthenticateToken(context.Background(), "backend-error")
+	if got := reviews.Load(); got != 5 {
+		t.Fatalf("expected backend errors not to be cached, got %d reviews", got)
+	}
+}
+
+func TestChainFallsBackToTokenReview(t *testing.T) {
+	var reviews atomic.Int32
+	server := fakeAPIServer(t, &reviews)
+	defer server.Close()
+
+	static, err := NewStaticTokenAuthenticator([]config.StaticToken{{Token: "static-secret", Username: "ci"}})
+	if err != nil {
+		t.Fatalf("failed to create static authenticator: %v", err)
+	}
+	a := chain{static, newTestAuthenticator(t, server.URL, nil)}
+
+	identity, err := a.AuthenticateToken(context.Background(), "static-secret")
+	if err != nil || identity.Username != "ci" || identity.Method != "static" {
+		t.Fatalf("expected the static token to authenticate as ci, got %+v, %v", identity, err)
+	}
+	if reviews.Load() != 0 {
+		t.Fatalf("static tokens must not be sent to the API server")
+	}
+
+	identity, err = a.AuthenticateToken(context.Background(), "valid")
+	if err != nil || identity.Method != "tokenreview" {
+		t.Fatalf("expected the token review to authenticate, got %+v, %v", identity, err)
+	}
+
+	if _, err := a.AuthenticateToken(context.Background(), "forged"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected %v, got %v", ErrInvalidToken, err)
+	}
+}
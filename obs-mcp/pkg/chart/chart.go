@@ -0,0 +1,343 @@
+// Package chart renders time series as line charts in pure Go, either as SVG
+// or as PNG images.
+package chart
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"time"
+)
+
+const (
+	DefaultWidth  = 800
+	DefaultHeight = 400
+
+	// maxLegendEntries caps the legend so that a query returning hundreds of
+	// series still produces a readable image.
+	maxLegendEntries = 10
+	maxLabelLength   = 90
+
+	marginLeft   = 80
+	marginRight  = 20
+	marginTop    = 40
+	marginBottom = 40
+	legendRow    = 16
+)
+
+// Point is a single sample of a series.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series is a named line in the chart.
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+// Chart describes a line chart of one or more series.
+type Chart struct {
+	Title string
+	// Unit controls how values on the y axis are formatted, see FormatValue.
+	Unit   string
+	Series []Series
+	// Step is the expected distance between samples; lines are interrupted
+	// where samples are missing for longer than that. Zero disables gaps.
+	Step   time.Duration
+	Width  int
+	Height int
+}
+
+var palette = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+	{0xe3, 0x77, 0xc2, 0xff},
+	{0x7f, 0x7f, 0x7f, 0xff},
+	{0xbc, 0xbd, 0x22, 0xff},
+	{0x17, 0xbe, 0xcf, 0xff},
+}
+
+var (
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colorText       = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	colorAxis       = color.RGBA{0x66, 0x66, 0x66, 0xff}
+	colorGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+)
+
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+type point struct {
+	x, y float64
+}
+
+// canvas is implemented by the output formats.
+type canvas interface {
+	rect(x, y, w, h float64, c color.RGBA)
+	line(x1, y1, x2, y2 float64, c color.RGBA)
+	polyline(pts []point, c color.RGBA)
+	// text draws s with its baseline at y.
+	text(x, y float64, s string, a anchor, c color.RGBA)
+	bold(x, y float64, s string, a anchor, c color.RGBA)
+	encode() ([]byte, error)
+}
+
+// SVG renders the chart as an SVG document.
+func (c *Chart) SVG() ([]byte, error) {
+	width, height := c.size()
+	return c.draw(newSVGCanvas(width, height))
+}
+
+// PNG renders the chart as a PNG image.
+func (c *Chart) PNG() ([]byte, error) {
+	width, height := c.size()
+	return c.draw(newRasterCanvas(width, height))
+}
+
+func (c *Chart) size() (int, int) {
+	width, height := c.Width, c.Height
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	if height <= 0 {
+		height = DefaultHeight
+	}
+	return width, height + c.legendHeight()
+}
+
+func (c *Chart) legendHeight() int {
+	entries := min(len(c.Series), maxLegendEntries)
+	if len(c.Series) > maxLegendEntries {
+		entries++
+	}
+	if entries == 0 {
+		return 0
+	}
+	return entries*legendRow + legendRow/2
+}
+
+func (c *Chart) draw(cv canvas) ([]byte, error) {
+	width, height := c.size()
+	plotHeight := height - c.legendHeight()
+
+	cv.rect(0, 0, float64(width), float64(height), colorBackground)
+	if c.Title != "" {
+		cv.bold(float64(width)/2, 24, c.Title, anchorMiddle, colorText)
+	}
+
+	area := plotArea{
+		left:   marginLeft,
+		top:    marginTop,
+		right:  float64(width - marginRight),
+		bottom: float64(plotHeight - marginBottom),
+	}
+
+	tMin, tMax, vMin, vMax, ok := c.bounds()
+	if !ok {
+		cv.text(float64(width)/2, float64(plotHeight)/2, "No data", anchorMiddle, colorAxis)
+		return cv.encode()
+	}
+
+	yTicks := valueTicks(vMin, vMax, c.Unit)
+	vMin, vMax = math.Min(vMin, yTicks[0]), math.Max(vMax, yTicks[len(yTicks)-1])
+	area.tMin, area.tMax, area.vMin, area.vMax = tMin, tMax, vMin, vMax
+
+	for _, tick := range yTicks {
+		y := area.y(tick)
+		cv.line(area.left, y, area.right, y, colorGrid)
+		cv.text(area.left-6, y+4, FormatValue(tick, c.Unit), anchorEnd, colorText)
+	}
+	layout := timeLayout(tMax.Sub(tMin))
+	for _, tick := range timeTicks(tMin, tMax) {
+		x := area.x(tick)
+		cv.line(x, area.top, x, area.bottom, colorGrid)
+		cv.text(x, area.bottom+16, tick.UTC().Format(layout), anchorMiddle, colorText)
+	}
+	cv.line(area.left, area.bottom, area.right, area.bottom, colorAxis)
+	cv.line(area.left, area.top, area.left, area.bottom, colorAxis)
+	cv.text(area.right, area.bottom+32, "time (UTC)", anchorEnd, colorAxis)
+	if c.Unit != "" {
+		cv.text(area.left-6, area.top-8, c.Unit, anchorEnd, colorAxis)
+	}
+
+	for i, series := range c.Series {
+		col := palette[i%len(palette)]
+		for _, segment := range c.segments(series.Points) {
+			pts := make([]point, len(segment))
+			for j, p := range segment {
+				pts[j] = point{area.x(p.Time), area.y(p.Value)}
+			}
+			cv.polyline(pts, col)
+		}
+	}
+
+	y := float64(plotHeight + legendRow/2)
+	for i, series := range c.Series {
+		if i == maxLegendEntries {
+			cv.text(marginLeft, y+legendRow-4, fmt.Sprintf("... and %d more series", len(c.Series)-maxLegendEntries), anchorStart, colorAxis)
+			break
+		}
+		cv.rect(marginLeft, y+4, 12, 8, palette[i%len(palette)])
+		cv.text(marginLeft+18, y+legendRow-4, truncate(series.Name, maxLabelLength), anchorStart, colorText)
+		y += legendRow
+	}
+
+	return cv.encode()
+}
+
+// segments splits points into runs without NaN values or missing samples.
+func (c *Chart) segments(points []Point) [][]Point {
+	var segments [][]Point
+	var current []Point
+	for _, p := range points {
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+			if len(current) > 0 {
+				segments = append(segments, current)
+			}
+			current = nil
+			continue
+		}
+		if len(current) > 0 && c.Step > 0 && p.Time.Sub(current[len(current)-1].Time) > c.Step*3/2 {
+			segments = append(segments, current)
+			current = nil
+		}
+		current = append(current, p)
+	}
+	if len(current) > 0 {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+func (c *Chart) bounds() (tMin, tMax time.Time, vMin, vMax float64, ok bool) {
+	vMin, vMax = math.Inf(1), math.Inf(-1)
+	for _, series := range c.Series {
+		for _, p := range series.Points {
+			if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+				continue
+			}
+			if !ok || p.Time.Before(tMin) {
+				tMin = p.Time
+			}
+			if !ok || p.Time.After(tMax) {
+				tMax = p.Time
+			}
+			vMin, vMax = math.Min(vMin, p.Value), math.Max(vMax, p.Value)
+			ok = true
+		}
+	}
+	if !ok {
+		return
+	}
+	if !tMax.After(tMin) {
+		tMin, tMax = tMin.Add(-time.Minute), tMax.Add(time.Minute)
+	}
+	if vMax == vMin {
+		pad := math.Max(math.Abs(vMin)*0.1, 1)
+		vMin, vMax = vMin-pad, vMax+pad
+	}
+	return
+}
+
+type plotArea struct {
+	left, top, right, bottom float64
+	tMin, tMax               time.Time
+	vMin, vMax               float64
+}
+
+func (a plotArea) x(t time.Time) float64 {
+	ratio := float64(t.Sub(a.tMin)) / float64(a.tMax.Sub(a.tMin))
+	return a.left + ratio*(a.right-a.left)
+}
+
+func (a plotArea) y(v float64) float64 {
+	ratio := (v - a.vMin) / (a.vMax - a.vMin)
+	return a.bottom - ratio*(a.bottom-a.top)
+}
+
+// valueTicks returns evenly spaced round tick values covering [lo, hi]. Byte
+// values are rounded to powers of 1024 so that they print as whole KiB, MiB...
+func valueTicks(lo, hi float64, unit string) []float64 {
+	scale := 1.0
+	if unit == UnitBytes {
+		for (hi-lo)/(scale*1024) >= 1 {
+			scale *= 1024
+		}
+	}
+	step := niceStep((hi-lo)/scale/5) * scale
+	first, last := math.Floor(lo/step), math.Ceil(hi/step)
+	ticks := make([]float64, 0, int(last-first)+1)
+	for i := first; i <= last; i++ {
+		// Adding zero turns -0 into 0.
+		ticks = append(ticks, i*step+0)
+	}
+	return ticks
+}
+
+func niceStep(raw float64) float64 {
+	exp := math.Pow(10, math.Floor(math.Log10(raw)))
+	switch f := raw / exp; {
+	case f <= 1:
+		return exp
+	case f <= 2:
+		return 2 * exp
+	case f <= 5:
+		return 5 * exp
+	}
+	return 10 * exp
+}
+
+var timeSteps = []time.Duration{
+	time.Second, 5 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 2 * 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour,
+}
+
+// timeTicks returns round timestamps between lo and hi, aiming for about
+// six ticks.
+func timeTicks(lo, hi time.Time) []time.Time {
+	step := timeSteps[len(timeSteps)-1]
+	for _, s := range timeSteps {
+		if hi.Sub(lo)/s <= 6 {
+			step = s
+			break
+		}
+	}
+	var ticks []time.Time
+	for t := lo.Truncate(step); !t.After(hi); t = t.Add(step) {
+		if !t.Before(lo) {
+			ticks = append(ticks, t)
+		}
+	}
+	return ticks
+}
+
+func timeLayout(span time.Duration) string {
+	switch {
+	case span <= time.Minute*10:
+		return "15:04:05"
+	case span <= 24*time.Hour:
+		return "15:04"
+	}
+	return "01-02 15:04"
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
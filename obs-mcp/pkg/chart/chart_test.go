@@ -0,0 +1,168 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		v    float64
+		unit string
+		want string
+	}{
+		{v: 0, unit: UnitNone, want: "0"},
+		{v: 999, unit: UnitNone, want: "999"},
+		{v: 1500, unit: UnitNone, want: "1.5 k"},
+		{v: 2.5e9, unit: UnitNone, want: "2.5 G"},
+		{v: -1500, unit: UnitNone, want: "-1.5 k"},
+		{v: 0.005, unit: UnitNone, want: "0.005"},
+		{v: 0, unit: UnitBytes, want: "0 B"},
+		{v: 512, unit: UnitBytes, want: "512 B"},
+		{v: 1536, unit: UnitBytes, want: "1.5 KiB"},
+		{v: 268435456, unit: UnitBytes, want: "256 MiB"},
+		{v: -2147483648, unit: UnitBytes, want: "-2 GiB"},
+		{v: 0, unit: UnitSeconds, want: "0s"},
+		{v: 5e-7, unit: UnitSeconds, want: "500ns"},
+		{v: 0.00025, unit: UnitSeconds, want: "250µs"},
+		{v: 0.25, unit: UnitSeconds, want: "250ms"},
+		{v: 42, unit: UnitSeconds, want: "42s"},
+		{v: 90, unit: UnitSeconds, want: "1.5min"},
+		{v: 7200, unit: UnitSeconds, want: "2h"},
+		{v: 172800, unit: UnitSeconds, want: "2d"},
+		{v: -0.5, unit: UnitSeconds, want: "-500ms"},
+		{v: 12.345, unit: UnitPercent, want: "12.35%"},
+		{v: 0.25, unit: UnitPercentUnit, want: "25%"},
+		{v: -0.1, unit: UnitPercentUnit, want: "-10%"},
+		{v: 2000, unit: "req/s", want: "2 k req/s"},
+	}
+	for _, tt := range tests {
+		if got := FormatValue(tt.v, tt.unit); got != tt.want {
+			t.Errorf("FormatValue(%v, %q) = %q, want %q", tt.v, tt.unit, got, tt.want)
+		}
+	}
+}
+
+var start = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// line returns n samples a minute apart of f.
+func line(n int, f func(i int) float64) []Point {
+	points := make([]Point, n)
+	for i := range points {
+		points[i] = Point{Time: start.Add(time.Duration(i) * time.Minute), Value: f(i)}
+	}
+	return points
+}
+
+func TestSVG(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []Series
+		// polylines is the number of lines drawn, one per series unless
+		// interrupted by gaps.
+		polylines int
+		noData    bool
+	}{
+		{
+			name: "series",
+			series: []Series{
+				{Name: "a", Points: line(10, func(i int) float64 { return float64(i) })},
+				{Name: "b", Points: line(10, func(i int) float64 { return float64(10 - i) })},
+				{Name: "c", Points: line(10, func(int) float64 { return 5 })},
+			},
+			polylines: 3,
+		},
+		{
+			name: "NaN and infinite samples",
+			series: []Series{
+				{Name: "a", Points: line(10, func(i int) float64 {
+					switch i {
+					case 4:
+						return math.NaN()
+					case 7:
+						return math.Inf(1)
+					}
+					return float64(i)
+				})},
+			},
+			polylines: 3,
+		},
+		{
+			name:   "no series",
+			noData: true,
+		},
+		{
+			name:   "only NaN samples",
+			series: []Series{{Name: "a", Points: line(5, func(int) float64 { return math.NaN() })}},
+			noData: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Chart{Title: "Requests <total>", Unit: UnitBytes, Series: tt.series, Step: time.Minute}
+			svg, err := c.SVG()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			polylines, noData := 0, false
+			decoder := xml.NewDecoder(bytes.NewReader(svg))
+			for {
+				token, err := decoder.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("invalid SVG: %v\n%s", err, svg)
+				}
+				switch token := token.(type) {
+				case xml.StartElement:
+					if token.Name.Local == "polyline" {
+						polylines++
+					}
+				case xml.CharData:
+					if string(token) == "No data" {
+						noData = true
+					}
+				}
+			}
+			if polylines != tt.polylines || noData != tt.noData {
+				t.Errorf("expected %d lines and no data %v, got %d and %v\n%s", tt.polylines, tt.noData, polylines, noData, svg)
+			}
+		})
+	}
+}
+
+func TestPNG(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []Series
+	}{
+		{name: "series", series: []Series{{Name: "a", Points: line(10, func(i int) float64 { return float64(i) })}}},
+		{name: "infinite samples", series: []Series{{Name: "a", Points: line(10, func(int) float64 { return math.Inf(-1) })}}},
+		{name: "no series"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Chart{Series: tt.series, Width: 400, Height: 200}
+			data, err := c.PNG()
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("invalid PNG: %v", err)
+			}
+			// The legend is added below the plot
+			width, height := 400, 200+c.legendHeight()
+			if size := img.Bounds().Size(); size.X != width || size.Y != height {
+				t.Errorf("expected a %dx%d image, got %v", width, height, size)
+			}
+		})
+	}
+}
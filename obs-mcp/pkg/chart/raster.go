@@ -0,0 +1,118 @@
+package chart
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+type rasterCanvas struct {
+	img *image.RGBA
+}
+
+func newRasterCanvas(width, height int) *rasterCanvas {
+	return &rasterCanvas{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (c *rasterCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	r := image.Rect(int(x), int(y), int(math.Ceil(x+w)), int(math.Ceil(y+h)))
+	draw.Draw(c.img, r, image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+func (c *rasterCanvas) line(x1, y1, x2, y2 float64, col color.RGBA) {
+	c.plotLine(int(math.Round(x1)), int(math.Round(y1)), int(math.Round(x2)), int(math.Round(y2)), col, false)
+}
+
+func (c *rasterCanvas) polyline(pts []point, col color.RGBA) {
+	if len(pts) == 1 {
+		c.rect(pts[0].x-1, pts[0].y-1, 3, 3, col)
+		return
+	}
+	for i := 1; i < len(pts); i++ {
+		c.plotLine(int(math.Round(pts[i-1].x)), int(math.Round(pts[i-1].y)),
+			int(math.Round(pts[i].x)), int(math.Round(pts[i].y)), col, true)
+	}
+}
+
+// plotLine draws a line using Bresenham's algorithm, optionally two pixels
+// wide so that data lines stand out from the grid.
+func (c *rasterCanvas) plotLine(x0, y0, x1, y1 int, col color.RGBA, thick bool) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		c.img.SetRGBA(x0, y0, col)
+		if thick {
+			if dx > -dy {
+				c.img.SetRGBA(x0, y0+1, col)
+			} else {
+				c.img.SetRGBA(x0+1, y0, col)
+			}
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func (c *rasterCanvas) text(x, y float64, s string, a anchor, col color.RGBA) {
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(col),
+		Face: basicfont.Face7x13,
+	}
+	width := d.MeasureString(s)
+	dot := fixed.I(int(x))
+	switch a {
+	case anchorMiddle:
+		dot -= width / 2
+	case anchorEnd:
+		dot -= width
+	}
+	d.Dot = fixed.Point26_6{X: dot, Y: fixed.I(int(y))}
+	d.DrawString(s)
+}
+
+// bold emulates a bold face by drawing the text twice, one pixel apart, as
+// the basic font comes in a single weight.
+func (c *rasterCanvas) bold(x, y float64, s string, a anchor, col color.RGBA) {
+	c.text(x, y, s, a, col)
+	c.text(x+1, y, s, a, col)
+}
+
+func (c *rasterCanvas) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,74 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	c := &svgCanvas{}
+	fmt.Fprintf(&c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	return c
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, col color.RGBA) {
+	fmt.Fprintf(&c.buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", x, y, w, h, hex(col))
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 float64, col color.RGBA) {
+	fmt.Fprintf(&c.buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1"/>`+"\n", x1, y1, x2, y2, hex(col))
+}
+
+func (c *svgCanvas) polyline(pts []point, col color.RGBA) {
+	if len(pts) == 1 {
+		fmt.Fprintf(&c.buf, `<circle cx="%.1f" cy="%.1f" r="1.5" fill="%s"/>`+"\n", pts[0].x, pts[0].y, hex(col))
+		return
+	}
+	coords := make([]string, len(pts))
+	for i, p := range pts {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", p.x, p.y)
+	}
+	fmt.Fprintf(&c.buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5" stroke-linejoin="round"/>`+"\n",
+		strings.Join(coords, " "), hex(col))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, a anchor, col color.RGBA) {
+	c.writeText(x, y, s, a, col, "")
+}
+
+func (c *svgCanvas) bold(x, y float64, s string, a anchor, col color.RGBA) {
+	c.writeText(x, y, s, a, col, ` font-weight="bold" font-size="16"`)
+}
+
+func (c *svgCanvas) writeText(x, y float64, s string, a anchor, col color.RGBA, attrs string) {
+	fmt.Fprintf(&c.buf, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s"%s>`, x, y, svgAnchor(a), hex(col), attrs)
+	xml.EscapeText(&c.buf, []byte(s))
+	c.buf.WriteString("</text>\n")
+}
+
+func (c *svgCanvas) encode() ([]byte, error) {
+	c.buf.WriteString("</svg>\n")
+	return c.buf.Bytes(), nil
+}
+
+func svgAnchor(a anchor) string {
+	switch a {
+	case anchorMiddle:
+		return "middle"
+	case anchorEnd:
+		return "end"
+	}
+	return "start"
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
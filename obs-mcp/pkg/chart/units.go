@@ -0,0 +1,71 @@
+package chart
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Units understood by FormatValue. Any other unit is appended verbatim to the
+// value.
+const (
+	UnitNone        = ""
+	UnitBytes       = "bytes"
+	UnitSeconds     = "seconds"
+	UnitPercent     = "percent"
+	UnitPercentUnit = "percentunit"
+)
+
+// FormatValue formats v for display on an axis with the given unit.
+func FormatValue(v float64, unit string) string {
+	switch unit {
+	case UnitBytes:
+		return scaled(v, 1024, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"})
+	case UnitSeconds:
+		return formatSeconds(v)
+	case UnitPercent:
+		return formatNumber(v) + "%"
+	case UnitPercentUnit:
+		return formatNumber(v*100) + "%"
+	case UnitNone:
+		return scaled(v, 1000, []string{"", "k", "M", "G", "T", "P"})
+	}
+	return scaled(v, 1000, []string{"", "k", "M", "G", "T", "P"}) + " " + unit
+}
+
+func scaled(v, base float64, suffixes []string) string {
+	i := 0
+	for math.Abs(v) >= base && i < len(suffixes)-1 {
+		v /= base
+		i++
+	}
+	return strings.TrimSpace(formatNumber(v) + " " + suffixes[i])
+}
+
+func formatSeconds(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs == 0:
+		return "0s"
+	case abs < 1e-6:
+		return formatNumber(v*1e9) + "ns"
+	case abs < 1e-3:
+		return formatNumber(v*1e6) + "µs"
+	case abs < 1:
+		return formatNumber(v*1e3) + "ms"
+	case abs < 60:
+		return formatNumber(v) + "s"
+	case abs < 3600:
+		return formatNumber(v/60) + "min"
+	case abs < 86400:
+		return formatNumber(v/3600) + "h"
+	}
+	return formatNumber(v/86400) + "d"
+}
+
+func formatNumber(v float64) string {
+	if v != 0 && math.Abs(v) < 0.01 {
+		return strconv.FormatFloat(v, 'g', 3, 64)
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
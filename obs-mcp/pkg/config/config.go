@@ -0,0 +1,321 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"go.yaml.in/yaml/v2"
+)
+
+const (
+	// DefaultDatasourceName is used for the datasource configured through
+	// the PROMETHEUS_URL environment variable.
+	DefaultDatasourceName = "default"
+	defaultPrometheusURL  = "http://localhost:9090"
+)
+
+// Config is the obs-mcp configuration file.
+type Config struct {
+	Datasources []DatasourceConfig `yaml:"datasources"`
+	Policy      Policy             `yaml:"policy,omitempty"`
+	Auth        AuthConfig         `yaml:"auth,omitempty"`
+	Limits      Limits             `yaml:"limits,omitempty"`
+	Traffic     Traffic            `yaml:"traffic,omitempty"`
+	Sessions    Sessions           `yaml:"sessions,omitempty"`
+	// QueryTemplates is a YAML file of query templates added to the
+	// built-in ones, replacing those of the same name.
+	QueryTemplates string `yaml:"query_templates,omitempty"`
+}
+
+// DefaultMaxHistory is the number of queries kept per session by default.
+const DefaultMaxHistory = 100
+
+// Sessions configures the state kept for each MCP session.
+type Sessions struct {
+	// Stateful keeps a query history per session, which the rerun_query tool
+	// and the query history resource use. In HTTP mode it also makes the
+	// server issue session IDs.
+	Stateful bool `yaml:"stateful,omitempty"`
+	// MaxHistory is the number of queries kept per session.
+	MaxHistory int `yaml:"max_history,omitempty"`
+}
+
+// HistorySize returns the configured history size or its default.
+func (s Sessions) HistorySize() int {
+	if s.MaxHistory > 0 {
+		return s.MaxHistory
+	}
+	return DefaultMaxHistory
+}
+
+// Traffic configures recording the requests made to the datasources, or
+// replaying a recording instead of querying them.
+type Traffic struct {
+	// Record is the directory the exchanges are recorded into.
+	Record string `yaml:"record,omitempty"`
+	// Replay is the directory of a recording to serve the requests from.
+	Replay string `yaml:"replay,omitempty"`
+}
+
+// Validate checks that recording and replaying are not both enabled.
+func (t Traffic) Validate() error {
+	if t.Record != "" && t.Replay != "" {
+		return fmt.Errorf("traffic cannot be recorded and replayed at the same time")
+	}
+	return nil
+}
+
+// DefaultQueueTimeout is how long upstream queries wait for a free slot when
+// the concurrency cap is reached.
+const DefaultQueueTimeout = model.Duration(30 * time.Second)
+
+// Limits protect the datasources from runaway clients. The zero value
+// disables them.
+type Limits struct {
+	// RateLimit is the number of tool calls per second allowed for each
+	// client, which is the authenticated user or else the client address.
+	RateLimit float64 `yaml:"rate_limit,omitempty"`
+	// RateBurst is the number of calls a client can make at once, defaults to
+	// the rate limit rounded up.
+	RateBurst int `yaml:"rate_burst,omitempty"`
+	// MaxConcurrentQueries caps the requests in flight to all datasources.
+	MaxConcurrentQueries int `yaml:"max_concurrent_queries,omitempty"`
+	// QueueTimeout is how long queries over the cap wait for a free slot.
+	QueueTimeout model.Duration `yaml:"queue_timeout,omitempty"`
+}
+
+// Burst returns the configured burst or its default.
+func (l Limits) Burst() int {
+	if l.RateBurst > 0 {
+		return l.RateBurst
+	}
+	return max(1, int(math.Ceil(l.RateLimit)))
+}
+
+// Validate checks that the limits are not negative.
+func (l Limits) Validate() error {
+	if l.RateLimit < 0 || l.RateBurst < 0 || l.MaxConcurrentQueries < 0 || l.QueueTimeout < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// AuthConfig configures how clients of the HTTP endpoint authenticate. Bearer
+// tokens are checked against the static tokens first, then with a TokenReview.
+// Without any authenticator the endpoint is open to anyone who can reach it.
+type AuthConfig struct {
+	StaticTokens []StaticToken      `yaml:"static_tokens,omitempty"`
+	TokenReview  *TokenReviewConfig `yaml:"token_review,omitempty"`
+}
+
+// Enabled reports whether any authenticator is configured.
+func (c AuthConfig) Enabled() bool {
+	return len(c.StaticTokens) > 0 || c.TokenReview != nil
+}
+
+// StaticToken is a fixed bearer token and the identity it authenticates as.
+type StaticToken struct {
+	Token     promconfig.Secret `yaml:"token,omitempty"`
+	TokenFile string            `yaml:"token_file,omitempty"`
+	Username  string            `yaml:"username"`
+	Groups    []string          `yaml:"groups,omitempty"`
+}
+
+// TokenReviewConfig validates bearer tokens with the TokenReview API of a
+// Kubernetes API server.
+type TokenReviewConfig struct {
+	// URL of the API server, e.g. https://kubernetes.default.svc.
+	URL string `yaml:"url"`
+	// Audiences the tokens must be issued for; empty means the API server's.
+	Audiences []string `yaml:"audiences,omitempty"`
+	// CacheTTL is how long review results are reused for the same token.
+	CacheTTL model.Duration `yaml:"cache_ttl,omitempty"`
+
+	// HTTPClientConfig configures the connection to the API server, which
+	// needs a token allowed to create TokenReviews.
+	HTTPClientConfig promconfig.HTTPClientConfig `yaml:",inline"`
+}
+
+// UnmarshalYAML applies the HTTP client and cache defaults before decoding.
+func (c *TokenReviewConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = TokenReviewConfig{
+		CacheTTL:         model.Duration(time.Minute),
+		HTTPClientConfig: promconfig.DefaultHTTPClientConfig,
+	}
+	type plain TokenReviewConfig
+	return unmarshal((*plain)(c))
+}
+
+// Policy restricts which tools the server exposes and the arguments they
+// accept. The zero value allows everything.
+type Policy struct {
+	// EnabledTools, when not empty, lists the only tools that are exposed.
+	EnabledTools []string `yaml:"enabled_tools,omitempty"`
+	// DisabledTools lists tools that are never exposed.
+	DisabledTools []string `yaml:"disabled_tools,omitempty"`
+	// MaxRange caps the time range a single query may cover.
+	MaxRange model.Duration `yaml:"max_range,omitempty"`
+	// MinStep is the smallest range query resolution step accepted.
+	MinStep model.Duration `yaml:"min_step,omitempty"`
+}
+
+// DatasourceConfig describes a Prometheus compatible API, such as Prometheus
+// itself or a Thanos querier, and how to authenticate against it.
+type DatasourceConfig struct {
+	Name        string `yaml:"name"`
+	URL         string `yaml:"url"`
+	Description string `yaml:"description,omitempty"`
+	// Default marks the datasource used when a tool call does not name one.
+	Default bool `yaml:"default,omitempty"`
+	// Fixtures, instead of a URL, serves the datasource from these files with
+	// an embedded PromQL engine: promtool rule test files or OpenMetrics text.
+	Fixtures []string `yaml:"fixtures,omitempty"`
+
+	// HTTPClientConfig holds the authentication and TLS settings, using the
+	// same keys as Prometheus scrape configs (authorization, basic_auth,
+	// bearer_token_file, tls_config, http_headers...).
+	HTTPClientConfig promconfig.HTTPClientConfig `yaml:",inline"`
+}
+
+// UnmarshalYAML applies the HTTP client defaults before decoding.
+func (c *DatasourceConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DatasourceConfig{HTTPClientConfig: promconfig.DefaultHTTPClientConfig}
+	type plain DatasourceConfig
+	return unmarshal((*plain)(c))
+}
+
+// Load reads and validates the configuration file at path. Relative file
+// paths in it are resolved against the directory of the file.
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range cfg.Datasources {
+		cfg.Datasources[i].HTTPClientConfig.SetDirectory(dir)
+		for j, fixture := range cfg.Datasources[i].Fixtures {
+			cfg.Datasources[i].Fixtures[j] = promconfig.JoinDir(dir, fixture)
+		}
+	}
+	for i := range cfg.Auth.StaticTokens {
+		cfg.Auth.StaticTokens[i].TokenFile = promconfig.JoinDir(dir, cfg.Auth.StaticTokens[i].TokenFile)
+	}
+	if cfg.Auth.TokenReview != nil {
+		cfg.Auth.TokenReview.HTTPClientConfig.SetDirectory(dir)
+	}
+	cfg.Traffic.Record = promconfig.JoinDir(dir, cfg.Traffic.Record)
+	cfg.Traffic.Replay = promconfig.JoinDir(dir, cfg.Traffic.Replay)
+	cfg.QueryTemplates = promconfig.JoinDir(dir, cfg.QueryTemplates)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseToolList splits a comma separated list of tool names, as accepted by
+// the tool policy flags.
+func ParseToolList(list string) []string {
+	var tools []string
+	for _, tool := range strings.Split(list, ",") {
+		if tool = strings.TrimSpace(tool); tool != "" {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// FromEnv returns the configuration used without a config file: a single
+// datasource pointing at PROMETHEUS_URL.
+func FromEnv() *Config {
+	url := os.Getenv("PROMETHEUS_URL")
+	if url == "" {
+		url = defaultPrometheusURL
+	}
+
+	return &Config{
+		Datasources: []DatasourceConfig{{
+			Name:             DefaultDatasourceName,
+			URL:              url,
+			Default:          true,
+			HTTPClientConfig: promconfig.DefaultHTTPClientConfig,
+		}},
+	}
+}
+
+// Validate checks that datasources are named uniquely and at most one of them
+// is the default.
+func (c *Config) Validate() error {
+	if len(c.Datasources) == 0 {
+		return fmt.Errorf("at least one datasource must be configured")
+	}
+
+	names := map[string]bool{}
+	defaults := 0
+	for _, ds := range c.Datasources {
+		if ds.Name == "" {
+			return fmt.Errorf("datasource name must not be empty")
+		}
+		if names[ds.Name] {
+			return fmt.Errorf("duplicate datasource name %q", ds.Name)
+		}
+		names[ds.Name] = true
+
+		if (ds.URL == "") == (len(ds.Fixtures) == 0) {
+			return fmt.Errorf("datasource %q must set exactly one of url and fixtures", ds.Name)
+		}
+		if ds.Default {
+			defaults++
+		}
+		if err := ds.HTTPClientConfig.Validate(); err != nil {
+			return fmt.Errorf("datasource %q: %w", ds.Name, err)
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("only one datasource can be the default")
+	}
+	if err := c.Limits.Validate(); err != nil {
+		return err
+	}
+	if err := c.Traffic.Validate(); err != nil {
+		return err
+	}
+	if c.Sessions.MaxHistory < 0 {
+		return fmt.Errorf("sessions max_history must not be negative")
+	}
+	return c.Auth.Validate()
+}
+
+// Validate checks that every authenticator is complete.
+func (c AuthConfig) Validate() error {
+	for i, token := range c.StaticTokens {
+		if (token.Token == "") == (token.TokenFile == "") {
+			return fmt.Errorf("static token %d must set exactly one of token and token_file", i)
+		}
+		if token.Username == "" {
+			return fmt.Errorf("static token %d has no username", i)
+		}
+	}
+	if c.TokenReview != nil {
+		if c.TokenReview.URL == "" {
+			return fmt.Errorf("token_review has no url")
+		}
+		if err := c.TokenReview.HTTPClientConfig.Validate(); err != nil {
+			return fmt.Errorf("token_review: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseToolList(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{list: "", want: nil},
+		{list: "list_metrics", want: []string{"list_metrics"}},
+		{list: "list_metrics, execute_range_query", want: []string{"list_metrics", "execute_range_query"}},
+		{list: " list_metrics,,render_graph, ", want: []string{"list_metrics", "render_graph"}},
+	}
+	for _, tt := range tests {
+		if got := ParseToolList(tt.list); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseToolList(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
+
+// writeConfig writes content as the config file of a temporary directory.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			name: "valid",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+    default: true
+  - name: thanos
+    url: https://thanos:9091
+    authorization:
+      credentials_file: /var/run/secrets/token
+  - name: fixtures
+    fixtures: [tests.yaml]
+policy:
+  max_range: 1d
+  min_step: 30s
+limits:
+  rate_limit: 2.5
+  queue_timeout: 10s
+`,
+		},
+		{
+			name: "no default",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+  - name: staging
+    url: http://staging:9090
+`,
+		},
+		{
+			name:    "no datasource",
+			content: `datasources: []`,
+			err:     "at least one datasource",
+		},
+		{
+			name: "duplicate names",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+  - name: prod
+    url: http://thanos:9090
+`,
+			err: `duplicate datasource name "prod"`,
+		},
+		{
+			name: "missing name",
+			content: `
+datasources:
+  - url: http://prometheus:9090
+`,
+			err: "datasource name must not be empty",
+		},
+		{
+			name: "ambiguous default",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+    default: true
+  - name: staging
+    url: http://staging:9090
+    default: true
+`,
+			err: "only one datasource can be the default",
+		},
+		{
+			name: "url and fixtures",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+    fixtures: [tests.yaml]
+`,
+			err: `datasource "prod" must set exactly one of url and fixtures`,
+		},
+		{
+			name: "neither url nor fixtures",
+			content: `
+datasources:
+  - name: prod
+`,
+			err: `datasource "prod" must set exactly one of url and fixtures`,
+		},
+		{
+			name: "invalid duration",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+policy:
+  max_range: 1 day
+`,
+			err: "error parsing config file",
+		},
+		{
+			name: "negative limit",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+limits:
+  max_concurrent_queries: -1
+`,
+			err: "limits must not be negative",
+		},
+		{
+			name: "negative history",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+sessions:
+  max_history: -5
+`,
+			err: "max_history must not be negative",
+		},
+		{
+			name: "unknown field",
+			content: `
+datasources:
+  - name: prod
+    url: http://prometheus:9090
+    timeout: 10s
+`,
+			err: "field timeout not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadRelativePaths(t *testing.T) {
+	path := writeConfig(t, `
+datasources:
+  - name: prod
+    url: https://prometheus:9091
+    authorization:
+      credentials_file: secrets/token
+  - name: fixtures
+    fixtures: [testdata/tests.yaml, /data/metrics.om]
+query_templates: templates.yaml
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Dir(path)
+	if want, got := filepath.Join(dir, "secrets/token"), cfg.Datasources[0].HTTPClientConfig.Authorization.CredentialsFile; got != want {
+		t.Errorf("expected credentials file %q, got %q", want, got)
+	}
+	want := []string{filepath.Join(dir, "testdata/tests.yaml"), "/data/metrics.om"}
+	if got := cfg.Datasources[1].Fixtures; !slices.Equal(got, want) {
+		t.Errorf("expected fixtures %q, got %q", want, got)
+	}
+	if want := filepath.Join(dir, "templates.yaml"); cfg.QueryTemplates != want {
+		t.Errorf("expected query templates %q, got %q", want, cfg.QueryTemplates)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil || !strings.Contains(err.Error(), "error reading config file") {
+		t.Errorf("expected a missing file to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,501 @@
+// Package embedded answers Prometheus API requests with an in-process PromQL
+// engine over fixture files, so that the tools can be demonstrated and tested
+// without a running Prometheus.
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const (
+	// maxPointsPerSeries is the limit Prometheus enforces on range queries.
+	maxPointsPerSeries = 11000
+	defaultMaxSamples  = 50000000
+	defaultTimeout     = 30 * time.Second
+	lookbackDelta      = 5 * time.Minute
+)
+
+// Options configure the embedded backend.
+type Options struct {
+	// Start is the time of the first sample of promtool input series. When
+	// zero the series are shifted to end at the time they are loaded.
+	Start time.Time
+	// MaxSamples caps the samples a single query may load.
+	MaxSamples int
+	// Timeout caps the evaluation time of a single query.
+	Timeout time.Duration
+}
+
+// Backend implements the Prometheus API used by the tools over fixture data.
+type Backend struct {
+	storage  *memStorage
+	engine   *promql.Engine
+	metadata map[string][]v1.Metadata
+	groups   []ruleGroup
+	// mint and maxt bound the loaded samples, in milliseconds.
+	mint, maxt int64
+}
+
+// Load reads the fixture files at paths: promtool rule unit test files
+// (.yaml, .yml), whose input series and rule files are loaded, and files in
+// the OpenMetrics text format (anything else). Recording rules are evaluated
+// over the loaded data so that their series can be queried too.
+func Load(paths []string, opts Options) (*Backend, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixture files given")
+	}
+	f, err := loadFixtures(paths, opts.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MaxSamples == 0 {
+		opts.MaxSamples = defaultMaxSamples
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	b := &Backend{
+		engine: promql.NewEngine(promql.EngineOpts{
+			MaxSamples:           opts.MaxSamples,
+			Timeout:              opts.Timeout,
+			LookbackDelta:        lookbackDelta,
+			EnableAtModifier:     true,
+			EnableNegativeOffset: true,
+		}),
+		metadata: f.metadata,
+		groups:   f.groups,
+	}
+	b.setSeries(f.series)
+
+	if err := b.evaluateRecordingRules(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Backend) setSeries(all []*series) {
+	b.storage = newMemStorage(all)
+	b.mint, b.maxt = math.MaxInt64, math.MinInt64
+	for _, s := range b.storage.series {
+		if len(s.samples) == 0 {
+			continue
+		}
+		b.mint = min(b.mint, s.samples[0].t)
+		b.maxt = max(b.maxt, s.samples[len(s.samples)-1].t)
+	}
+}
+
+// evaluateRecordingRules adds the series of each recording rule, evaluated at
+// the interval of its group over the whole data range. Rules are evaluated in
+// order, so later rules can use the output of earlier ones.
+func (b *Backend) evaluateRecordingRules() error {
+	if b.mint > b.maxt {
+		return nil
+	}
+	for _, g := range b.groups {
+		interval := groupInterval(g)
+		start := time.UnixMilli(b.mint).Truncate(interval)
+		end := time.UnixMilli(b.maxt)
+		for _, rule := range g.group.Rules {
+			if rule.Record == "" {
+				continue
+			}
+			matrix, err := b.rangeQuery(context.Background(), rule.Expr, start, end, interval)
+			if err != nil {
+				return fmt.Errorf("error evaluating recording rule %s in %s: %w", rule.Record, g.file, err)
+			}
+
+			recorded := slices.Clone(b.storage.series)
+			for _, stream := range matrix {
+				builder := labels.NewBuilder(stream.Metric)
+				builder.Set(labels.MetricName, rule.Record)
+				for name, value := range rule.Labels {
+					builder.Set(name, value)
+				}
+				s := &series{labels: builder.Labels()}
+				for _, point := range stream.Floats {
+					s.samples = append(s.samples, sample{t: point.T, f: point.F})
+				}
+				recorded = append(recorded, s)
+			}
+			b.setSeries(recorded)
+		}
+	}
+	return nil
+}
+
+func groupInterval(g ruleGroup) time.Duration {
+	if g.group.Interval > 0 {
+		return time.Duration(g.group.Interval)
+	}
+	return time.Duration(defaultInterval)
+}
+
+func (b *Backend) rangeQuery(ctx context.Context, query string, start, end time.Time, step time.Duration) (promql.Matrix, error) {
+	q, err := b.engine.NewRangeQuery(ctx, b.storage, nil, query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	result := q.Exec(ctx)
+	if result.Err != nil {
+		return nil, queryError(result.Err)
+	}
+	return result.Matrix()
+}
+
+// queryError converts engine errors into the errors the HTTP API reports.
+func queryError(err error) error {
+	var timeout promql.ErrQueryTimeout
+	if errors.As(err, &timeout) {
+		return &v1.Error{Type: v1.ErrTimeout, Msg: err.Error()}
+	}
+	return err
+}
+
+// Query evaluates an instant query. Options are ignored.
+func (b *Backend) Query(ctx context.Context, query string, ts time.Time, _ ...v1.Option) (model.Value, v1.Warnings, error) {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	q, err := b.engine.NewInstantQuery(ctx, b.storage, nil, query, ts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer q.Close()
+	result := q.Exec(ctx)
+	if result.Err != nil {
+		return nil, nil, queryError(result.Err)
+	}
+	warnings, _ := result.Warnings.AsStrings(query, 0, 0)
+	return toModelValue(result.Value), warnings, nil
+}
+
+// QueryRange evaluates a range query with the limits of the HTTP API.
+// Options are ignored.
+func (b *Backend) QueryRange(ctx context.Context, query string, r v1.Range, _ ...v1.Option) (model.Value, v1.Warnings, error) {
+	if r.End.Before(r.Start) {
+		return nil, nil, &v1.Error{Type: v1.ErrBadData, Msg: "end timestamp must not be before start time"}
+	}
+	if r.Step <= 0 {
+		return nil, nil, &v1.Error{Type: v1.ErrBadData, Msg: "zero or negative query resolution step widths are not accepted. Try a positive integer"}
+	}
+	if r.End.Sub(r.Start)/r.Step > maxPointsPerSeries {
+		return nil, nil, &v1.Error{Type: v1.ErrBadData, Msg: "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)"}
+	}
+
+	q, err := b.engine.NewRangeQuery(ctx, b.storage, nil, query, r.Start, r.End, r.Step)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer q.Close()
+	result := q.Exec(ctx)
+	if result.Err != nil {
+		return nil, nil, queryError(result.Err)
+	}
+	warnings, _ := result.Warnings.AsStrings(query, 0, 0)
+	return toModelValue(result.Value), warnings, nil
+}
+
+// LabelValues returns the values of label in the series matching any of the
+// selectors in matches, or in all series when there are none.
+func (b *Backend) LabelValues(ctx context.Context, label string, matches []string, startTime, endTime time.Time, _ ...v1.Option) (model.LabelValues, v1.Warnings, error) {
+	mint, maxt := int64(math.MinInt64), int64(math.MaxInt64)
+	if !startTime.IsZero() {
+		mint = startTime.UnixMilli()
+	}
+	if !endTime.IsZero() {
+		maxt = endTime.UnixMilli()
+	}
+
+	selectors := [][]*labels.Matcher{nil}
+	if len(matches) > 0 {
+		selectors = selectors[:0]
+		for _, match := range matches {
+			matchers, err := parser.ParseMetricSelector(match)
+			if err != nil {
+				return nil, nil, &v1.Error{Type: v1.ErrBadData, Msg: err.Error()}
+			}
+			selectors = append(selectors, matchers)
+		}
+	}
+
+	q, err := b.storage.Querier(mint, maxt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer q.Close()
+
+	var all []string
+	for _, matchers := range selectors {
+		values, _, err := q.LabelValues(ctx, label, nil, matchers...)
+		if err != nil {
+			return nil, nil, err
+		}
+		all = append(all, values...)
+	}
+	slices.Sort(all)
+	all = slices.Compact(all)
+
+	result := make(model.LabelValues, len(all))
+	for i, value := range all {
+		result[i] = model.LabelValue(value)
+	}
+	return result, nil, nil
+}
+
+// Metadata returns the metadata from the TYPE, HELP and UNIT lines of the
+// OpenMetrics fixtures.
+func (b *Backend) Metadata(_ context.Context, metric, limit string) (map[string][]v1.Metadata, error) {
+	n := math.MaxInt
+	if limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, &v1.Error{Type: v1.ErrBadData, Msg: fmt.Sprintf("invalid limit %q", limit)}
+		}
+		if parsed >= 0 {
+			n = parsed
+		}
+	}
+
+	names := make([]string, 0, len(b.metadata))
+	for name := range b.metadata {
+		if metric == "" || name == metric {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	result := map[string][]v1.Metadata{}
+	for _, name := range names[:min(n, len(names))] {
+		result[name] = b.metadata[name]
+	}
+	return result, nil
+}
+
+// TSDB returns head statistics computed over all loaded series. Options are
+// ignored, so every entry is returned.
+func (b *Backend) TSDB(_ context.Context, _ ...v1.Option) (v1.TSDBResult, error) {
+	byMetric := map[string]uint64{}
+	labelValues := map[string]map[string]bool{}
+	labelBytes := map[string]uint64{}
+	pairs := map[string]uint64{}
+	numPairs := 0
+	chunks := 0
+
+	for _, s := range b.storage.series {
+		byMetric[s.labels.Get(labels.MetricName)]++
+		s.labels.Range(func(l labels.Label) {
+			if labelValues[l.Name] == nil {
+				labelValues[l.Name] = map[string]bool{}
+			}
+			if !labelValues[l.Name][l.Value] {
+				labelValues[l.Name][l.Value] = true
+				labelBytes[l.Name] += uint64(len(l.Value))
+				numPairs++
+			}
+			pairs[l.Name+"="+l.Value]++
+		})
+		// The TSDB cuts a chunk every 120 samples
+		chunks += (len(s.samples) + 119) / 120
+	}
+
+	valueCounts := map[string]uint64{}
+	for name, values := range labelValues {
+		valueCounts[name] = uint64(len(values))
+	}
+
+	result := v1.TSDBResult{
+		HeadStats: v1.TSDBHeadStats{
+			NumSeries:     len(b.storage.series),
+			NumLabelPairs: numPairs,
+			ChunkCount:    chunks,
+		},
+		SeriesCountByMetricName:     sortedStats(byMetric),
+		LabelValueCountByLabelName:  sortedStats(valueCounts),
+		MemoryInBytesByLabelName:    sortedStats(labelBytes),
+		SeriesCountByLabelValuePair: sortedStats(pairs),
+	}
+	if b.mint <= b.maxt {
+		result.HeadStats.MinTime = int(b.mint)
+		result.HeadStats.MaxTime = int(b.maxt)
+	}
+	return result, nil
+}
+
+// sortedStats sorts the counts by decreasing value, like the TSDB status API.
+func sortedStats(counts map[string]uint64) []v1.Stat {
+	stats := make([]v1.Stat, 0, len(counts))
+	for name, value := range counts {
+		stats = append(stats, v1.Stat{Name: name, Value: value})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Value != stats[j].Value {
+			return stats[i].Value > stats[j].Value
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Rules returns the rules of the fixtures. Alerting rules are evaluated at
+// the end of the data, or now if earlier, with the pending and firing state
+// derived from how long their expression has returned each series.
+func (b *Backend) Rules(ctx context.Context) (v1.RulesResult, error) {
+	now := time.Now()
+	evalTime := now
+	if b.mint <= b.maxt && b.maxt < now.UnixMilli() {
+		evalTime = time.UnixMilli(b.maxt)
+	}
+
+	result := v1.RulesResult{Groups: []v1.RuleGroup{}}
+	for _, g := range b.groups {
+		interval := groupInterval(g)
+		group := v1.RuleGroup{
+			Name:     g.group.Name,
+			File:     g.file,
+			Interval: interval.Seconds(),
+			Rules:    v1.Rules{},
+		}
+		for _, rule := range g.group.Rules {
+			if rule.Record != "" {
+				group.Rules = append(group.Rules, v1.RecordingRule{
+					Name:           rule.Record,
+					Query:          rule.Expr,
+					Labels:         labelSet(rule.Labels),
+					Health:         v1.RuleHealthGood,
+					LastEvaluation: evalTime,
+				})
+				continue
+			}
+			group.Rules = append(group.Rules, b.alertingRule(ctx, rule, evalTime, interval))
+		}
+		result.Groups = append(result.Groups, group)
+	}
+	return result, nil
+}
+
+func (b *Backend) alertingRule(ctx context.Context, rule rulefmt.Rule, evalTime time.Time, interval time.Duration) v1.AlertingRule {
+	r := v1.AlertingRule{
+		Name:           rule.Alert,
+		Query:          rule.Expr,
+		Duration:       time.Duration(rule.For).Seconds(),
+		Labels:         labelSet(rule.Labels),
+		Annotations:    labelSet(rule.Annotations),
+		Alerts:         []*v1.Alert{},
+		Health:         v1.RuleHealthGood,
+		LastEvaluation: evalTime,
+		State:          string(v1.AlertStateInactive),
+	}
+
+	// Look back far enough to see when each alert became active
+	lookback := time.Duration(rule.For) + time.Hour
+	start := evalTime.Add(-lookback).Truncate(interval)
+	matrix, err := b.rangeQuery(ctx, rule.Expr, start, evalTime, interval)
+	if err != nil {
+		r.Health = v1.RuleHealthBad
+		r.LastError = err.Error()
+		return r
+	}
+
+	for _, stream := range matrix {
+		if len(stream.Floats) == 0 {
+			continue
+		}
+		last := stream.Floats[len(stream.Floats)-1]
+		// Only series returned by the last evaluation are active
+		if evalTime.UnixMilli()-last.T >= interval.Milliseconds() {
+			continue
+		}
+
+		// The alert became active after the last gap in the series
+		activeAt := stream.Floats[0].T
+		for i := len(stream.Floats) - 1; i > 0; i-- {
+			if stream.Floats[i].T-stream.Floats[i-1].T > interval.Milliseconds() {
+				activeAt = stream.Floats[i].T
+				break
+			}
+		}
+
+		state := v1.AlertStatePending
+		if evalTime.Sub(time.UnixMilli(activeAt)) >= time.Duration(rule.For) {
+			state = v1.AlertStateFiring
+		}
+
+		alertLabels := labelSet(stream.Metric.Map())
+		delete(alertLabels, model.MetricNameLabel)
+		for name, value := range rule.Labels {
+			alertLabels[model.LabelName(name)] = model.LabelValue(value)
+		}
+		alertLabels[model.AlertNameLabel] = model.LabelValue(rule.Alert)
+
+		r.Alerts = append(r.Alerts, &v1.Alert{
+			ActiveAt:    time.UnixMilli(activeAt).UTC(),
+			Annotations: labelSet(rule.Annotations),
+			Labels:      alertLabels,
+			State:       state,
+			Value:       strconv.FormatFloat(last.F, 'e', -1, 64),
+		})
+		if state == v1.AlertStateFiring || r.State == string(v1.AlertStateInactive) {
+			r.State = string(state)
+		}
+	}
+	return r
+}
+
+func labelSet(m map[string]string) model.LabelSet {
+	set := make(model.LabelSet, len(m))
+	for name, value := range m {
+		set[model.LabelName(name)] = model.LabelValue(value)
+	}
+	return set
+}
+
+func toModelValue(value parser.Value) model.Value {
+	switch v := value.(type) {
+	case promql.Matrix:
+		matrix := make(model.Matrix, len(v))
+		for i, stream := range v {
+			values := make([]model.SamplePair, len(stream.Floats))
+			for j, point := range stream.Floats {
+				values[j] = model.SamplePair{Timestamp: model.Time(point.T), Value: model.SampleValue(point.F)}
+			}
+			matrix[i] = &model.SampleStream{Metric: toModelMetric(stream.Metric), Values: values}
+		}
+		return matrix
+	case promql.Vector:
+		vector := make(model.Vector, len(v))
+		for i, s := range v {
+			vector[i] = &model.Sample{Metric: toModelMetric(s.Metric), Value: model.SampleValue(s.F), Timestamp: model.Time(s.T)}
+		}
+		return vector
+	case promql.Scalar:
+		return &model.Scalar{Value: model.SampleValue(v.V), Timestamp: model.Time(v.T)}
+	case promql.String:
+		return &model.String{Value: v.V, Timestamp: model.Time(v.T)}
+	}
+	return nil
+}
+
+func toModelMetric(lset labels.Labels) model.Metric {
+	metric := make(model.Metric, lset.Len())
+	lset.Range(func(l labels.Label) {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	})
+	return metric
+}
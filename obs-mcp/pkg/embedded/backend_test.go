@@ -0,0 +1,144 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func loadTestBackend(t *testing.T) *Backend {
+	t.Helper()
+	b, err := Load([]string{"testdata/tests.yaml"}, Options{Start: start})
+	if err != nil {
+		t.Fatalf("loading fixtures: %v", err)
+	}
+	return b
+}
+
+// valueAt evaluates query at ts, which must return a single sample.
+func valueAt(t *testing.T, b *Backend, query string, ts time.Time) float64 {
+	t.Helper()
+	value, _, err := b.Query(context.Background(), query, ts)
+	if err != nil {
+		t.Fatalf("query %s: %v", query, err)
+	}
+	vector, ok := value.(model.Vector)
+	if !ok || len(vector) != 1 {
+		t.Fatalf("expected a single sample for %s, got %v", query, value)
+	}
+	return float64(vector[0].Value)
+}
+
+func TestRecordingRules(t *testing.T) {
+	b := loadTestBackend(t)
+	end := start.Add(30 * time.Minute)
+
+	if v := valueAt(t, b, `job:requests:rate5m{job="api"}`, end); v != 1 {
+		t.Errorf("expected a rate of 1, got %g", v)
+	}
+	// Later rules see the series of earlier ones
+	if v := valueAt(t, b, `job:requests:rate5m_doubled`, end); v != 2 {
+		t.Errorf("expected the doubled rate to be 2, got %g", v)
+	}
+
+	// The recorded series cover the data range at the group interval
+	value, _, err := b.QueryRange(context.Background(), "job:requests:rate5m", v1.Range{Start: start, End: end, Step: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matrix := value.(model.Matrix); len(matrix) != 1 || len(matrix[0].Values) != 30 {
+		t.Errorf("expected a sample a minute after the first one, got %v", matrix)
+	}
+}
+
+func TestAlertingRules(t *testing.T) {
+	b := loadTestBackend(t)
+
+	rules, err := b.Rules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Groups) != 1 || len(rules.Groups[0].Rules) != 5 {
+		t.Fatalf("expected one group of five rules, got %+v", rules.Groups)
+	}
+
+	alerts := map[string]v1.AlertingRule{}
+	for _, rule := range rules.Groups[0].Rules {
+		switch r := rule.(type) {
+		case v1.AlertingRule:
+			alerts[r.Name] = r
+		case v1.RecordingRule:
+			if r.Health != v1.RuleHealthGood {
+				t.Errorf("unexpected health of %s: %s", r.Name, r.Health)
+			}
+		}
+	}
+
+	// The rules are evaluated at the end of the data
+	end := start.Add(30 * time.Minute)
+	tests := []struct {
+		alert    string
+		state    v1.AlertState
+		activeAt time.Time
+	}{
+		{alert: "Errors", state: v1.AlertStateFiring, activeAt: start.Add(11 * time.Minute)},
+		{alert: "ManyErrors", state: v1.AlertStatePending, activeAt: start.Add(27 * time.Minute)},
+		{alert: "NoRequests", state: v1.AlertStateInactive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alert, func(t *testing.T) {
+			r := alerts[tt.alert]
+			if r.State != string(tt.state) || !r.LastEvaluation.Equal(end) {
+				t.Fatalf("expected state %s at %s, got %s at %s", tt.state, end, r.State, r.LastEvaluation)
+			}
+			if tt.state == v1.AlertStateInactive {
+				if len(r.Alerts) != 0 {
+					t.Errorf("expected no alerts, got %+v", r.Alerts)
+				}
+				return
+			}
+			if len(r.Alerts) != 1 {
+				t.Fatalf("expected a single alert, got %+v", r.Alerts)
+			}
+			alert := r.Alerts[0]
+			if alert.State != tt.state || !alert.ActiveAt.Equal(tt.activeAt) {
+				t.Errorf("expected the alert %s since %s, got %s since %s", tt.state, tt.activeAt, alert.State, alert.ActiveAt)
+			}
+			if alert.Labels[model.AlertNameLabel] != model.LabelValue(tt.alert) || alert.Labels["job"] != "api" {
+				t.Errorf("unexpected labels %v", alert.Labels)
+			}
+		})
+	}
+	if errs := alerts["Errors"].Alerts; len(errs) != 1 || errs[0].Labels["severity"] != "warning" {
+		t.Errorf("expected the rule labels on the alert, got %+v", errs)
+	}
+}
+
+func TestQueryRangeLimits(t *testing.T) {
+	b := loadTestBackend(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		r    v1.Range
+	}{
+		{name: "end before start", r: v1.Range{Start: start, End: start.Add(-time.Minute), Step: time.Minute}},
+		{name: "zero step", r: v1.Range{Start: start, End: start.Add(time.Hour)}},
+		{name: "too many points", r: v1.Range{Start: start, End: start.Add(24 * time.Hour), Step: time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := b.QueryRange(ctx, "requests_total", tt.r)
+			var apiErr *v1.Error
+			if !errors.As(err, &apiErr) || apiErr.Type != v1.ErrBadData {
+				t.Errorf("expected a bad data error, got %v", err)
+			}
+		})
+	}
+}
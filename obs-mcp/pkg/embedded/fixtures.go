@@ -0,0 +1,223 @@
+package embedded
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.yaml.in/yaml/v2"
+)
+
+const defaultInterval = model.Duration(time.Minute)
+
+// fixtures is the content of the fixture files.
+type fixtures struct {
+	series   []*series
+	metadata map[string][]v1.Metadata
+	groups   []ruleGroup
+}
+
+type ruleGroup struct {
+	file  string
+	group rulefmt.RuleGroup
+}
+
+// promtoolTests is the part of a promtool rule unit test file used as a
+// fixture: its input series and rule files.
+type promtoolTests struct {
+	RuleFiles          []string       `yaml:"rule_files"`
+	EvaluationInterval model.Duration `yaml:"evaluation_interval"`
+	Tests              []struct {
+		Interval    model.Duration `yaml:"interval"`
+		InputSeries []struct {
+			Series string `yaml:"series"`
+			Values string `yaml:"values"`
+		} `yaml:"input_series"`
+	} `yaml:"tests"`
+}
+
+func loadFixtures(paths []string, start time.Time) (*fixtures, error) {
+	f := &fixtures{metadata: map[string][]v1.Metadata{}}
+	for _, path := range paths {
+		var err error
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			err = f.loadPromtool(path, start)
+		default:
+			err = f.loadOpenMetrics(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error loading fixture %s: %w", path, err)
+		}
+	}
+	return f, nil
+}
+
+// loadPromtool loads the input series of a promtool test file. promtool
+// starts the series at the Unix epoch; here they start at start, or end now
+// when start is zero.
+func (f *fixtures) loadPromtool(path string, start time.Time) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var tests promtoolTests
+	if err := yaml.UnmarshalStrict(content, &tests); err != nil {
+		// Unit test files have more fields, e.g. the expected alerts
+		if err := yaml.Unmarshal(content, &tests); err != nil {
+			return err
+		}
+	}
+
+	for _, test := range tests.Tests {
+		interval := test.Interval
+		if interval == 0 {
+			interval = tests.EvaluationInterval
+		}
+		if interval == 0 {
+			interval = defaultInterval
+		}
+		step := time.Duration(interval)
+
+		var loaded []*series
+		maxLen := 0
+		for _, input := range test.InputSeries {
+			lset, values, err := parser.ParseSeriesDesc(input.Series + " " + input.Values)
+			if err != nil {
+				return fmt.Errorf("invalid input series %s: %w", input.Series, err)
+			}
+			s := &series{labels: lset}
+			for i, value := range values {
+				if value.Omitted {
+					continue
+				}
+				if value.Histogram != nil {
+					return fmt.Errorf("input series %s: native histograms are not supported", input.Series)
+				}
+				s.samples = append(s.samples, sample{t: int64(i) * step.Milliseconds(), f: value.Value})
+			}
+			loaded = append(loaded, s)
+			maxLen = max(maxLen, len(values))
+		}
+
+		offset := start
+		if offset.IsZero() {
+			offset = time.Now().Truncate(step).Add(-time.Duration(max(maxLen-1, 0)) * step)
+		}
+		for _, s := range loaded {
+			for i := range s.samples {
+				s.samples[i].t += offset.UnixMilli()
+			}
+		}
+		f.series = append(f.series, loaded...)
+	}
+
+	for _, file := range tests.RuleFiles {
+		if err := f.loadRules(filepath.Join(filepath.Dir(path), file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fixtures) loadRules(path string) error {
+	groups, errs := rulefmt.ParseFile(path, false, model.UTF8Validation)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, group := range groups.Groups {
+		f.groups = append(f.groups, ruleGroup{file: path, group: group})
+	}
+	return nil
+}
+
+// loadOpenMetrics loads a file in the OpenMetrics text format. Samples
+// without a timestamp are taken at the time of loading.
+func (f *fixtures) loadOpenMetrics(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(bytes.TrimSpace(content), []byte("# EOF")) {
+		content = append(bytes.TrimRight(content, "\n"), []byte("\n# EOF\n")...)
+	}
+
+	p, err := textparse.New(content, "application/openmetrics-text", labels.NewSymbolTable(), textparse.ParserOptions{})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	byLabels := map[string]*series{}
+	metadata := map[string]*v1.Metadata{}
+	meta := func(name []byte) *v1.Metadata {
+		m, ok := metadata[string(name)]
+		if !ok {
+			m = &v1.Metadata{Type: v1.MetricTypeUnknown}
+			metadata[string(name)] = m
+		}
+		return m
+	}
+
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch entry {
+		case textparse.EntryType:
+			name, typ := p.Type()
+			meta(name).Type = v1.MetricType(typ)
+		case textparse.EntryHelp:
+			name, help := p.Help()
+			meta(name).Help = string(help)
+		case textparse.EntryUnit:
+			name, unit := p.Unit()
+			meta(name).Unit = string(unit)
+		case textparse.EntrySeries:
+			_, ts, value := p.Series()
+			var lset labels.Labels
+			p.Labels(&lset)
+
+			t := now
+			if ts != nil {
+				t = *ts
+			}
+			if math.IsNaN(value) && lset.IsEmpty() {
+				continue
+			}
+
+			key := lset.String()
+			s, ok := byLabels[key]
+			if !ok {
+				s = &series{labels: lset}
+				byLabels[key] = s
+				f.series = append(f.series, s)
+			}
+			s.samples = append(s.samples, sample{t: t, f: value})
+		case textparse.EntryHistogram:
+			return fmt.Errorf("native histograms are not supported")
+		}
+	}
+
+	for name, m := range metadata {
+		f.metadata[name] = append(f.metadata[name], *m)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package embedded
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func TestPromtoolTimeShift(t *testing.T) {
+	// With a start time, the first sample is at that time
+	f, err := loadFixtures([]string{"testdata/tests.yaml"}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := findSeries(t, f, "requests_total")
+	if first := requests.samples[0].t; first != start.UnixMilli() {
+		t.Errorf("expected the first sample at %s, got %s", start, time.UnixMilli(first))
+	}
+
+	// Omitted values leave a gap
+	temperature := findSeries(t, f, "temperature")
+	if len(temperature.samples) != 2 || temperature.samples[1].t-temperature.samples[0].t != (29*time.Minute).Milliseconds() {
+		t.Errorf("expected two samples 29m apart, got %+v", temperature.samples)
+	}
+
+	// Without a start time, the longest series ends now
+	before := time.Now().Truncate(time.Minute)
+	f, err = loadFixtures([]string{"testdata/tests.yaml"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests = findSeries(t, f, "requests_total")
+	last := time.UnixMilli(requests.samples[len(requests.samples)-1].t)
+	if last.Before(before) || last.After(time.Now()) {
+		t.Errorf("expected the last sample now, got %s", last)
+	}
+	if first := time.UnixMilli(requests.samples[0].t); last.Sub(first) != 30*time.Minute {
+		t.Errorf("expected 30m of samples, got %s to %s", first, last)
+	}
+}
+
+func TestOpenMetrics(t *testing.T) {
+	before := time.Now().UnixMilli()
+	f, err := loadFixtures([]string{"testdata/metrics.om"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The samples of a series repeated in the file are merged
+	if len(f.series) != 3 {
+		t.Fatalf("expected three series, got %d", len(f.series))
+	}
+	a := f.series[0]
+	if a.labels.Get("instance") != "a" || len(a.samples) != 2 || a.samples[0].f != 1.5e9 || a.samples[1].t != 1700000060000 {
+		t.Errorf("expected the two samples of instance a, got %s %+v", a.labels, a.samples)
+	}
+
+	// Samples without a timestamp are taken at load time
+	info := findSeries(t, f, "build_info")
+	if len(info.samples) != 1 || info.samples[0].t < before || info.samples[0].t > time.Now().UnixMilli() {
+		t.Errorf("expected a sample at load time, got %+v", info.samples)
+	}
+
+	want := v1.Metadata{Type: v1.MetricTypeGauge, Help: "Available memory.", Unit: "bytes"}
+	if m := f.metadata["node_memory_available_bytes"]; len(m) != 1 || m[0] != want {
+		t.Errorf("expected %+v, got %+v", want, m)
+	}
+
+	b, err := Load([]string{"testdata/metrics.om"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := b.Metadata(context.Background(), "", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 || metadata["build_info"] == nil {
+		t.Errorf("expected the metadata of the first metric, got %v", metadata)
+	}
+}
+
+func findSeries(t *testing.T, f *fixtures, name string) *series {
+	t.Helper()
+	for _, s := range f.series {
+		if s.labels.Get(labels.MetricName) == name {
+			return s
+		}
+	}
+	t.Fatalf("series %s not loaded", name)
+	return nil
+}
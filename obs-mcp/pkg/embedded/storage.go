@@ -0,0 +1,171 @@
+package embedded
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/util/annotations"
+)
+
+// sample is a float sample of a fixture series.
+type sample struct {
+	t int64
+	f float64
+}
+
+func (s sample) T() int64                      { return s.t }
+func (s sample) F() float64                    { return s.f }
+func (s sample) H() *histogram.Histogram       { return nil }
+func (s sample) FH() *histogram.FloatHistogram { return nil }
+func (s sample) Type() chunkenc.ValueType      { return chunkenc.ValFloat }
+func (s sample) Copy() chunks.Sample           { return s }
+
+type samples []sample
+
+func (s samples) Get(i int) chunks.Sample { return s[i] }
+func (s samples) Len() int                { return len(s) }
+
+type series struct {
+	labels  labels.Labels
+	samples samples
+}
+
+// overlaps reports whether the series has samples between mint and maxt, in
+// milliseconds.
+func (s *series) overlaps(mint, maxt int64) bool {
+	return len(s.samples) > 0 && s.samples[0].t <= maxt && s.samples[len(s.samples)-1].t >= mint
+}
+
+// memStorage is a read-only storage.Queryable over series held in memory,
+// sorted by labels.
+type memStorage struct {
+	series []*series
+}
+
+// newMemStorage merges the samples of series with equal labels and sorts
+// everything.
+func newMemStorage(all []*series) *memStorage {
+	byLabels := map[string]*series{}
+	var merged []*series
+	for _, s := range all {
+		key := s.labels.String()
+		if existing, ok := byLabels[key]; ok {
+			existing.samples = append(existing.samples, s.samples...)
+			continue
+		}
+		byLabels[key] = s
+		merged = append(merged, s)
+	}
+
+	for _, s := range merged {
+		sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].t < s.samples[j].t })
+		// Later samples win over earlier ones with the same timestamp
+		deduplicated := s.samples[:0]
+		for _, smpl := range s.samples {
+			if n := len(deduplicated); n > 0 && deduplicated[n-1].t == smpl.t {
+				deduplicated[n-1] = smpl
+				continue
+			}
+			deduplicated = append(deduplicated, smpl)
+		}
+		s.samples = deduplicated
+	}
+	sort.Slice(merged, func(i, j int) bool { return labels.Compare(merged[i].labels, merged[j].labels) < 0 })
+	return &memStorage{series: merged}
+}
+
+func (m *memStorage) Querier(mint, maxt int64) (storage.Querier, error) {
+	return &memQuerier{storage: m, mint: mint, maxt: maxt}, nil
+}
+
+// selectSeries returns the series matching all matchers with samples between
+// mint and maxt.
+func (m *memStorage) selectSeries(mint, maxt int64, matchers ...*labels.Matcher) []*series {
+	var result []*series
+	for _, s := range m.series {
+		if s.overlaps(mint, maxt) && matchesAll(s.labels, matchers) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func matchesAll(lset labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+type memQuerier struct {
+	storage    *memStorage
+	mint, maxt int64
+}
+
+func (q *memQuerier) Select(_ context.Context, _ bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		mint, maxt = hints.Start, hints.End
+	}
+
+	// The series are already sorted
+	selected := q.storage.selectSeries(mint, maxt, matchers...)
+	entries := make([]storage.Series, len(selected))
+	for i, s := range selected {
+		entries[i] = &storage.SeriesEntry{
+			Lset: s.labels,
+			SampleIteratorFn: func(chunkenc.Iterator) chunkenc.Iterator {
+				return storage.NewListSeriesIterator(s.samples)
+			},
+		}
+	}
+	return &seriesSet{series: entries, index: -1}
+}
+
+func (q *memQuerier) LabelValues(_ context.Context, name string, _ *storage.LabelHints, matchers ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	var values []string
+	for _, s := range q.storage.selectSeries(q.mint, q.maxt, matchers...) {
+		if value := s.labels.Get(name); value != "" {
+			values = append(values, value)
+		}
+	}
+	slices.Sort(values)
+	return slices.Compact(values), nil, nil
+}
+
+func (q *memQuerier) LabelNames(_ context.Context, _ *storage.LabelHints, matchers ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	var names []string
+	for _, s := range q.storage.selectSeries(q.mint, q.maxt, matchers...) {
+		s.labels.Range(func(l labels.Label) {
+			names = append(names, l.Name)
+		})
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil, nil
+}
+
+func (q *memQuerier) Close() error {
+	return nil
+}
+
+type seriesSet struct {
+	series []storage.Series
+	index  int
+}
+
+func (s *seriesSet) Next() bool {
+	s.index++
+	return s.index < len(s.series)
+}
+
+func (s *seriesSet) At() storage.Series                { return s.series[s.index] }
+func (s *seriesSet) Err() error                        { return nil }
+func (s *seriesSet) Warnings() annotations.Annotations { return nil }
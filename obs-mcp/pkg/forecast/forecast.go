@@ -0,0 +1,306 @@
+// Package forecast fits trends to time series and projects when they cross a
+// threshold, with prediction intervals, in pure Go.
+package forecast
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Models a series can be fitted with.
+const (
+	// ModelLinear is a least squares line.
+	ModelLinear = "linear"
+	// ModelSeasonal is a least squares line plus the average deviation from
+	// it at each phase of a season, such as the time of the day.
+	ModelSeasonal = "seasonal"
+)
+
+var Models = []string{ModelLinear, ModelSeasonal}
+
+const (
+	// minPoints is the number of samples needed for a fit.
+	minPoints = 3
+	// maxSeasonBuckets caps the phases a season is divided into.
+	maxSeasonBuckets = 1440
+	// seasonIterations is the number of times the line and the season are
+	// fitted in turn.
+	seasonIterations = 10
+)
+
+// Point is a single sample of a series.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Options configure Fit.
+type Options struct {
+	// Model is one of Models.
+	Model string
+	// Season is the period of the seasonal model, e.g. a day.
+	Season time.Duration
+	// Confidence is the probability the prediction intervals cover, e.g.
+	// 0.95.
+	Confidence float64
+}
+
+// Model is a trend fitted to a series.
+type Model struct {
+	kind   string
+	origin time.Time
+	// slope and intercept of the line, in seconds since origin.
+	slope, intercept float64
+	// season holds the mean deviation from the line in each bucket of the
+	// season.
+	season       []float64
+	seasonPeriod time.Duration
+	bucketWidth  time.Duration
+
+	// residual is the standard deviation of the residuals.
+	residual float64
+	n        int
+	meanX    float64
+	sxx      float64
+	// z is the number of standard deviations of the prediction interval.
+	z  float64
+	r2 float64
+}
+
+// Fit fits a model to points, which must be in time order. NaN and infinite
+// samples are ignored.
+func Fit(points []Point, opts Options) (*Model, error) {
+	points = slices.DeleteFunc(slices.Clone(points), func(p Point) bool {
+		return math.IsNaN(p.Value) || math.IsInf(p.Value, 0)
+	})
+	if len(points) < minPoints {
+		return nil, fmt.Errorf("at least %d samples are needed, got %d", minPoints, len(points))
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		return nil, fmt.Errorf("confidence must be between 0 and 1")
+	}
+
+	m := &Model{
+		kind:   opts.Model,
+		origin: points[0].Time,
+		n:      len(points),
+		z:      math.Sqrt2 * math.Erfinv(opts.Confidence),
+	}
+
+	xs := make([]float64, len(points))
+	var sumX, sumY float64
+	for i, p := range points {
+		xs[i] = p.Time.Sub(m.origin).Seconds()
+		sumX += xs[i]
+		sumY += p.Value
+	}
+	m.meanX = sumX / float64(m.n)
+	meanY := sumY / float64(m.n)
+
+	var syy float64
+	for i, p := range points {
+		dx, dy := xs[i]-m.meanX, p.Value-meanY
+		m.sxx += dx * dx
+		syy += dy * dy
+	}
+	if m.sxx == 0 {
+		return nil, fmt.Errorf("the samples must span some time")
+	}
+
+	// seasonal holds the seasonal component of each sample
+	seasonal := make([]float64, len(points))
+	params := 2
+	switch opts.Model {
+	case ModelLinear:
+		m.fitLine(points, xs, seasonal)
+	case ModelSeasonal:
+		if err := m.initSeason(points, opts.Season); err != nil {
+			return nil, err
+		}
+		params += len(m.season)
+		// Backfitting: the line and the season are fitted in turn, since
+		// over a finite range the season correlates with time and would
+		// bias a line fitted on its own
+		for range seasonIterations {
+			m.fitLine(points, xs, seasonal)
+			m.fitSeason(points, xs)
+			for i, p := range points {
+				seasonal[i] = m.season[m.bucket(p.Time)]
+			}
+		}
+		m.fitLine(points, xs, seasonal)
+	default:
+		return nil, fmt.Errorf("unknown model %q, expected one of %s", opts.Model, strings.Join(Models, ", "))
+	}
+
+	var sse float64
+	for i, p := range points {
+		r := p.Value - (m.intercept + m.slope*xs[i] + seasonal[i])
+		sse += r * r
+	}
+	m.residual = math.Sqrt(sse / float64(max(m.n-params, 1)))
+	m.r2 = 1
+	if syy > 0 {
+		m.r2 = 1 - sse/syy
+	}
+	return m, nil
+}
+
+// fitLine fits the line by least squares to the samples without their
+// seasonal component.
+func (m *Model) fitLine(points []Point, xs, seasonal []float64) {
+	var sumY float64
+	for i, p := range points {
+		sumY += p.Value - seasonal[i]
+	}
+	meanY := sumY / float64(m.n)
+
+	var sxy float64
+	for i, p := range points {
+		sxy += (xs[i] - m.meanX) * (p.Value - seasonal[i] - meanY)
+	}
+	m.slope = sxy / m.sxx
+	m.intercept = meanY - m.slope*m.meanX
+}
+
+// initSeason divides the season into buckets as wide as the median sample
+// interval.
+func (m *Model) initSeason(points []Point, season time.Duration) error {
+	span := points[len(points)-1].Time.Sub(points[0].Time)
+	if season <= 0 || span < 2*season {
+		return fmt.Errorf("the seasonal model needs at least two seasons of samples, got %s for a season of %s", span, season)
+	}
+
+	intervals := make([]time.Duration, len(points)-1)
+	for i := range intervals {
+		intervals[i] = points[i+1].Time.Sub(points[i].Time)
+	}
+	slices.Sort(intervals)
+	m.bucketWidth = max(intervals[len(intervals)/2], season/maxSeasonBuckets, time.Second)
+	m.seasonPeriod = season
+	m.season = make([]float64, (season+m.bucketWidth-1)/m.bucketWidth)
+	return nil
+}
+
+// fitSeason sets each bucket of the season to the mean deviation of its
+// samples from the line, centered so that the season averages to zero.
+func (m *Model) fitSeason(points []Point, xs []float64) {
+	sums := make([]float64, len(m.season))
+	counts := make([]int, len(m.season))
+	for i, p := range points {
+		b := m.bucket(p.Time)
+		sums[b] += p.Value - (m.intercept + m.slope*xs[i])
+		counts[b]++
+	}
+
+	var total float64
+	for b := range m.season {
+		m.season[b] = 0
+		if counts[b] > 0 {
+			m.season[b] = sums[b] / float64(counts[b])
+		}
+		total += m.season[b] * float64(counts[b])
+	}
+	mean := total / float64(m.n)
+	for b := range m.season {
+		if counts[b] > 0 {
+			m.season[b] -= mean
+		}
+	}
+}
+
+func (m *Model) bucket(t time.Time) int {
+	phase := t.Sub(m.origin) % m.seasonPeriod
+	if phase < 0 {
+		phase += m.seasonPeriod
+	}
+	return min(int(phase/m.bucketWidth), len(m.season)-1)
+}
+
+// Predict returns the expected value at t and the bounds of its prediction
+// interval.
+func (m *Model) Predict(t time.Time) (value, lower, upper float64) {
+	x := t.Sub(m.origin).Seconds()
+	value = m.intercept + m.slope*x
+	if m.kind == ModelSeasonal {
+		value += m.season[m.bucket(t)]
+	}
+
+	dx := x - m.meanX
+	margin := m.z * m.residual * math.Sqrt(1+1/float64(m.n)+dx*dx/m.sxx)
+	return value, value - margin, value + margin
+}
+
+// SlopePerSecond returns the slope of the trend line.
+func (m *Model) SlopePerSecond() float64 {
+	return m.slope
+}
+
+// R2 returns the coefficient of determination of the fit: 1 when the model
+// explains all of the variance of the samples.
+func (m *Model) R2() float64 {
+	return m.r2
+}
+
+// ResidualStdDev returns the standard deviation of the differences between
+// the samples and the model.
+func (m *Model) ResidualStdDev() float64 {
+	return m.residual
+}
+
+// Crossing is when a forecast crosses a threshold. Nil times mean that it
+// does not cross it before the end of the horizon.
+type Crossing struct {
+	// Rising reports whether the series crosses the threshold upwards.
+	Rising bool
+	// At is when the expected value crosses the threshold.
+	At *time.Time
+	// Earliest and Latest are when the bounds of the prediction interval
+	// cross it.
+	Earliest *time.Time
+	Latest   *time.Time
+}
+
+// Crossing scans the forecast from from until until in steps for the first
+// time the expected value and the bounds of the prediction interval reach
+// threshold, from the side of the current value. Nothing is scanned when step
+// is not positive.
+func (m *Model) Crossing(current, threshold float64, from, until time.Time, step time.Duration) Crossing {
+	c := Crossing{Rising: current < threshold}
+	if step <= 0 {
+		return c
+	}
+	reached := func(v float64) bool {
+		if c.Rising {
+			return v >= threshold
+		}
+		return v <= threshold
+	}
+
+	for t := from; !t.After(until); t = t.Add(step) {
+		value, lower, upper := m.Predict(t)
+		// The bound closer to the threshold crosses first
+		first, last := upper, lower
+		if !c.Rising {
+			first, last = lower, upper
+		}
+		if c.Earliest == nil && reached(first) {
+			c.Earliest = timePtr(t)
+		}
+		if c.At == nil && reached(value) {
+			c.At = timePtr(t)
+		}
+		if c.Latest == nil && reached(last) {
+			c.Latest = timePtr(t)
+			break
+		}
+	}
+	return c
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,92 @@
+package forecast
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var origin = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// series returns a sample every step for span of f, the value at a time
+// since origin.
+func series(span, step time.Duration, f func(time.Duration) float64) []Point {
+	var points []Point
+	for d := time.Duration(0); d <= span; d += step {
+		points = append(points, Point{Time: origin.Add(d), Value: f(d)})
+	}
+	return points
+}
+
+func TestLinear(t *testing.T) {
+	// A volume filling by 1% an hour, with noise
+	rng := rand.New(rand.NewSource(1))
+	points := series(48*time.Hour, 5*time.Minute, func(d time.Duration) float64 {
+		return 0.4 + 0.01*d.Hours() + rng.NormFloat64()*0.005
+	})
+	end := points[len(points)-1].Time
+
+	m, err := Fit(points, Options{Model: ModelLinear, Confidence: 0.95})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perHour := m.SlopePerSecond() * 3600; math.Abs(perHour-0.01) > 0.0005 {
+		t.Errorf("expected a slope of 0.01 per hour, got %g", perHour)
+	}
+	if m.R2() < 0.95 {
+		t.Errorf("expected a good fit, got R2 %g", m.R2())
+	}
+
+	// 0.88 now, 0.9 in 2 hours
+	c := m.Crossing(points[len(points)-1].Value, 0.9, end, end.Add(24*time.Hour), time.Minute)
+	if !c.Rising || c.At == nil || c.Earliest == nil || c.Latest == nil {
+		t.Fatalf("expected a rising crossing with bounds, got %+v", c)
+	}
+	if in := c.At.Sub(end); in < 90*time.Minute || in > 150*time.Minute {
+		t.Errorf("expected the crossing in about 2h, got %s", in)
+	}
+	if !c.Earliest.Before(*c.At) || !c.Latest.After(*c.At) {
+		t.Errorf("expected the crossing between %s and %s, got %s", c.Earliest, c.Latest, c.At)
+	}
+
+	c = m.Crossing(points[len(points)-1].Value, 2, end, end.Add(24*time.Hour), time.Minute)
+	if c.At != nil {
+		t.Errorf("expected no crossing within the horizon, got %s", c.At)
+	}
+
+	c = m.Crossing(points[len(points)-1].Value, 0.9, end, end.Add(24*time.Hour), 0)
+	if c.At != nil || c.Earliest != nil || c.Latest != nil {
+		t.Errorf("expected no scan without a step, got %+v", c)
+	}
+}
+
+func TestSeasonal(t *testing.T) {
+	// Memory usage growing slowly with a daily peak
+	points := series(7*24*time.Hour, 10*time.Minute, func(d time.Duration) float64 {
+		return 50 + 0.1*d.Hours() + 10*math.Sin(2*math.Pi*d.Hours()/24)
+	})
+
+	linear, err := Fit(points, Options{Model: ModelLinear, Confidence: 0.95})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seasonal, err := Fit(points, Options{Model: ModelSeasonal, Season: 24 * time.Hour, Confidence: 0.95})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seasonal.ResidualStdDev() >= linear.ResidualStdDev()/5 {
+		t.Errorf("expected the seasonal model to fit much better, got residuals %g and %g",
+			seasonal.ResidualStdDev(), linear.ResidualStdDev())
+	}
+
+	// The peak of the 8th day: 50 + 0.1*174 + 10
+	value, lower, upper := seasonal.Predict(origin.Add(7*24*time.Hour + 6*time.Hour))
+	if math.Abs(value-77.4) > 1 || lower > value || upper < value {
+		t.Errorf("expected about 77.4 at the next peak, got %g [%g, %g]", value, lower, upper)
+	}
+
+	if _, err := Fit(points[:100], Options{Model: ModelSeasonal, Season: 24 * time.Hour, Confidence: 0.95}); err == nil {
+		t.Error("expected the seasonal model to require two seasons")
+	}
+}
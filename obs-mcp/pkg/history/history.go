@@ -0,0 +1,127 @@
+// Package history keeps the queries run in each MCP session, so that
+// follow-up questions can re-run them with another range or filter.
+package history
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/prometheus"
+)
+
+// sessionIdleTimeout is how long the history of a session that was neither
+// used nor closed is kept.
+const sessionIdleTimeout = 24 * time.Hour
+
+// Entry is a query run by a tool.
+type Entry struct {
+	// Index identifies the entry within its session, starting at 1.
+	Index int    `json:"index"`
+	Tool  string `json:"tool"`
+	// Datasource is empty for the default datasource.
+	Datasource string    `json:"datasource,omitempty"`
+	Query      string    `json:"query"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Step       string    `json:"step"`
+	// Options are the Thanos query options the query was run with, with
+	// the max source resolution as requested rather than resolved.
+	Options    prometheus.QueryOptions `json:"options"`
+	ExecutedAt time.Time               `json:"executedAt"`
+	// Series is the number of series the query returned.
+	Series int `json:"series"`
+}
+
+type session struct {
+	entries  []Entry
+	next     int
+	lastUsed time.Time
+}
+
+// Store holds the most recent entries of every session.
+type Store struct {
+	maxEntries int
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewStore keeps up to maxEntries entries per session.
+func NewStore(maxEntries int) *Store {
+	return &Store{maxEntries: maxEntries, sessions: map[string]*session{}}
+}
+
+// Add appends entry to the history of a session and returns it with its
+// index set. The oldest entries are dropped once the history is full.
+func (s *Store) Add(sessionID string, entry Entry) Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		sess = &session{next: 1}
+		s.sessions[sessionID] = sess
+	}
+	sess.lastUsed = now
+
+	entry.Index = sess.next
+	sess.next++
+	sess.entries = append(sess.entries, entry)
+	if len(sess.entries) > s.maxEntries {
+		sess.entries = sess.entries[len(sess.entries)-s.maxEntries:]
+	}
+	return entry
+}
+
+// Get returns the entry with index in a session. Negative indexes count back
+// from the latest entry, which is -1.
+func (s *Store) Get(sessionID string, index int) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok || len(sess.entries) == 0 {
+		return Entry{}, fmt.Errorf("no queries have been run in this session yet")
+	}
+	sess.lastUsed = time.Now()
+
+	if index < 0 {
+		index = sess.next + index
+	}
+	first := sess.entries[0].Index
+	if index < first || index >= sess.next {
+		return Entry{}, fmt.Errorf("no query with index %d in the history, available indexes are %d to %d", index, first, sess.next-1)
+	}
+	return sess.entries[index-first], nil
+}
+
+// List returns the entries of a session, oldest first.
+func (s *Store) List(sessionID string) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return []Entry{}
+	}
+	return append([]Entry{}, sess.entries...)
+}
+
+// Remove forgets the history of a closed session.
+func (s *Store) Remove(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+}
+
+func (s *Store) prune(now time.Time) {
+	for id, sess := range s.sessions {
+		if now.Sub(sess.lastUsed) > sessionIdleTimeout {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package history
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	store := NewStore(3)
+	for _, query := range []string{"a", "b", "c", "d", "e"} {
+		store.Add("s1", Entry{Query: query})
+	}
+	store.Add("s2", Entry{Query: "other"})
+
+	// Only the latest entries are kept, with their original indexes
+	entries := store.List("s1")
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Query)
+	}
+	if strings.Join(got, ",") != "c,d,e" || entries[0].Index != 3 || entries[2].Index != 5 {
+		t.Fatalf("expected entries 3 to 5 (c, d, e), got %+v", entries)
+	}
+
+	tests := []struct {
+		index int
+		query string
+		err   string
+	}{
+		{index: 3, query: "c"},
+		{index: 5, query: "e"},
+		{index: -1, query: "e"},
+		{index: -3, query: "c"},
+		{index: 2, err: "available indexes are 3 to 5"},
+		{index: 6, err: "no query with index 6"},
+		{index: -4, err: "no query with index 2"},
+	}
+	for _, tt := range tests {
+		entry, err := store.Get("s1", tt.index)
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Get(%d): expected an error containing %q, got %+v, %v", tt.index, tt.err, entry, err)
+			}
+		case err != nil:
+			t.Errorf("Get(%d): unexpected error: %v", tt.index, err)
+		case entry.Query != tt.query:
+			t.Errorf("Get(%d) = %q, want %q", tt.index, entry.Query, tt.query)
+		}
+	}
+
+	// Sessions are numbered independently
+	if entry, err := store.Get("s2", 1); err != nil || entry.Query != "other" {
+		t.Errorf("expected the first entry of s2, got %+v, %v", entry, err)
+	}
+
+	// Indexes keep counting after eviction
+	if entry := store.Add("s1", Entry{Query: "f"}); entry.Index != 6 {
+		t.Errorf("expected index 6, got %d", entry.Index)
+	}
+
+	store.Remove("s1")
+	if entries := store.List("s1"); len(entries) != 0 {
+		t.Errorf("expected no entries after removal, got %+v", entries)
+	}
+	if _, err := store.Get("s1", -1); err == nil || !strings.Contains(err.Error(), "no queries have been run") {
+		t.Errorf("expected an empty history after removal, got %v", err)
+	}
+	if entries := store.List("s2"); len(entries) != 1 {
+		t.Errorf("expected the other session to be kept, got %+v", entries)
+	}
+	// A removed session starts over
+	if entry := store.Add("s1", Entry{Query: "g"}); entry.Index != 1 {
+		t.Errorf("expected a new history to start at 1, got %d", entry.Index)
+	}
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/inecas/obs-mcp/pkg/auth"
+)
+
+const authRealm = "obs-mcp"
+
+// authMiddleware requires a bearer token accepted by authenticator and
+// attaches the authenticated identity to the request context.
+func authMiddleware(authenticator auth.Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		token = strings.TrimSpace(token)
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			// RFC 6750: no error code when the request lacks credentials
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+			http.Error(w, "Unauthorized: a bearer token is required", http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := authenticator.AuthenticateToken(r.Context(), token)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`", error="invalid_token", error_description="the bearer token is invalid or expired"`)
+			http.Error(w, "Unauthorized: invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to authenticate request", "remote_addr", r.RemoteAddr, "error", err)
+			http.Error(w, "Authentication is temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	})
+}
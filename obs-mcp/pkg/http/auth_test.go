@@ -0,0 +1,98 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/inecas/obs-mcp/pkg/auth"
+)
+
+// fakeAuthenticator accepts the token "valid" and fails to check "unavailable".
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) AuthenticateToken(_ context.Context, token string) (*auth.Identity, error) {
+	switch token {
+	case "valid":
+		return &auth.Identity{Username: "alice", Method: "fake"}, nil
+	case "unavailable":
+		return nil, errors.New("connection refused")
+	}
+	return nil, auth.ErrInvalidToken
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	handler := authMiddleware(fakeAuthenticator{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := auth.IdentityFrom(r.Context())
+		if !ok {
+			t.Error("no identity in the request context")
+			return
+		}
+		_, _ = w.Write([]byte(identity.Username))
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		// wantChallenge is a fragment of the WWW-Authenticate header
+		wantChallenge string
+		wantBody      string
+	}{
+		{
+			name:          "missing token",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="obs-mcp"`,
+		},
+		{
+			name:          "other scheme",
+			authorization: "Basic YWxpY2U6c2VjcmV0",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="obs-mcp"`,
+		},
+		{
+			name:          "bad token",
+			authorization: "Bearer wrong",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `error="invalid_token"`,
+		},
+		{
+			name:          "authenticator unavailable",
+			authorization: "Bearer unavailable",
+			wantStatus:    http.StatusServiceUnavailable,
+		},
+		{
+			name:          "valid token",
+			authorization: "bearer valid",
+			wantStatus:    http.StatusOK,
+			wantBody:      "alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if tt.wantChallenge == "" && challenge != "" {
+				t.Errorf("unexpected challenge %q", challenge)
+			}
+			if !strings.Contains(challenge, tt.wantChallenge) {
+				t.Errorf("expected a challenge containing %q, got %q", tt.wantChallenge, challenge)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -3,35 +3,56 @@ package http
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/inecas/obs-mcp/pkg/auth"
+	"github.com/inecas/obs-mcp/pkg/logging"
+	"github.com/inecas/obs-mcp/pkg/ratelimit"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
-	mcpEndpoint    = "/mcp"
-	healthEndpoint = "/health"
+	mcpEndpoint     = "/mcp"
+	healthEndpoint  = "/health"
+	metricsEndpoint = "/metrics"
 )
 
-// loggingMiddleware logs incoming HTTP requests with debug information
+// loggingMiddleware logs incoming HTTP requests with debug information,
+// redacting the headers which carry credentials
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[DEBUG] Incoming request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		log.Printf("[DEBUG] Request headers: %v", r.Header)
-		if r.ContentLength > 0 {
-			log.Printf("[DEBUG] Content-Length: %d", r.ContentLength)
-		}
+		slog.Debug("Incoming request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
+			"content_length", r.ContentLength,
+			logging.Headers("headers", r.Header),
+		)
 		next.ServeHTTP(w, r)
 	})
 }
 
-// Serve starts an HTTP server with the MCP server mounted
-func Serve(ctx context.Context, mcpServer *server.MCPServer, listenAddr string) error {
+// clientAddressContext identifies unauthenticated clients by their address
+// for rate limiting.
+func clientAddressContext(ctx context.Context, r *http.Request) context.Context {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return ratelimit.WithClientAddress(ctx, host)
+}
+
+// Serve starts an HTTP server with the MCP server mounted. When authenticator
+// is not nil, the MCP endpoints require a bearer token it accepts. Unless
+// stateful, the server keeps no sessions between requests.
+func Serve(ctx context.Context, mcpServer *server.MCPServer, listenAddr string, authenticator auth.Authenticator, stateful bool) error {
 	mux := http.NewServeMux()
 
 	// Create streamable HTTP server from MCP server with logging middleware
@@ -43,12 +64,19 @@ func Serve(ctx context.Context, mcpServer *server.MCPServer, listenAddr string)
 	// Mount the MCP server on the /mcp endpoint
 	streamableHTTPServer := server.NewStreamableHTTPServer(mcpServer,
 		server.WithStreamableHTTPServer(httpServer),
-		server.WithStateLess(true),
+		server.WithStateLess(!stateful),
+		server.WithHTTPContextFunc(clientAddressContext),
 	)
-	mux.Handle(mcpEndpoint, streamableHTTPServer)
+	var mcpHandler http.Handler = streamableHTTPServer
+	if authenticator != nil {
+		mcpHandler = authMiddleware(authenticator, mcpHandler)
+	} else {
+		slog.Warn("Authentication is disabled, the MCP endpoint is open to anyone who can reach it", "listen", listenAddr)
+	}
+	mux.Handle(mcpEndpoint, mcpHandler)
 
 	// It seems Lightspeed-stack needs the server on / as well
-	mux.Handle("/", streamableHTTPServer)
+	mux.Handle("/", mcpHandler)
 
 	// Add health check endpoint
 	mux.HandleFunc(healthEndpoint, func(w http.ResponseWriter, r *http.Request) {
@@ -56,6 +84,10 @@ func Serve(ctx context.Context, mcpServer *server.MCPServer, listenAddr string)
 		w.Write([]byte("OK"))
 	})
 
+	// Expose the metrics of obs-mcp itself, without authentication like the
+	// health check
+	mux.Handle(metricsEndpoint, promhttp.Handler())
+
 	// Setup graceful shutdown
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -65,7 +97,7 @@ func Serve(ctx context.Context, mcpServer *server.MCPServer, listenAddr string)
 
 	serverErr := make(chan error, 1)
 	go func() {
-		log.Printf("HTTP server starting on %s with MCP endpoint at %s", listenAddr, mcpEndpoint)
+		slog.Info("HTTP server starting", "listen", listenAddr, "endpoint", mcpEndpoint)
 		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			serverErr <- err
 		}
@@ -73,24 +105,24 @@ func Serve(ctx context.Context, mcpServer *server.MCPServer, listenAddr string)
 
 	select {
 	case sig := <-sigChan:
-		log.Printf("Received signal %v, initiating graceful shutdown", sig)
+		slog.Info("Received signal, initiating graceful shutdown", "signal", sig.String())
 		cancel()
 	case <-ctx.Done():
-		log.Printf("Context cancelled, initiating graceful shutdown")
+		slog.Info("Context cancelled, initiating graceful shutdown")
 	case err := <-serverErr:
-		log.Printf("HTTP server error: %v", err)
+		slog.Error("HTTP server error", "error", err)
 		return err
 	}
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
-	log.Printf("Shutting down HTTP server gracefully...")
+	slog.Info("Shutting down HTTP server gracefully")
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+		slog.Error("HTTP server shutdown error", "error", err)
 		return err
 	}
 
-	log.Printf("HTTP server shutdown complete")
+	slog.Info("HTTP server shutdown complete")
 	return nil
 }
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Log output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const redacted = "[REDACTED]"
+
+// secretHeaders are headers carrying credentials, in canonical form.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// secretHeaderFragments catch custom credential headers such as X-Api-Key
+// or X-Forwarded-Access-Token.
+var secretHeaderFragments = []string{"token", "secret", "password", "key", "auth", "session", "credential"}
+
+// New creates a logger writing records of at least level to w, as text or JSON.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+}
+
+// IsSecretHeader reports whether the value of the header should not be logged.
+func IsSecretHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	if secretHeaders[name] {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, fragment := range secretHeaderFragments {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers returns a log attribute with the headers, the values of secret
+// headers replaced.
+func Headers(key string, header http.Header) slog.Attr {
+	attrs := make([]any, 0, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if IsSecretHeader(name) {
+			value = redacted
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.Group(key, attrs...)
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIsSecretHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Authorization", true},
+		{"authorization", true},
+		{"Proxy-Authorization", true},
+		{"Cookie", true},
+		{"Set-Cookie", true},
+		{"X-Api-Key", true},
+		{"X-Auth-Token", true},
+		{"X-Forwarded-Access-Token", true},
+		{"X-Client-Secret", true},
+		{"X-Session-Id", true},
+		{"Content-Type", false},
+		{"Accept", false},
+		{"User-Agent", false},
+		{"Mcp-Protocol-Version", false},
+	}
+	for _, tt := range tests {
+		if got := IsSecretHeader(tt.name); got != tt.want {
+			t.Errorf("IsSecretHeader(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHeadersRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("request", Headers("headers", http.Header{
+		"Authorization": {"Bearer s3cr3t"},
+		"Cookie":        {"session=s3cr3t"},
+		"X-Api-Key":     {"s3cr3t"},
+		"Content-Type":  {"application/json"},
+	}))
+
+	out := buf.String()
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("secret logged: %s", out)
+	}
+	for _, want := range []string{"headers.Authorization=[REDACTED]", "headers.Cookie=[REDACTED]", "headers.X-Api-Key=[REDACTED]", "headers.Content-Type=application/json"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in %s", want, out)
+		}
+	}
+}
@@ -2,19 +2,78 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/inecas/obs-mcp/pkg/chart"
+	"github.com/inecas/obs-mcp/pkg/forecast"
+	"github.com/inecas/obs-mcp/pkg/progress"
 	"github.com/inecas/obs-mcp/pkg/prometheus"
+	"github.com/inecas/obs-mcp/pkg/promql"
+	"github.com/inecas/obs-mcp/pkg/stats"
 	"github.com/mark3labs/mcp-go/mcp"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
 )
 
+// cardinalityScanLimit is the number of TSDB status entries requested when the
+// cardinality report is filtered locally.
+const cardinalityScanLimit = 1000
+
+const (
+	// maxForecastSeries caps the series forecast by a single call.
+	maxForecastSeries = 20
+	// maxForecastScanSteps caps the points the forecast is scanned at for
+	// threshold crossings.
+	maxForecastScanSteps = 5000
+
+	// maxCorrelationMetrics caps the candidate queries given to
+	// find_correlated_metrics.
+	maxCorrelationMetrics = 50
+
+	// maxChangepointSeries caps the series analyzed by a single call.
+	maxChangepointSeries = 20
+)
+
+// Bounds of the rendered graph dimensions in pixels.
+const (
+	minGraphSize = 200
+	maxGraphSize = 4000
+)
+
+func ListDatasourcesHandler(datasources *prometheus.Datasources) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := json.Marshal(datasources.List())
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal datasources: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+// withDatasource resolves the datasource argument of a call and runs the
+// handler created for the client of that datasource.
+func withDatasource(datasources *prometheus.Datasources, handler func(*prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ds, err := datasources.Get(req.GetString("datasource", ""))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return handler(ds.Client)(ctx, req)
+	}
+}
+
 func ListMetricsHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		metrics, err := promClient.ListMetrics(ctx)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to list metrics: %s", err.Error())), nil
+			return queryErrorResult("list metrics", err, prometheus.QueryContext{}), nil
 		}
 
 		result, err := json.Marshal(metrics)
@@ -28,74 +87,911 @@ func ListMetricsHandler(promClient *prometheus.PrometheusClient) func(context.Co
 
 func ExecuteRangeQueryHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// Get required query parameter
+		params, err := parseRangeQueryParams(ctx, req)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ctx = prometheus.WithQueryOptions(ctx, params.options)
+
+		// Execute the range query
+		result, err := promClient.ExecuteRangeQuery(ctx, params.query, params.start, params.end, params.step)
+		if err != nil {
+			return queryErrorResult("execute range query", err, params.queryContext()), nil
+		}
+
+		// Explain empty results, which otherwise leave the model guessing
+		if matrix, ok := result["result"].(model.Matrix); ok && len(matrix) == 0 {
+			progress.Report(ctx, "Diagnosing the empty result")
+			diagnosis, err := promClient.DiagnoseEmptyResult(ctx, params.query, params.start, params.end)
+			if err != nil {
+				result["diagnosisError"] = err.Error()
+			} else {
+				result["emptyResultDiagnosis"] = diagnosis
+			}
+		}
+
+		if index := recordQuery(ctx, req.GetString("datasource", ""), params, matrixLength(result)); index > 0 {
+			result["historyIndex"] = index
+		}
+
+		// Convert to JSON
+		jsonResult, err := json.Marshal(result)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// rangeQueryParams holds the arguments shared by the tools running range queries.
+type rangeQueryParams struct {
+	query   string
+	start   time.Time
+	end     time.Time
+	step    time.Duration
+	options prometheus.QueryOptions
+}
+
+func (p *rangeQueryParams) queryContext() prometheus.QueryContext {
+	return prometheus.QueryContext{Query: p.query, Start: p.start, End: p.end, Step: p.step}
+}
+
+func parseRangeQueryParams(ctx context.Context, req mcp.CallToolRequest) (*rangeQueryParams, error) {
+	// Get required query parameter
+	query, err := req.RequireString("query")
+	if err != nil {
+		return nil, fmt.Errorf("query parameter is required and must be a string")
+	}
+
+	params, err := parseTimeRangeParams(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	params.query = query
+	return params, nil
+}
+
+// parseTimeRangeParams parses the step and the start/end or duration
+// arguments of a range query and checks them against the server policy.
+func parseTimeRangeParams(ctx context.Context, req mcp.CallToolRequest) (*rangeQueryParams, error) {
+	// Get required step parameter
+	step, err := req.RequireString("step")
+	if err != nil {
+		return nil, fmt.Errorf("step parameter is required and must be a string")
+	}
+
+	// Parse step duration
+	stepDuration, err := prometheus.ParseDuration(step)
+	if err != nil {
+		return nil, fmt.Errorf("invalid step format: %s", err.Error())
+	}
+
+	startTime, endTime, err := parseRange(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRange(ctx, "range", endTime.Sub(startTime)); err != nil {
+		return nil, err
+	}
+	if err := checkStep(ctx, stepDuration); err != nil {
+		return nil, err
+	}
+
+	options, err := parseQueryOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rangeQueryParams{
+		start:   startTime,
+		end:     endTime,
+		step:    stepDuration,
+		options: options,
+	}, nil
+}
+
+// parseRange parses the start/end or duration arguments, defaulting to the
+// last hour.
+func parseRange(req mcp.CallToolRequest) (time.Time, time.Time, error) {
+	// Get optional parameters
+	startStr := req.GetString("start", "")
+	endStr := req.GetString("end", "")
+	durationStr := req.GetString("duration", "")
+
+	// Validate parameter combinations
+	if startStr != "" && endStr != "" && durationStr != "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("cannot specify both start/end and duration parameters")
+	}
+
+	if (startStr != "" && endStr == "") || (startStr == "" && endStr != "") {
+		return time.Time{}, time.Time{}, fmt.Errorf("both start and end must be provided together")
+	}
+
+	var startTime, endTime time.Time
+	var err error
+
+	// Handle duration-based query (default to 1h if nothing specified)
+	if durationStr != "" || (startStr == "" && endStr == "") {
+		if durationStr == "" {
+			durationStr = "1h"
+		}
+
+		duration, err := prometheus.ParseDuration(durationStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid duration format: %s", err.Error())
+		}
+
+		endTime = time.Now()
+		startTime = endTime.Add(-duration)
+	} else {
+		// Handle explicit start/end times
+		startTime, err = prometheus.ParseTimestamp(startStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start time format: %s", err.Error())
+		}
+
+		endTime, err = prometheus.ParseTimestamp(endStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end time format: %s", err.Error())
+		}
+	}
+
+	return startTime, endTime, nil
+}
+
+// parseQueryOptions parses the optional Thanos query parameters.
+func parseQueryOptions(req mcp.CallToolRequest) (prometheus.QueryOptions, error) {
+	var options prometheus.QueryOptions
+	args := req.GetArguments()
+
+	if _, ok := args["dedup"]; ok {
+		dedup := req.GetBool("dedup", true)
+		options.Dedup = &dedup
+	}
+	if _, ok := args["partial_response"]; ok {
+		partialResponse := req.GetBool("partial_response", false)
+		options.PartialResponse = &partialResponse
+	}
+
+	options.MaxSourceResolution = req.GetString("max_source_resolution", prometheus.ResolutionAuto)
+	switch options.MaxSourceResolution {
+	case prometheus.ResolutionAuto, prometheus.ResolutionRaw, prometheus.Resolution5m, prometheus.Resolution1h:
+	default:
+		return options, fmt.Errorf("max_source_resolution must be one of 'auto', '0s', '5m' or '1h'")
+	}
+	return options, nil
+}
+
+func CardinalityReportHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		limit := req.GetInt("limit", 10)
+		if limit <= 0 {
+			return mcp.NewToolResultError("limit must be a positive number"), nil
+		}
+		filter := prometheus.CardinalityFilter{
+			Metric: req.GetString("metric", ""),
+			Label:  req.GetString("label", ""),
+		}
+
+		// The TSDB status API cannot filter by itself, so fetch a wider
+		// window of entries when filtering locally.
+		upstreamLimit := uint64(limit)
+		if filter.Metric != "" || filter.Label != "" {
+			upstreamLimit = cardinalityScanLimit
+		}
+
+		status, err := promClient.TSDBStatus(ctx, upstreamLimit)
+		if err != nil {
+			return queryErrorResult("fetch TSDB status", err, prometheus.QueryContext{}), nil
+		}
+
+		progress.Report(ctx, "Building the cardinality report")
+		report, err := prometheus.NewCardinalityReport(status, filter, limit)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		result, err := json.Marshal(report)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+func ExplainPromQLHandler() func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		query, err := req.RequireString("query")
 		if err != nil {
 			return mcp.NewToolResultError("query parameter is required and must be a string"), nil
 		}
 
-		// Get required step parameter
-		step, err := req.RequireString("step")
+		explanation, err := promql.Explain(query)
 		if err != nil {
-			return mcp.NewToolResultError("step parameter is required and must be a string"), nil
+			return queryErrorResult("parse query", err, prometheus.QueryContext{Query: query}), nil
 		}
 
-		// Parse step duration
-		stepDuration, err := time.ParseDuration(step)
+		result, err := json.Marshal(explanation)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("invalid step format: %s", err.Error())), nil
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
 		}
 
-		// Get optional parameters
-		startStr := req.GetString("start", "")
-		endStr := req.GetString("end", "")
-		durationStr := req.GetString("duration", "")
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
 
-		// Validate parameter combinations
-		if startStr != "" && endStr != "" && durationStr != "" {
-			return mcp.NewToolResultError("cannot specify both start/end and duration parameters"), nil
+func RenderGraphHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		params, err := parseRangeQueryParams(ctx, req)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
 		}
+		ctx = prometheus.WithQueryOptions(ctx, params.options)
 
-		if (startStr != "" && endStr == "") || (startStr == "" && endStr != "") {
-			return mcp.NewToolResultError("both start and end must be provided together"), nil
+		format := req.GetString("format", "png")
+		if format != "png" && format != "svg" {
+			return mcp.NewToolResultError("format must be either 'png' or 'svg'"), nil
 		}
 
-		var startTime, endTime time.Time
+		matrix, err := promClient.QueryRangeMatrix(ctx, params.query, params.start, params.end, params.step)
+		if err != nil {
+			return queryErrorResult("execute range query", err, params.queryContext()), nil
+		}
 
-		// Handle duration-based query (default to 1h if nothing specified)
-		if durationStr != "" || (startStr == "" && endStr == "") {
-			if durationStr == "" {
-				durationStr = "1h"
+		width := req.GetInt("width", chart.DefaultWidth)
+		height := req.GetInt("height", chart.DefaultHeight)
+		if width < minGraphSize || width > maxGraphSize || height < minGraphSize || height > maxGraphSize {
+			return mcp.NewToolResultError(fmt.Sprintf("width and height must be between %d and %d pixels", minGraphSize, maxGraphSize)), nil
+		}
+
+		title := req.GetString("title", "")
+		if title == "" {
+			title = params.query
+		}
+
+		c := &chart.Chart{
+			Title:  title,
+			Unit:   req.GetString("unit", ""),
+			Step:   params.step,
+			Width:  width,
+			Height: height,
+		}
+		for _, stream := range matrix {
+			series := chart.Series{Name: stream.Metric.String()}
+			for _, sample := range stream.Values {
+				series.Points = append(series.Points, chart.Point{Time: sample.Timestamp.Time(), Value: float64(sample.Value)})
 			}
+			c.Series = append(c.Series, series)
+		}
+
+		progress.Report(ctx, "Rendering %s graph of %d series", format, len(matrix))
+		var image []byte
+		mimeType := "image/png"
+		if format == "svg" {
+			image, err = c.SVG()
+			mimeType = "image/svg+xml"
+		} else {
+			image, err = c.PNG()
+		}
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to render graph: %s", err.Error())), nil
+		}
+
+		summary := fmt.Sprintf("Graph of %d series for %s from %s to %s",
+			len(matrix), params.query, params.start.UTC().Format(time.RFC3339), params.end.UTC().Format(time.RFC3339))
+		if index := recordQuery(ctx, req.GetString("datasource", ""), params, len(matrix)); index > 0 {
+			summary += fmt.Sprintf(" (history index %d)", index)
+		}
+		return mcp.NewToolResultImage(summary, base64.StdEncoding.EncodeToString(image), mimeType), nil
+	}
+}
+
+func InvestigateAlertHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		alertName, err := req.RequireString("alertname")
+		if err != nil {
+			return mcp.NewToolResultError("alertname parameter is required and must be a string"), nil
+		}
 
-			duration, err := prometheus.ParseDuration(durationStr)
+		labels, err := getStringMap(req, "labels")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		opts := prometheus.AlertInvestigationOptions{Labels: labels}
+
+		if timeStr := req.GetString("time", ""); timeStr != "" {
+			opts.At, err = prometheus.ParseTimestamp(timeStr)
 			if err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("invalid duration format: %s", err.Error())), nil
+				return mcp.NewToolResultError(fmt.Sprintf("invalid time format: %s", err.Error())), nil
 			}
+		}
 
-			endTime = time.Now()
-			startTime = endTime.Add(-duration)
-		} else {
-			// Handle explicit start/end times
-			startTime, err = prometheus.ParseTimestamp(startStr)
+		opts.Window, err = prometheus.ParseDuration(req.GetString("window", "1h"))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid window format: %s", err.Error())), nil
+		}
+
+		opts.History, err = prometheus.ParseDuration(req.GetString("history", "1d"))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid history format: %s", err.Error())), nil
+		}
+
+		// The expression is evaluated over the window on both sides of the firing time
+		if err := checkRange(ctx, "window", 2*opts.Window); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := checkRange(ctx, "history", opts.History); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		progress.Report(ctx, "Investigating alert %s", alertName)
+		investigation, err := promClient.InvestigateAlert(ctx, alertName, opts)
+		if err != nil {
+			return queryErrorResult("investigate alert", err, prometheus.QueryContext{}), nil
+		}
+
+		result, err := json.Marshal(investigation)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+func TopWorkloadsHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		resource, err := req.RequireString("resource")
+		if err != nil {
+			return mcp.NewToolResultError("resource parameter is required and must be a string"), nil
+		}
+
+		opts := prometheus.TopWorkloadsOptions{
+			Resource:  resource,
+			Level:     req.GetString("level", prometheus.WorkloadLevelPod),
+			Namespace: req.GetString("namespace", ""),
+			Limit:     req.GetInt("limit", 10),
+		}
+
+		if windowStr := req.GetString("window", ""); windowStr != "" {
+			opts.Window, err = prometheus.ParseDuration(windowStr)
 			if err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("invalid start time format: %s", err.Error())), nil
+				return mcp.NewToolResultError(fmt.Sprintf("invalid window format: %s", err.Error())), nil
+			}
+			if err := checkRange(ctx, "window", opts.Window); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
 			}
+		}
 
-			endTime, err = prometheus.ParseTimestamp(endStr)
+		if timeStr := req.GetString("time", ""); timeStr != "" {
+			opts.At, err = prometheus.ParseTimestamp(timeStr)
 			if err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("invalid end time format: %s", err.Error())), nil
+				return mcp.NewToolResultError(fmt.Sprintf("invalid time format: %s", err.Error())), nil
 			}
 		}
 
-		// Execute the range query
-		result, err := promClient.ExecuteRangeQuery(ctx, query, startTime, endTime, stepDuration)
+		top, err := promClient.TopWorkloads(ctx, opts)
 		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("failed to execute range query: %s", err.Error())), nil
+			return queryErrorResult("rank workloads", err, prometheus.QueryContext{}), nil
 		}
 
-		// Convert to JSON
-		jsonResult, err := json.Marshal(result)
+		result, err := json.Marshal(top)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+func SLOReportHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		objective, err := req.RequireFloat("objective")
+		if err != nil {
+			return mcp.NewToolResultError("objective parameter is required and must be a number"), nil
+		}
+
+		opts := prometheus.SLOOptions{
+			Good:         req.GetString("good", ""),
+			Total:        req.GetString("total", ""),
+			Availability: req.GetString("availability", ""),
+		}
+		opts.Objective, err = prometheus.ParseObjective(objective)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		opts.Window, err = prometheus.ParseDuration(req.GetString("window", "30d"))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid window format: %s", err.Error())), nil
+		}
+		if err := checkRange(ctx, "window", opts.Window); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if timeStr := req.GetString("time", ""); timeStr != "" {
+			opts.At, err = prometheus.ParseTimestamp(timeStr)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid time format: %s", err.Error())), nil
+			}
+		}
+
+		report, err := promClient.SLOReport(ctx, opts)
+		if err != nil {
+			return queryErrorResult("compute SLO report", err, prometheus.QueryContext{}), nil
+		}
+
+		result, err := json.Marshal(report)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+// SeriesForecast is the forecast of a series of the forecast tool.
+type SeriesForecast struct {
+	Labels    model.Metric `json:"labels"`
+	LastValue float64      `json:"lastValue"`
+	// TrendPerHour is the slope of the fitted line.
+	TrendPerHour   float64           `json:"trendPerHour"`
+	R2             float64           `json:"r2"`
+	ResidualStdDev float64           `json:"residualStdDev"`
+	Crossing       *ForecastCrossing `json:"crossing,omitempty"`
+	AtHorizon      *ForecastValue    `json:"atHorizon,omitempty"`
+	Error          string            `json:"error,omitempty"`
+}
+
+// ForecastCrossing is when a series is forecast to cross the threshold. The
+// times are missing when the crossing is beyond the horizon.
+type ForecastCrossing struct {
+	Direction string     `json:"direction"`
+	At        *time.Time `json:"at,omitempty"`
+	In        string     `json:"in,omitempty"`
+	Earliest  *time.Time `json:"earliest,omitempty"`
+	Latest    *time.Time `json:"latest,omitempty"`
+}
+
+// ForecastValue is a forecast value with the bounds of its prediction
+// interval.
+type ForecastValue struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Lower float64   `json:"lower"`
+	Upper float64   `json:"upper"`
+}
+
+func ForecastHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		params, err := parseRangeQueryParams(ctx, req)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ctx = prometheus.WithQueryOptions(ctx, params.options)
+
+		threshold, err := req.RequireFloat("threshold")
+		if err != nil {
+			return mcp.NewToolResultError("threshold parameter is required and must be a number"), nil
+		}
+
+		opts := forecast.Options{
+			Model:      req.GetString("model", forecast.ModelLinear),
+			Confidence: req.GetFloat("confidence", 0.95),
+		}
+		if !slices.Contains(forecast.Models, opts.Model) {
+			return mcp.NewToolResultError(fmt.Sprintf("model must be one of %s", strings.Join(forecast.Models, ", "))), nil
+		}
+		if opts.Confidence <= 0 || opts.Confidence >= 1 {
+			return mcp.NewToolResultError("confidence must be between 0 and 1"), nil
+		}
+		opts.Season, err = prometheus.ParseDuration(req.GetString("season", "1d"))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid season format: %s", err.Error())), nil
+		}
+		horizon, err := prometheus.ParseDuration(req.GetString("horizon", "30d"))
+		if err != nil || horizon <= 0 {
+			return mcp.NewToolResultError("horizon must be a positive duration, e.g. '30d'"), nil
+		}
+
+		matrix, err := promClient.QueryRangeMatrix(ctx, params.query, params.start, params.end, params.step)
+		if err != nil {
+			return queryErrorResult("execute range query", err, params.queryContext()), nil
+		}
+
+		progress.Report(ctx, "Fitting %s trends to %d series", opts.Model, len(matrix))
+		until := params.end.Add(horizon)
+		scanStep := max(params.step, horizon/maxForecastScanSteps)
+		forecasts := []SeriesForecast{}
+		truncated, skipped := 0, 0
+		for _, stream := range matrix {
+			// The forecast starts from the last finite sample; series without
+			// any are skipped, as NaN and infinities cannot be encoded in JSON
+			last, ok := lastFiniteValue(stream.Values)
+			if !ok {
+				skipped++
+				continue
+			}
+			if len(forecasts) == maxForecastSeries {
+				truncated++
+				continue
+			}
+
+			f := SeriesForecast{Labels: stream.Metric, LastValue: last}
+			points := make([]forecast.Point, len(stream.Values))
+			for i, sample := range stream.Values {
+				points[i] = forecast.Point{Time: sample.Timestamp.Time(), Value: float64(sample.Value)}
+			}
+			fit, err := forecast.Fit(points, opts)
+			if err != nil {
+				f.Error = err.Error()
+				forecasts = append(forecasts, f)
+				continue
+			}
+
+			f.TrendPerHour = fit.SlopePerSecond() * time.Hour.Seconds()
+			f.R2 = fit.R2()
+			f.ResidualStdDev = fit.ResidualStdDev()
+
+			crossing := fit.Crossing(last, threshold, params.end, until, scanStep)
+			f.Crossing = &ForecastCrossing{Direction: "falling", At: crossing.At, Earliest: crossing.Earliest, Latest: crossing.Latest}
+			if crossing.Rising {
+				f.Crossing.Direction = "rising"
+			}
+			if crossing.At != nil {
+				f.Crossing.In = model.Duration(crossing.At.Sub(params.end).Round(time.Minute)).String()
+			}
+
+			value, lower, upper := fit.Predict(until)
+			f.AtHorizon = &ForecastValue{Time: until.UTC(), Value: value, Lower: lower, Upper: upper}
+			forecasts = append(forecasts, f)
+		}
+
+		response := map[string]any{
+			"query":      params.query,
+			"model":      opts.Model,
+			"threshold":  threshold,
+			"confidence": opts.Confidence,
+			"horizon":    model.Duration(horizon).String(),
+			"series":     forecasts,
+		}
+		if truncated > 0 {
+			response["truncatedSeries"] = truncated
+		}
+		if skipped > 0 {
+			response["skippedSeries"] = skipped
+			response["warning"] = fmt.Sprintf("%d series without any finite sample (NaN or infinite values only) were skipped", skipped)
+		}
+
+		result, err := json.Marshal(response)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+// lastFiniteValue returns the last sample value which is neither NaN nor
+// infinite.
+func lastFiniteValue(values []model.SamplePair) (float64, bool) {
+	for i := len(values) - 1; i >= 0; i-- {
+		if v := float64(values[i].Value); !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func FindCorrelatedMetricsHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		params, err := parseRangeQueryParams(ctx, req)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ctx = prometheus.WithQueryOptions(ctx, params.options)
+
+		opts := prometheus.CorrelationOptions{
+			Query:         params.query,
+			Start:         params.start,
+			End:           params.end,
+			Step:          params.step,
+			Metrics:       req.GetStringSlice("metrics", nil),
+			OverlapLabels: req.GetStringSlice("overlap_labels", prometheus.DefaultOverlapLabels),
+			Limit:         req.GetInt("limit", 10),
+		}
+		if opts.Limit <= 0 {
+			return mcp.NewToolResultError("limit must be a positive number"), nil
+		}
+		if len(opts.Metrics) > maxCorrelationMetrics {
+			return mcp.NewToolResultError(fmt.Sprintf("at most %d candidate metrics can be given", maxCorrelationMetrics)), nil
+		}
+		opts.MaxLag, err = prometheus.ParseDuration(req.GetString("max_lag", "10m"))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid max_lag format: %s", err.Error())), nil
+		}
+		// The candidates are queried over the range extended by the lag
+		if err := checkRange(ctx, "range", params.end.Sub(params.start)+opts.MaxLag); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		correlated, err := promClient.FindCorrelatedMetrics(ctx, opts)
+		if err != nil {
+			return queryErrorResult("find correlated metrics", err, params.queryContext()), nil
+		}
+
+		result, err := json.Marshal(correlated)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+// SeriesChangepoints are the change points of a series of the
+// detect_changepoints tool.
+type SeriesChangepoints struct {
+	Labels       model.Metric        `json:"labels"`
+	Points       int                 `json:"points"`
+	Changepoints []ChangepointResult `json:"changepoints"`
+	// TruncatedCount is the number of less significant change points left
+	// out.
+	TruncatedCount int    `json:"truncatedChangepoints,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ChangepointResult is a change of a series and the segments around it.
+type ChangepointResult struct {
+	Time   time.Time      `json:"time"`
+	Before SegmentSummary `json:"before"`
+	After  SegmentSummary `json:"after"`
+	// MeanChange is the difference of the means after and before.
+	MeanChange float64 `json:"meanChange"`
+	// RelativeMeanChange is MeanChange as a fraction of the mean before.
+	RelativeMeanChange *float64 `json:"relativeMeanChange,omitempty"`
+	// StdDevRatio is the standard deviation after divided by the one before.
+	StdDevRatio *float64 `json:"stdDevRatio,omitempty"`
+	Score       float64  `json:"score"`
+}
+
+// SegmentSummary describes the samples between change points.
+type SegmentSummary struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Points int       `json:"points"`
+	Mean   float64   `json:"mean"`
+	StdDev float64   `json:"stdDev"`
+}
+
+func DetectChangepointsHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		params, err := parseRangeQueryParams(ctx, req)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ctx = prometheus.WithQueryOptions(ctx, params.options)
+
+		opts := stats.ChangepointOptions{
+			Change:     req.GetString("change", stats.ChangeMeanVariance),
+			MinSegment: req.GetInt("min_segment", 5),
+			Penalty:    req.GetFloat("penalty", 1),
+		}
+		if !slices.Contains(stats.Changes, opts.Change) {
+			return mcp.NewToolResultError(fmt.Sprintf("change must be one of %s", strings.Join(stats.Changes, ", "))), nil
+		}
+		if opts.MinSegment < 2 {
+			return mcp.NewToolResultError("min_segment must be at least 2"), nil
+		}
+		if opts.Penalty <= 0 {
+			return mcp.NewToolResultError("penalty must be a positive number"), nil
+		}
+		maxChangepoints := req.GetInt("max_changepoints", 5)
+		if maxChangepoints <= 0 {
+			return mcp.NewToolResultError("max_changepoints must be a positive number"), nil
+		}
+
+		matrix, err := promClient.QueryRangeMatrix(ctx, params.query, params.start, params.end, params.step)
+		if err != nil {
+			return queryErrorResult("execute range query", err, params.queryContext()), nil
+		}
+
+		progress.Report(ctx, "Detecting change points in %d series", len(matrix))
+		results := []SeriesChangepoints{}
+		truncated := 0
+		for _, stream := range matrix {
+			if len(results) == maxChangepointSeries {
+				truncated++
+				continue
+			}
+
+			var times []time.Time
+			var values []float64
+			for _, sample := range stream.Values {
+				if v := float64(sample.Value); !math.IsNaN(v) && !math.IsInf(v, 0) {
+					times = append(times, sample.Timestamp.Time())
+					values = append(values, v)
+				}
+			}
+
+			series := SeriesChangepoints{Labels: stream.Metric, Points: len(values), Changepoints: []ChangepointResult{}}
+			changepoints, err := stats.Changepoints(values, opts)
+			if err != nil {
+				series.Error = err.Error()
+				results = append(results, series)
+				continue
+			}
+			top := stats.MostSignificant(changepoints, maxChangepoints)
+			series.TruncatedCount = len(changepoints) - len(top)
+			for _, c := range top {
+				series.Changepoints = append(series.Changepoints, changepointResult(c, times))
+			}
+			results = append(results, series)
+		}
+
+		response := map[string]any{
+			"query":  params.query,
+			"change": opts.Change,
+			"series": results,
+		}
+		if truncated > 0 {
+			response["truncatedSeries"] = truncated
+		}
+
+		result, err := json.Marshal(response)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+func changepointResult(c stats.Changepoint, times []time.Time) ChangepointResult {
+	segment := func(s stats.Segment) SegmentSummary {
+		return SegmentSummary{
+			Start:  times[s.Start].UTC(),
+			End:    times[s.End-1].UTC(),
+			Points: s.End - s.Start,
+			Mean:   s.Mean,
+			StdDev: s.StdDev,
+		}
+	}
+
+	result := ChangepointResult{
+		Time:       times[c.Index].UTC(),
+		Before:     segment(c.Before),
+		After:      segment(c.After),
+		MeanChange: c.After.Mean - c.Before.Mean,
+		Score:      c.Score,
+	}
+	if c.Before.Mean != 0 {
+		relative := result.MeanChange / math.Abs(c.Before.Mean)
+		result.RelativeMeanChange = &relative
+	}
+	if c.Before.StdDev != 0 {
+		ratio := c.After.StdDev / c.Before.StdDev
+		result.StdDevRatio = &ratio
+	}
+	return result
+}
+
+// getStringMap returns an optional object argument whose values are strings.
+func getStringMap(req mcp.CallToolRequest, key string) (map[string]string, error) {
+	raw, ok := req.GetArguments()[key]
+	if !ok || raw == nil {
+		return map[string]string{}, nil
+	}
+
+	object, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s parameter must be an object", key)
+	}
+
+	result := make(map[string]string, len(object))
+	for name, value := range object {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s parameter values must be strings", key)
+		}
+		result[name] = s
+	}
+	return result, nil
+}
+
+func BuildQueryHandler(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		metric, err := req.RequireString("metric")
+		if err != nil {
+			return mcp.NewToolResultError("metric parameter is required and must be a string"), nil
+		}
+
+		matchers, err := getLabelMatchers(req, "matchers")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		window, err := prometheus.ParseDuration(req.GetString("window", "5m"))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid window format: %s", err.Error())), nil
+		}
+
+		spec := promql.QuerySpec{
+			Metric:      metric,
+			Matchers:    matchers,
+			Window:      window,
+			Aggregation: req.GetString("aggregation", ""),
+			By:          req.GetStringSlice("by", nil),
+			Without:     req.GetStringSlice("without", nil),
+			Comparison:  req.GetString("comparison", ""),
+		}
+		if _, ok := req.GetArguments()["aggregation_param"]; ok {
+			param := req.GetFloat("aggregation_param", 0)
+			spec.AggregationParam = &param
+		}
+		if _, ok := req.GetArguments()["threshold"]; ok {
+			threshold := req.GetFloat("threshold", 0)
+			spec.Threshold = &threshold
+		}
+
+		metricType, err := promClient.MetricType(ctx, metric)
+		if err != nil {
+			return queryErrorResult("fetch metric metadata", err, prometheus.QueryContext{}), nil
+		}
+
+		var notes []string
+		rangeFunction := req.GetString("range_function", "auto")
+		switch rangeFunction {
+		case "auto":
+			spec.RangeFunction, notes = chooseRangeFunction(metric, metricType)
+		case "none":
+		default:
+			spec.RangeFunction = rangeFunction
+			if metricType == v1.MetricTypeGauge && slices.Contains([]string{"rate", "irate", "increase", "resets"}, rangeFunction) {
+				notes = append(notes, fmt.Sprintf("%s is a gauge; %s is meant for counters, consider delta, deriv or an _over_time function", metric, rangeFunction))
+			}
+		}
+
+		query, err := promql.Build(spec)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to build query: %s", err.Error())), nil
+		}
+
+		response := map[string]interface{}{
+			"query":      query,
+			"metricType": metricType,
+		}
+		if spec.RangeFunction != "" {
+			response["rangeFunction"] = spec.RangeFunction
+		}
+		if len(notes) > 0 {
+			response["notes"] = notes
+		}
+
+		if req.GetBool("execute", false) {
+			params, err := parseTimeRangeParams(ctx, req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			ctx = prometheus.WithQueryOptions(ctx, params.options)
+
+			params.query = query
+			result, err := promClient.ExecuteRangeQuery(ctx, query, params.start, params.end, params.step)
+			if err != nil {
+				return queryErrorResult("execute range query", err, params.queryContext()), nil
+			}
+			response["result"] = result
+			if index := recordQuery(ctx, req.GetString("datasource", ""), params, matrixLength(result)); index > 0 {
+				response["historyIndex"] = index
+			}
+		}
+
+		jsonResult, err := json.Marshal(response)
 		if err != nil {
 			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
 		}
@@ -103,3 +999,62 @@ func ExecuteRangeQueryHandler(promClient *prometheus.PrometheusClient) func(cont
 		return mcp.NewToolResultText(string(jsonResult)), nil
 	}
 }
+
+// chooseRangeFunction picks rate for counters and classic histogram series and
+// plain selection for everything else.
+func chooseRangeFunction(metric string, metricType v1.MetricType) (string, []string) {
+	switch metricType {
+	case v1.MetricTypeCounter, v1.MetricTypeHistogram, v1.MetricTypeGaugeHistogram, v1.MetricTypeSummary:
+		if metricType != v1.MetricTypeCounter && !strings.HasSuffix(metric, "_bucket") &&
+			!strings.HasSuffix(metric, "_count") && !strings.HasSuffix(metric, "_sum") {
+			// Summary quantiles and native histograms are used as they are.
+			return "", nil
+		}
+		return "rate", []string{fmt.Sprintf("%s is a %s, using rate", metric, metricType)}
+	case "":
+		if strings.HasSuffix(metric, "_total") {
+			return "rate", []string{fmt.Sprintf("no metadata found for %s, assuming a counter because of the _total suffix", metric)}
+		}
+		return "", []string{fmt.Sprintf("no metadata found for %s, assuming a gauge", metric)}
+	}
+	return "", nil
+}
+
+// getLabelMatchers returns an optional array argument of label matcher objects.
+func getLabelMatchers(req mcp.CallToolRequest, key string) ([]promql.LabelMatcher, error) {
+	raw, ok := req.GetArguments()[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s parameter must be an array", key)
+	}
+
+	matchers := make([]promql.LabelMatcher, 0, len(items))
+	for _, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s parameter items must be objects", key)
+		}
+		label, _ := object["label"].(string)
+		op, _ := object["op"].(string)
+		value, _ := object["value"].(string)
+		matchers = append(matchers, promql.LabelMatcher{Label: label, Op: op, Value: value})
+	}
+	return matchers, nil
+}
+
+// queryErrorResult turns a failed Prometheus call into a tool error carrying a
+// stable error code and a hint on how to fix the call.
+func queryErrorResult(action string, err error, qc prometheus.QueryContext) *mcp.CallToolResult {
+	qe := prometheus.ClassifyError(err, qc)
+	text := fmt.Sprintf("failed to %s: %s\nerror_code: %s", action, qe.Message, qe.Code)
+	if qe.Hint != "" {
+		text += "\nhint: " + qe.Hint
+	}
+	result := mcp.NewToolResultError(text)
+	result.Meta = &mcp.Meta{AdditionalFields: map[string]any{errorCodeMetaKey: string(qe.Code)}}
+	return result
+}
@@ -0,0 +1,693 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	"github.com/inecas/obs-mcp/pkg/history"
+	"github.com/inecas/obs-mcp/pkg/prometheus"
+	"github.com/inecas/obs-mcp/pkg/templates"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+)
+
+// newTestServer serves the tools over the fixtures in testdata.
+func newTestServer(t *testing.T, policy config.Policy) *server.MCPServer {
+	return newTestServerWithHistory(t, policy, nil)
+}
+
+func newTestServerWithHistory(t *testing.T, policy config.Policy, store *history.Store) *server.MCPServer {
+	t.Helper()
+	datasources, library := newTestDependencies(t)
+	mcpServer := server.NewMCPServer("obs-mcp-test", "test", server.WithToolCapabilities(true))
+	if err := SetupTools(mcpServer, datasources, policy, store, library); err != nil {
+		t.Fatalf("setting up tools: %v", err)
+	}
+	return mcpServer
+}
+
+// newTestDependencies loads the fixture datasource and the test query
+// templates.
+func newTestDependencies(t *testing.T) (*prometheus.Datasources, *templates.Library) {
+	t.Helper()
+	datasources, err := prometheus.NewDatasources(&config.Config{
+		Datasources: []config.DatasourceConfig{{
+			Name:     "fixtures",
+			Fixtures: []string{"testdata/tests.yaml", "testdata/metrics.om"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("loading fixtures: %v", err)
+	}
+
+	library, err := templates.Load("testdata/templates.yaml")
+	if err != nil {
+		t.Fatalf("loading query templates: %v", err)
+	}
+	return datasources, library
+}
+
+// callTool calls a tool through the JSON-RPC interface of the server.
+func callTool(t *testing.T, mcpServer *server.MCPServer, name string, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	return callToolContext(t, context.Background(), mcpServer, name, args)
+}
+
+func callToolContext(t *testing.T, ctx context.Context, mcpServer *server.MCPServer, name string, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	request, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": name, "arguments": args},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch response := mcpServer.HandleMessage(ctx, request).(type) {
+	case mcp.JSONRPCResponse:
+		result, ok := response.Result.(mcp.CallToolResult)
+		if !ok {
+			t.Fatalf("unexpected result type %T", response.Result)
+		}
+		return &result
+	case mcp.JSONRPCError:
+		t.Fatalf("%s failed: %s", name, response.Error.Message)
+	default:
+		t.Fatalf("unexpected response type %T", response)
+	}
+	return nil
+}
+
+// listTools lists the tools registered in the server.
+func listTools(t *testing.T, mcpServer *server.MCPServer) []mcp.Tool {
+	t.Helper()
+	request := []byte(`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`)
+	response, ok := mcpServer.HandleMessage(context.Background(), request).(mcp.JSONRPCResponse)
+	if !ok {
+		t.Fatalf("listing tools failed: %#v", response)
+	}
+	result, ok := response.Result.(mcp.ListToolsResult)
+	if !ok {
+		t.Fatalf("unexpected result type %T", response.Result)
+	}
+	return result.Tools
+}
+
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	if len(result.Content) == 0 {
+		t.Fatal("result has no content")
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		t.Fatalf("unexpected content type %T", result.Content[0])
+	}
+	return text.Text
+}
+
+// successText returns the text of a successful result.
+func successText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	text := resultText(t, result)
+	if result.IsError {
+		t.Fatalf("tool failed: %s", text)
+	}
+	return text
+}
+
+func TestListDatasources(t *testing.T) {
+	text := successText(t, callTool(t, newTestServer(t, config.Policy{}), "list_datasources", nil))
+	if !strings.Contains(text, `"name":"fixtures"`) {
+		t.Errorf("fixtures datasource not listed: %s", text)
+	}
+}
+
+func TestListMetrics(t *testing.T) {
+	text := successText(t, callTool(t, newTestServer(t, config.Policy{}), "list_metrics", nil))
+
+	var metrics []string
+	if err := json.Unmarshal([]byte(text), &metrics); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+	for _, want := range []string{"http_requests_total", "job:http_requests:rate5m", "node_memory_available_bytes", "up"} {
+		if !strings.Contains(text, `"`+want+`"`) {
+			t.Errorf("metric %s not listed in %v", want, metrics)
+		}
+	}
+}
+
+func TestExecuteRangeQuery(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	tests := []struct {
+		name      string
+		args      map[string]any
+		wantError string
+		// wantSeries is the number of series expected in the result.
+		wantSeries int
+	}{
+		{
+			name:       "raw series",
+			args:       map[string]any{"query": `up{job="api"}`, "step": "1m", "duration": "1h"},
+			wantSeries: 2,
+		},
+		{
+			name:       "recording rule",
+			args:       map[string]any{"query": "job:http_requests:rate5m", "step": "5m", "duration": "1h"},
+			wantSeries: 1,
+		},
+		{
+			name:      "parse error",
+			args:      map[string]any{"query": "sum(up", "step": "1m", "duration": "1h"},
+			wantError: string(prometheus.ErrCodeParse),
+		},
+		{
+			name:      "max resolution",
+			args:      map[string]any{"query": "up", "step": "1s", "duration": "1d"},
+			wantError: string(prometheus.ErrCodeMaxResolution),
+		},
+		{
+			name:      "unknown datasource",
+			args:      map[string]any{"query": "up", "step": "1m", "datasource": "missing"},
+			wantError: "unknown datasource",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callTool(t, mcpServer, "execute_range_query", tt.args)
+			text := resultText(t, result)
+			if tt.wantError != "" {
+				if !result.IsError || !strings.Contains(text, tt.wantError) {
+					t.Fatalf("expected error %s, got %s", tt.wantError, text)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("tool failed: %s", text)
+			}
+
+			var response struct {
+				ResultType string            `json:"resultType"`
+				Result     []json.RawMessage `json:"result"`
+			}
+			if err := json.Unmarshal([]byte(text), &response); err != nil {
+				t.Fatalf("invalid result %s: %v", text, err)
+			}
+			if response.ResultType != "matrix" || len(response.Result) != tt.wantSeries {
+				t.Errorf("expected a matrix of %d series, got %s", tt.wantSeries, text)
+			}
+		})
+	}
+}
+
+func TestCardinalityReport(t *testing.T) {
+	text := successText(t, callTool(t, newTestServer(t, config.Policy{}), "cardinality_report", map[string]any{"limit": 3}))
+	if !strings.Contains(text, "http_requests_total") {
+		t.Errorf("http_requests_total missing from report: %s", text)
+	}
+}
+
+func TestExplainPromQL(t *testing.T) {
+	text := successText(t, callTool(t, newTestServer(t, config.Policy{}), "explain_promql", map[string]any{
+		"query": `sum by (job) (rate(http_requests_total[5m]))`,
+	}))
+	if !strings.Contains(text, "rate") {
+		t.Errorf("explanation does not mention rate: %s", text)
+	}
+}
+
+func TestRenderGraph(t *testing.T) {
+	result := callTool(t, newTestServer(t, config.Policy{}), "render_graph", map[string]any{
+		"query": "job:http_requests:rate5m", "step": "1m", "duration": "1h", "format": "svg",
+	})
+	if result.IsError {
+		t.Fatalf("tool failed: %s", resultText(t, result))
+	}
+	image, ok := result.Content[len(result.Content)-1].(mcp.ImageContent)
+	if !ok || image.MIMEType != "image/svg+xml" {
+		t.Fatalf("expected an SVG image, got %#v", result.Content)
+	}
+}
+
+func TestInvestigateAlert(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	text := successText(t, callTool(t, mcpServer, "investigate_alert", map[string]any{"alertname": "HighErrorRate"}))
+	var investigation prometheus.AlertInvestigation
+	if err := json.Unmarshal([]byte(text), &investigation); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+	if len(investigation.Active) != 1 || investigation.Active[0].State != "firing" {
+		t.Errorf("expected one firing alert, got %s", text)
+	}
+	if len(investigation.Expression.Series) == 0 {
+		t.Errorf("expression was not evaluated: %s", text)
+	}
+
+	result := callTool(t, mcpServer, "investigate_alert", map[string]any{"alertname": "NoSuchAlert"})
+	if !result.IsError {
+		t.Errorf("expected an error for an unknown alert, got %s", resultText(t, result))
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	text := successText(t, callTool(t, newTestServer(t, config.Policy{}), "build_query", map[string]any{
+		"metric":      "http_requests_total",
+		"aggregation": "sum",
+		"by":          []string{"job"},
+		"execute":     true,
+		"duration":    "1h",
+		"step":        "5m",
+	}))
+	if !strings.Contains(text, `sum by (job) (rate(http_requests_total[5m]))`) {
+		t.Errorf("counter was not wrapped in rate: %s", text)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{MaxRange: model.Duration(30 * time.Minute)})
+
+	result := callTool(t, mcpServer, "execute_range_query", map[string]any{"query": "up", "step": "1m", "duration": "1h"})
+	if !result.IsError || !strings.Contains(resultText(t, result), "maximum") {
+		t.Errorf("expected the range to be rejected, got %s", resultText(t, result))
+	}
+
+	mcpServer = newTestServer(t, config.Policy{MinStep: model.Duration(5 * time.Minute)})
+	result = callTool(t, mcpServer, "execute_range_query", map[string]any{"query": "up", "step": "1m", "duration": "1h"})
+	if !result.IsError || !strings.Contains(resultText(t, result), "minimum of 5m") {
+		t.Errorf("expected the step to be rejected, got %s", resultText(t, result))
+	}
+	successText(t, callTool(t, mcpServer, "execute_range_query", map[string]any{"query": "up", "step": "5m", "duration": "1h"}))
+
+	// Only the enabled tools are registered
+	mcpServer = newTestServer(t, config.Policy{EnabledTools: []string{"explain_promql"}, DisabledTools: []string{"list_metrics"}})
+	if tools := listTools(t, mcpServer); len(tools) != 1 || tools[0].Name != "explain_promql" {
+		t.Errorf("expected only explain_promql to be registered, got %v", tools)
+	}
+}
+
+func TestRerunQuery(t *testing.T) {
+	mcpServer := newTestServerWithHistory(t, config.Policy{}, history.NewStore(10))
+	ctx := mcpServer.WithContext(context.Background(), server.NewInProcessSession("test", nil))
+
+	successText(t, callToolContext(t, ctx, mcpServer, "execute_range_query", map[string]any{
+		"query": "sum by (instance) (rate(http_requests_total[5m]))", "step": "5m", "duration": "1h",
+	}))
+
+	tests := []struct {
+		name      string
+		args      map[string]any
+		wantQuery string
+		wantError string
+	}{
+		{
+			name:      "latest with a label filter",
+			args:      map[string]any{"index": -1, "matchers": []map[string]any{{"label": "instance", "value": "api-1"}}},
+			wantQuery: `sum by (instance) (rate(http_requests_total{instance=\"api-1\"}[5m]))`,
+		},
+		{
+			name:      "first shifted back",
+			args:      map[string]any{"index": 1, "shift": "-30m", "step": "1m"},
+			wantQuery: `sum by (instance) (rate(http_requests_total[5m]))`,
+		},
+		{
+			name:      "unknown index",
+			args:      map[string]any{"index": 10},
+			wantError: "no query with index 10",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callToolContext(t, ctx, mcpServer, "rerun_query", tt.args)
+			text := resultText(t, result)
+			if tt.wantError != "" {
+				if !result.IsError || !strings.Contains(text, tt.wantError) {
+					t.Fatalf("expected error %q, got %s", tt.wantError, text)
+				}
+				return
+			}
+			if result.IsError || !strings.Contains(text, tt.wantQuery) {
+				t.Errorf("expected a result for %s, got %s", tt.wantQuery, text)
+			}
+		})
+	}
+
+	// The query options of the original query are kept unless overridden:
+	// explicitly requested partial responses are always reported
+	successText(t, callToolContext(t, ctx, mcpServer, "execute_range_query", map[string]any{
+		"query": "up", "step": "5m", "duration": "1h", "partial_response": true,
+	}))
+	if text := successText(t, callToolContext(t, ctx, mcpServer, "rerun_query", map[string]any{"index": -1})); !strings.Contains(text, `"partialResponse":false`) {
+		t.Errorf("expected the partial response option to be kept, got %s", text)
+	}
+	text := successText(t, callToolContext(t, ctx, mcpServer, "rerun_query", map[string]any{"index": -1, "partial_response": false}))
+	if strings.Contains(text, "partialResponse") {
+		t.Errorf("expected the partial response option to be overridden, got %s", text)
+	}
+
+	// Without a session nothing is recorded
+	result := callTool(t, mcpServer, "rerun_query", map[string]any{"index": 1})
+	if !result.IsError {
+		t.Errorf("expected re-running without a session to fail, got %s", resultText(t, result))
+	}
+}
+
+func TestListQueryTemplates(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	text := successText(t, callTool(t, mcpServer, "list_query_templates", map[string]any{}))
+	for _, name := range []string{"http_error_ratio", "namespace_cpu_usage"} {
+		if !strings.Contains(text, `"name":"`+name+`"`) {
+			t.Errorf("expected template %s to be listed, got %s", name, text)
+		}
+	}
+}
+
+func TestRunQueryTemplate(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	tests := []struct {
+		name      string
+		args      map[string]any
+		wantQuery string
+		wantError string
+	}{
+		{
+			name:      "default window",
+			args:      map[string]any{"name": "http_error_ratio", "parameters": map[string]any{"job": "api"}},
+			wantQuery: `sum by (instance) (rate(http_requests_total{code=~\"5..\",job=\"api\"}[5m]))`,
+		},
+		{
+			name:      "escaped value",
+			args:      map[string]any{"name": "http_error_ratio", "parameters": map[string]any{"job": `a"b`, "window": "10m"}},
+			wantQuery: `job=\"a\\\"b\"}[10m]`,
+		},
+		{
+			name:      "missing parameter",
+			args:      map[string]any{"name": "http_error_ratio"},
+			wantError: `parameter "job" of template http_error_ratio is required`,
+		},
+		{
+			name:      "invalid duration",
+			args:      map[string]any{"name": "http_error_ratio", "parameters": map[string]any{"job": "api", "window": "5 minutes"}},
+			wantError: `parameter "window"`,
+		},
+		{
+			name:      "unknown template",
+			args:      map[string]any{"name": "missing"},
+			wantError: "available templates",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args["step"] = "5m"
+			tt.args["duration"] = "1h"
+			result := callTool(t, mcpServer, "run_query_template", tt.args)
+			text := resultText(t, result)
+			if tt.wantError != "" {
+				if !result.IsError || !strings.Contains(text, tt.wantError) {
+					t.Fatalf("expected error %q, got %s", tt.wantError, text)
+				}
+				return
+			}
+			if result.IsError || !strings.Contains(text, tt.wantQuery) {
+				t.Errorf("expected a result for %s, got %s", tt.wantQuery, text)
+			}
+		})
+	}
+}
+
+func TestTopWorkloads(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	tests := []struct {
+		name string
+		args map[string]any
+		// want are the ranked entries as "namespace/kind/name unit", or with
+		// the formatted value instead of the unit for exact values.
+		want []string
+	}{
+		{
+			name: "pods by cpu",
+			args: map[string]any{"resource": "cpu"},
+			want: []string{"shop/Pod/db-0 cores", "shop/Pod/web-7d9f-def cores", "shop/Pod/web-7d9f-abc cores",
+				"batch/Pod/legacy-5f6c-abc cores", "batch/Pod/canary-8b4d-abc cores", "batch/Pod/report cores"},
+		},
+		{
+			name: "workloads by cpu",
+			args: map[string]any{"resource": "cpu", "level": "workload"},
+			want: []string{"shop/StatefulSet/db cores", "shop/Deployment/web cores",
+				"batch/ReplicaSet/legacy-5f6c cores", "batch/ReplicaSet/canary-8b4d cores", "batch/Pod/report cores"},
+		},
+		{
+			name: "namespaces by cpu",
+			args: map[string]any{"resource": "cpu", "level": "namespace", "limit": 1},
+			want: []string{"shop// cores"},
+		},
+		{
+			name: "pods by memory",
+			args: map[string]any{"resource": "memory", "namespace": "shop"},
+			want: []string{"shop/Pod/db-0 2 GiB", "shop/Pod/web-7d9f-abc 256 MiB"},
+		},
+		{
+			name: "pods by restarts",
+			args: map[string]any{"resource": "restarts"},
+			want: []string{"shop/Pod/db-0 3 restarts"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := successText(t, callTool(t, mcpServer, "top_workloads", tt.args))
+			var top prometheus.TopWorkloads
+			if err := json.Unmarshal([]byte(text), &top); err != nil {
+				t.Fatalf("invalid result %s: %v", text, err)
+			}
+
+			// Rates depend on how far the evaluation time is past the last
+			// sample, so only the ranking and unit of CPU usage are compared
+			got := make([]string, len(top.Entries))
+			for i, e := range top.Entries {
+				value := e.Formatted
+				if top.Unit == "cores" {
+					value = top.Unit
+				}
+				got[i] = e.Namespace + "/" + e.Kind + "/" + e.Name + " " + value
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("expected entries\n%s\ngot\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestSLOReport(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	// 5% of the requests of api-0 have been failing for the last two hours
+	text := successText(t, callTool(t, mcpServer, "slo_report", map[string]any{
+		"good":      `http_requests_total{job="api", code!~"5.."}`,
+		"total":     `http_requests_total{job="api"}`,
+		"objective": 99,
+	}))
+	var report prometheus.SLOReport
+	if err := json.Unmarshal([]byte(text), &report); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+
+	if report.Objective != 0.99 || report.Window != "30d" {
+		t.Errorf("expected a 99%% objective over 30d, got %s", text)
+	}
+	if report.SLI == nil || *report.SLI < 0.95 || *report.SLI > 0.96 {
+		t.Errorf("expected an SLI of about 0.957, got %s", text)
+	}
+	var burn1h *float64
+	for _, burn := range report.BurnRates {
+		if burn.Window == "1h" {
+			burn1h = burn.BurnRate
+		}
+	}
+	if burn1h == nil || *burn1h < 6 || *burn1h > 6.5 {
+		t.Errorf("expected a 1h burn rate of about 6.25, got %s", text)
+	}
+	var firing []string
+	for _, alert := range report.Alerts {
+		if alert.Firing {
+			firing = append(firing, alert.Severity+" "+alert.LongWindow+"/"+alert.ShortWindow)
+		}
+	}
+	if strings.Join(firing, ",") != "ticket 3d/6h" {
+		t.Errorf("expected only the 3d/6h ticket alert to fire, got %v", firing)
+	}
+	if report.Exhaustion == nil || !report.Exhaustion.Exhausted {
+		t.Errorf("expected the error budget to be exhausted, got %s", text)
+	}
+
+	// The targets have always been up
+	text = successText(t, callTool(t, mcpServer, "slo_report", map[string]any{
+		"availability": `up{job="api"}`,
+		"objective":    0.9,
+		"window":       "7d",
+	}))
+	report = prometheus.SLOReport{}
+	if err := json.Unmarshal([]byte(text), &report); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+	if report.SLI == nil || *report.SLI != 1 || report.Exhaustion != nil {
+		t.Errorf("expected an SLI of 1 with no budget consumed, got %s", text)
+	}
+
+	result := callTool(t, mcpServer, "slo_report", map[string]any{"good": "sum(up)", "total": "up", "objective": 0.9})
+	if !result.IsError || !strings.Contains(resultText(t, result), "series selector") {
+		t.Errorf("expected good to be rejected, got %s", resultText(t, result))
+	}
+}
+
+func TestForecast(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	// The counter grows by 36000 an hour
+	text := successText(t, callTool(t, mcpServer, "forecast", map[string]any{
+		"query":     `http_requests_total{instance="api-0", code="200"}`,
+		"threshold": 180000,
+		"step":      "1m",
+		"duration":  "2h",
+		"horizon":   "1d",
+	}))
+	var response struct {
+		Series []SeriesForecast `json:"series"`
+	}
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+	if len(response.Series) != 1 {
+		t.Fatalf("expected a single series, got %s", text)
+	}
+
+	f := response.Series[0]
+	if math.Abs(f.TrendPerHour-36000) > 100 || f.R2 < 0.99 {
+		t.Errorf("expected a trend of 36000 an hour, got %s", text)
+	}
+	if f.Crossing == nil || f.Crossing.Direction != "rising" || f.Crossing.At == nil {
+		t.Fatalf("expected a rising crossing, got %s", text)
+	}
+	// 108000 now
+	in, err := model.ParseDuration(f.Crossing.In)
+	if err != nil || time.Duration(in) < 110*time.Minute || time.Duration(in) > 130*time.Minute {
+		t.Errorf("expected the crossing in about 2h, got %s", text)
+	}
+
+	result := callTool(t, mcpServer, "forecast", map[string]any{
+		"query": "up", "threshold": 2, "step": "1m", "duration": "1h", "model": "seasonal",
+	})
+	if text := successText(t, result); !strings.Contains(text, "two seasons") {
+		t.Errorf("expected the seasonal model to require two seasons, got %s", text)
+	}
+
+	// The latency steps up to 0.5 an hour before the end, dividing by zero
+	// from then on: the forecast starts from the last finite sample
+	text = successText(t, callTool(t, mcpServer, "forecast", map[string]any{
+		"query": `1 / (request_latency_seconds{job="api"} - 0.5)`, "threshold": 0, "step": "1m", "duration": "3h",
+	}))
+	response.Series = nil
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+	if len(response.Series) != 1 || response.Series[0].LastValue != -2.5 {
+		t.Errorf("expected a forecast from the last finite value -2.5, got %s", text)
+	}
+
+	// Series without any finite sample are skipped and counted
+	for _, query := range []string{`1 / (up{instance="api-0"} - 1)`, `0 / (up{instance="api-0"} - 1)`} {
+		text = successText(t, callTool(t, mcpServer, "forecast", map[string]any{
+			"query": query, "threshold": 0, "step": "1m", "duration": "1h",
+		}))
+		var skipped struct {
+			Series        []SeriesForecast `json:"series"`
+			SkippedSeries int              `json:"skippedSeries"`
+			Warning       string           `json:"warning"`
+		}
+		if err := json.Unmarshal([]byte(text), &skipped); err != nil {
+			t.Fatalf("invalid result %s: %v", text, err)
+		}
+		if len(skipped.Series) != 0 || skipped.SkippedSeries != 1 || !strings.Contains(skipped.Warning, "NaN") {
+			t.Errorf("expected the series of %s to be skipped, got %s", query, text)
+		}
+	}
+}
+
+func TestFindCorrelatedMetrics(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	text := successText(t, callTool(t, mcpServer, "find_correlated_metrics", map[string]any{
+		"query": `queue_depth{namespace="shop"}`, "step": "1m", "duration": "2h",
+	}))
+	var result prometheus.CorrelatedMetrics
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+
+	if result.Selector != `{namespace="shop",pod="worker-0"}` || len(result.Signals) != 2 {
+		t.Fatalf("expected two signals of the candidates of worker-0, got %s", text)
+	}
+	idle, busy := result.Signals[0], result.Signals[1]
+	if busy.Query != `worker_busy{namespace="shop",pod="worker-0"}` || busy.BestLag != "-5m" || busy.LagCorrelation < 0.99 {
+		t.Errorf("expected worker_busy to follow the queue 5m later, got %+v", busy)
+	}
+	if idle.Query != `worker_idle{namespace="shop",pod="worker-0"}` || idle.BestLag != "0s" || idle.LagCorrelation > -0.99 {
+		t.Errorf("expected worker_idle to mirror the queue, got %+v", idle)
+	}
+
+	// Explicit candidates without lag
+	text = successText(t, callTool(t, mcpServer, "find_correlated_metrics", map[string]any{
+		"query": `queue_depth`, "step": "1m", "duration": "2h", "max_lag": "0s",
+		"metrics": []string{"worker_busy", "worker_idle"},
+	}))
+	result = prometheus.CorrelatedMetrics{}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+	if len(result.Signals) != 2 || result.Signals[0].Query != "worker_idle" || result.Signals[1].BestLag != "0s" {
+		t.Errorf("expected worker_idle to correlate most without lag, got %s", text)
+	}
+}
+
+func TestDetectChangepoints(t *testing.T) {
+	mcpServer := newTestServer(t, config.Policy{})
+
+	text := successText(t, callTool(t, mcpServer, "detect_changepoints", map[string]any{
+		"query": "request_latency_seconds", "step": "1m", "duration": "2h",
+	}))
+	var response struct {
+		Series []SeriesChangepoints `json:"series"`
+	}
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		t.Fatalf("invalid result %s: %v", text, err)
+	}
+	if len(response.Series) != 1 || len(response.Series[0].Changepoints) != 1 {
+		t.Fatalf("expected a single change point, got %s", text)
+	}
+
+	c := response.Series[0].Changepoints[0]
+	if math.Abs(c.Before.Mean-0.1) > 1e-9 || math.Abs(c.After.Mean-0.5) > 1e-9 || math.Abs(c.MeanChange-0.4) > 1e-9 {
+		t.Errorf("expected the latency to step from 0.1 to 0.5, got %s", text)
+	}
+	if ago := time.Since(c.Time); ago < 55*time.Minute || ago > 65*time.Minute {
+		t.Errorf("expected the change about an hour ago, got %s", text)
+	}
+
+	result := callTool(t, mcpServer, "detect_changepoints", map[string]any{
+		"query": "request_latency_seconds", "step": "1m", "duration": "2h", "min_segment": 1,
+	})
+	if !result.IsError {
+		t.Errorf("expected min_segment to be rejected, got %s", resultText(t, result))
+	}
+}
@@ -0,0 +1,206 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/history"
+	"github.com/inecas/obs-mcp/pkg/prometheus"
+	"github.com/inecas/obs-mcp/pkg/promql"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+)
+
+// queryHistoryURI is the resource holding the query history of the session.
+const queryHistoryURI = "obs-mcp://query-history"
+
+type historyKey struct{}
+
+// withHistory makes store available to handler, which records the queries
+// it runs.
+func withHistory(store *history.Store, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return handler(context.WithValue(ctx, historyKey{}, store), req)
+	}
+}
+
+// sessionHistory returns the history store and the ID of the session of the
+// call, if the server keeps a history.
+func sessionHistory(ctx context.Context) (*history.Store, string, bool) {
+	store, ok := ctx.Value(historyKey{}).(*history.Store)
+	session := server.ClientSessionFromContext(ctx)
+	if !ok || session == nil {
+		return nil, "", false
+	}
+	return store, session.SessionID(), true
+}
+
+// recordQuery adds a successful range query to the history of the session
+// and returns its index, or 0 when no history is kept.
+func recordQuery(ctx context.Context, datasource string, params *rangeQueryParams, series int) int {
+	store, sessionID, ok := sessionHistory(ctx)
+	if !ok {
+		return 0
+	}
+	entry := store.Add(sessionID, history.Entry{
+		Tool:       policyFrom(ctx).tool,
+		Datasource: datasource,
+		Query:      params.query,
+		Start:      params.start.UTC(),
+		End:        params.end.UTC(),
+		Step:       model.Duration(params.step).String(),
+		Options:    params.options,
+		ExecutedAt: time.Now().UTC(),
+		Series:     series,
+	})
+	return entry.Index
+}
+
+// matrixLength returns the number of series of a range query response.
+func matrixLength(response map[string]any) int {
+	matrix, _ := response["result"].(model.Matrix)
+	return len(matrix)
+}
+
+func RerunQueryHandler(datasources *prometheus.Datasources) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		store, sessionID, ok := sessionHistory(ctx)
+		if !ok {
+			return mcp.NewToolResultError("the query history is not available in this session"), nil
+		}
+
+		index, err := req.RequireInt("index")
+		if err != nil {
+			return mcp.NewToolResultError("index parameter is required and must be a number"), nil
+		}
+		entry, err := store.Get(sessionID, index)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		params, err := rerunParams(ctx, req, entry)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ctx = prometheus.WithQueryOptions(ctx, params.options)
+
+		datasourceName := req.GetString("datasource", entry.Datasource)
+		ds, err := datasources.Get(datasourceName)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		result, err := ds.Client.ExecuteRangeQuery(ctx, params.query, params.start, params.end, params.step)
+		if err != nil {
+			return queryErrorResult("execute range query", err, params.queryContext()), nil
+		}
+
+		result["query"] = params.query
+		result["start"] = params.start.UTC()
+		result["end"] = params.end.UTC()
+		result["step"] = model.Duration(params.step).String()
+		result["rerunOf"] = entry.Index
+		result["historyIndex"] = recordQuery(ctx, datasourceName, params, matrixLength(result))
+
+		jsonResult, err := json.Marshal(result)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+		}
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+}
+
+// rerunParams derives the parameters of a re-run from the history entry and
+// the overrides of the call: a new range, a shift of the original range, a
+// new step, additional label matchers or other query options. Query options
+// which are not overridden are those of the original query.
+func rerunParams(ctx context.Context, req mcp.CallToolRequest, entry history.Entry) (*rangeQueryParams, error) {
+	params := &rangeQueryParams{query: entry.Query, start: entry.Start, end: entry.End}
+
+	var err error
+	args := req.GetArguments()
+	if args["start"] != nil || args["end"] != nil || args["duration"] != nil {
+		params.start, params.end, err = parseRange(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if shift := req.GetString("shift", ""); shift != "" {
+		negative := shift[0] == '-'
+		if negative || shift[0] == '+' {
+			shift = shift[1:]
+		}
+		offset, err := prometheus.ParseDuration(shift)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shift format: %s", err.Error())
+		}
+		if negative {
+			offset = -offset
+		}
+		params.start, params.end = params.start.Add(offset), params.end.Add(offset)
+	}
+
+	step := req.GetString("step", entry.Step)
+	if params.step, err = prometheus.ParseDuration(step); err != nil {
+		return nil, fmt.Errorf("invalid step format: %s", err.Error())
+	}
+
+	matchers, err := getLabelMatchers(req, "matchers")
+	if err != nil {
+		return nil, err
+	}
+	if len(matchers) > 0 {
+		if params.query, err = promql.AddMatchers(params.query, matchers); err != nil {
+			return nil, fmt.Errorf("failed to add matchers to %s: %w", params.query, err)
+		}
+	}
+
+	if err := checkRange(ctx, "range", params.end.Sub(params.start)); err != nil {
+		return nil, err
+	}
+	if err := checkStep(ctx, params.step); err != nil {
+		return nil, err
+	}
+	if params.options, err = parseQueryOptions(req); err != nil {
+		return nil, err
+	}
+	if _, ok := args["dedup"]; !ok {
+		params.options.Dedup = entry.Options.Dedup
+	}
+	if _, ok := args["partial_response"]; !ok {
+		params.options.PartialResponse = entry.Options.PartialResponse
+	}
+	if _, ok := args["max_source_resolution"]; !ok && entry.Options.MaxSourceResolution != "" {
+		params.options.MaxSourceResolution = entry.Options.MaxSourceResolution
+	}
+	return params, nil
+}
+
+// CreateQueryHistoryResource describes the query history of the session.
+func CreateQueryHistoryResource() mcp.Resource {
+	return mcp.NewResource(queryHistoryURI, "Query history",
+		mcp.WithResourceDescription("The range queries run in this session, oldest first, with the index rerun_query takes"),
+		mcp.WithMIMEType("application/json"),
+	)
+}
+
+func QueryHistoryResourceHandler(store *history.Store) server.ResourceHandlerFunc {
+	return func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		entries := []history.Entry{}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			entries = store.List(session.SessionID())
+		}
+		content, err := json.Marshal(entries)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{mcp.TextResourceContents{
+			URI:      queryHistoryURI,
+			MIMEType: "application/json",
+			Text:     string(content),
+		}}, nil
+	}
+}
@@ -0,0 +1,172 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/auth"
+	"github.com/inecas/obs-mcp/pkg/metrics"
+	"github.com/inecas/obs-mcp/pkg/progress"
+	"github.com/inecas/obs-mcp/pkg/ratelimit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// errorCodeMetaKey is the _meta field of failed tool results holding the
+// error code of the failure.
+const errorCodeMetaKey = "errorCode"
+
+// Error classes of failed tool calls that carry no error code.
+const (
+	errorClassTool     = "TOOL_ERROR"
+	errorClassInternal = "INTERNAL_ERROR"
+)
+
+// errCodeRateLimited is the error code of the calls rejected by the rate
+// limit of this server, unlike the codes of upstream failures classified by
+// prometheus.ClassifyError.
+const errCodeRateLimited = "RATE_LIMITED"
+
+// loggingMiddleware logs a record for every tool call. The arguments are only
+// logged as a hash, so that queries can be correlated without being disclosed.
+func loggingMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, req)
+
+		attrs := []any{
+			"tool", req.Params.Name,
+			"args_hash", argumentsHash(req),
+			"duration", time.Since(start),
+			"result_size", resultSize(result),
+		}
+		if datasource := req.GetString("datasource", ""); datasource != "" {
+			attrs = append(attrs, "datasource", datasource)
+		}
+		if identity, ok := auth.IdentityFrom(ctx); ok {
+			attrs = append(attrs, "user", identity.Username)
+		}
+
+		switch class := errorClass(result, err); {
+		case err != nil:
+			slog.ErrorContext(ctx, "Tool call failed", append(attrs, "error_class", class, "error", err)...)
+		case class != "":
+			slog.WarnContext(ctx, "Tool call returned an error", append(attrs, "error_class", class)...)
+		default:
+			slog.InfoContext(ctx, "Tool call", attrs...)
+		}
+		return result, err
+	}
+}
+
+func argumentsHash(req mcp.CallToolRequest) string {
+	// Maps are marshaled with sorted keys, so equal arguments hash the same
+	args, err := json.Marshal(req.GetArguments())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(args)
+	return hex.EncodeToString(sum[:8])
+}
+
+// resultSize returns the size of the result content in bytes.
+func resultSize(result *mcp.CallToolResult) int {
+	if result == nil {
+		return 0
+	}
+	size := 0
+	for _, content := range result.Content {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			size += len(c.Text)
+		case mcp.ImageContent:
+			size += len(c.Data)
+		}
+	}
+	return size
+}
+
+// errorClass returns the class of a failed tool call, or an empty string if
+// the call succeeded.
+func errorClass(result *mcp.CallToolResult, err error) string {
+	switch {
+	case err != nil:
+		return errorClassInternal
+	case result == nil || !result.IsError:
+		return ""
+	case result.Meta != nil:
+		if code, ok := result.Meta.AdditionalFields[errorCodeMetaKey].(string); ok {
+			return code
+		}
+	}
+	return errorClassTool
+}
+
+// metricsMiddleware counts tool calls by outcome and measures their duration
+// and result size.
+func metricsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, req)
+
+		outcome := errorClass(result, err)
+		if outcome == "" {
+			outcome = metrics.OutcomeSuccess
+		}
+		metrics.ObserveToolCall(req.Params.Name, outcome, time.Since(start), resultSize(result))
+		return result, err
+	}
+}
+
+// rateLimitMiddleware rejects the calls of clients exceeding their rate
+// limit, telling them when to retry.
+func rateLimitMiddleware(limiter *ratelimit.Limiter) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			client := ratelimit.ClientKey(ctx)
+			allowed, retryAfter := limiter.Allow(client, time.Now())
+			if allowed {
+				return next(ctx, req)
+			}
+
+			metrics.ObserveRejectedQuery(req.Params.Name, metrics.RejectedRateLimit)
+			retryAfter = retryAfter.Round(100 * time.Millisecond)
+			result := mcp.NewToolResultError(fmt.Sprintf("rate limit exceeded for %s: the server allows %s\nerror_code: %s\nhint: retry after %s; avoid calling tools in a tight loop",
+				client, limiter, errCodeRateLimited, retryAfter))
+			result.Meta = &mcp.Meta{AdditionalFields: map[string]any{
+				errorCodeMetaKey:    errCodeRateLimited,
+				"retryAfterSeconds": retryAfter.Seconds(),
+			}}
+			return result, nil
+		}
+	}
+}
+
+// progressMiddleware sends the progress reported by tools as MCP progress
+// notifications, when the client asked for them with a progress token.
+func progressMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		mcpServer := server.ServerFromContext(ctx)
+		if req.Params.Meta == nil || req.Params.Meta.ProgressToken == nil || mcpServer == nil {
+			return next(ctx, req)
+		}
+
+		token := req.Params.Meta.ProgressToken
+		ctx = progress.WithReporter(ctx, func(value float64, message string) {
+			err := mcpServer.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+				"progressToken": token,
+				"progress":      value,
+				"message":       message,
+			})
+			if err != nil {
+				slog.DebugContext(ctx, "Failed to send progress notification", "tool", req.Params.Name, "error", err)
+			}
+		})
+		return next(ctx, req)
+	}
+}
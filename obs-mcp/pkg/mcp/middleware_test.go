@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	"github.com/inecas/obs-mcp/pkg/promql"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+)
+
+// notificationSession is a client session collecting the notifications sent
+// to it.
+type notificationSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *notificationSession) SessionID() string { return "progress-test" }
+func (s *notificationSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+func (s *notificationSession) Initialize()       {}
+func (s *notificationSession) Initialized() bool { return true }
+
+// progressMessages returns the messages of the progress notifications
+// received so far, checking that they carry token and increasing progress.
+func (s *notificationSession) progressMessages(t *testing.T, token any) []string {
+	t.Helper()
+	var messages []string
+	last := 0.0
+	for {
+		select {
+		case n := <-s.notifications:
+			if n.Method != "notifications/progress" {
+				continue
+			}
+			params := n.Params.AdditionalFields
+			if params["progressToken"] != token {
+				t.Errorf("expected progress token %v, got %v", token, params["progressToken"])
+			}
+			if p, _ := params["progress"].(float64); p <= last {
+				t.Errorf("expected increasing progress, got %v after %v", params["progress"], last)
+			} else {
+				last = p
+			}
+			messages = append(messages, fmt.Sprint(params["message"]))
+		default:
+			return messages
+		}
+	}
+}
+
+func TestProgressNotifications(t *testing.T) {
+	datasources, library := newTestDependencies(t)
+	mcpServer := server.NewMCPServer("obs-mcp-test", "test",
+		server.WithToolCapabilities(true),
+		server.WithToolHandlerMiddleware(progressMiddleware))
+	if err := SetupTools(mcpServer, datasources, config.Policy{}, nil, library); err != nil {
+		t.Fatalf("setting up tools: %v", err)
+	}
+
+	session := &notificationSession{notifications: make(chan mcp.JSONRPCNotification, 1000)}
+	if err := mcpServer.RegisterSession(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	ctx := mcpServer.WithContext(context.Background(), session)
+
+	call := func(meta map[string]any) {
+		t.Helper()
+		params := map[string]any{"name": "investigate_alert", "arguments": map[string]any{"alertname": "HighErrorRate"}}
+		if meta != nil {
+			params["_meta"] = meta
+		}
+		request, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": params})
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, ok := mcpServer.HandleMessage(ctx, request).(mcp.JSONRPCResponse)
+		if !ok {
+			t.Fatalf("investigate_alert failed: %#v", response)
+		}
+		if result := response.Result.(mcp.CallToolResult); result.IsError {
+			t.Fatalf("investigate_alert failed: %s", resultText(t, &result))
+		}
+	}
+
+	// Without a progress token, nothing is sent
+	call(nil)
+	if messages := session.progressMessages(t, nil); len(messages) != 0 {
+		t.Errorf("expected no progress notifications, got %q", messages)
+	}
+
+	call(map[string]any{"progressToken": "investigation-1"})
+	messages := session.progressMessages(t, "investigation-1")
+	if len(messages) == 0 || !strings.HasPrefix(messages[0], "Investigating alert HighErrorRate") {
+		t.Fatalf("expected the investigation to be reported first, got %q", messages)
+	}
+
+	// Every term of the expression is reported
+	terms, err := promql.Terms(`sum by (job) (rate(http_requests_total{code="500"}[5m])) / sum by (job) (rate(http_requests_total[5m])) > 0.05`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := strings.Join(messages, "\n")
+	for i, term := range terms {
+		if want := fmt.Sprintf("Evaluating term %d of %d: %s", i+1, len(terms), term.Expr); !strings.Contains(all, want) {
+			t.Errorf("expected %q among %q", want, messages)
+		}
+	}
+}
+
+// metricValue returns the value of a counter, or the sample count of a
+// histogram, of the default registry with the given labels.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prom.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if value, ok := labels[pair.GetName()]; ok && value != pair.GetValue() {
+					continue metrics
+				}
+			}
+			if m.Histogram != nil {
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	datasources, library := newTestDependencies(t)
+	mcpServer, err := NewMCPServer(datasources, config.Policy{MaxRange: model.Duration(time.Hour)}, config.Limits{}, config.Sessions{}, library)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type sample struct {
+		name   string
+		labels map[string]string
+	}
+	samples := []sample{
+		{"obs_mcp_tool_calls_total", map[string]string{"tool": "render_graph", "outcome": "success"}},
+		{"obs_mcp_tool_calls_total", map[string]string{"tool": "render_graph", "outcome": "PARSE_ERROR"}},
+		{"obs_mcp_tool_calls_total", map[string]string{"tool": "render_graph", "outcome": errorClassTool}},
+		{"obs_mcp_tool_call_duration_seconds", map[string]string{"tool": "render_graph"}},
+		{"obs_mcp_tool_result_size_bytes", map[string]string{"tool": "render_graph"}},
+		{"obs_mcp_rejected_queries_total", map[string]string{"tool": "render_graph", "reason": "max_range"}},
+	}
+	before := make([]float64, len(samples))
+	for i, s := range samples {
+		before[i] = metricValue(t, s.name, s.labels)
+	}
+
+	successText(t, callTool(t, mcpServer, "render_graph", map[string]any{"query": "up", "step": "1m", "duration": "30m"}))
+	if result := callTool(t, mcpServer, "render_graph", map[string]any{"query": "sum(", "step": "1m", "duration": "30m"}); !result.IsError {
+		t.Fatalf("expected the invalid query to fail, got %s", resultText(t, result))
+	}
+	if result := callTool(t, mcpServer, "render_graph", map[string]any{"query": "up", "step": "1m", "duration": "1d"}); !result.IsError {
+		t.Fatalf("expected the range to be rejected, got %s", resultText(t, result))
+	}
+
+	for i, want := range []float64{1, 1, 1, 3, 3, 1} {
+		if got := metricValue(t, samples[i].name, samples[i].labels) - before[i]; got != want {
+			t.Errorf("expected %s%v to grow by %v, got %v", samples[i].name, samples[i].labels, want, got)
+		}
+	}
+
+	// The metrics are valid
+	if problems, err := testutil.GatherAndLint(prom.DefaultGatherer, "obs_mcp_tool_calls_total", "obs_mcp_rejected_queries_total"); err != nil || len(problems) > 0 {
+		t.Errorf("expected valid metrics, got %v, %v", problems, err)
+	}
+}
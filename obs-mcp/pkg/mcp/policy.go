@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	"github.com/inecas/obs-mcp/pkg/metrics"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/common/model"
+)
+
+type policyKey struct{}
+
+// toolPolicy is the policy applied to a call of tool.
+type toolPolicy struct {
+	config.Policy
+	tool string
+}
+
+// withPolicy makes the argument caps of policy available to the handler of
+// tool, which checks them while parsing its arguments.
+func withPolicy(policy config.Policy, tool string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return handler(context.WithValue(ctx, policyKey{}, toolPolicy{Policy: policy, tool: tool}), req)
+	}
+}
+
+func policyFrom(ctx context.Context) toolPolicy {
+	policy, _ := ctx.Value(policyKey{}).(toolPolicy)
+	return policy
+}
+
+// checkRange rejects queries covering more than the maximum range of the policy.
+func checkRange(ctx context.Context, name string, span time.Duration) error {
+	policy := policyFrom(ctx)
+	maxRange := time.Duration(policy.MaxRange)
+	if maxRange > 0 && span > maxRange {
+		metrics.ObserveRejectedQuery(policy.tool, metrics.RejectedMaxRange)
+		return fmt.Errorf("%s %s exceeds the maximum of %s allowed by the server policy; shorten the time range",
+			name, model.Duration(span), model.Duration(maxRange))
+	}
+	return nil
+}
+
+// checkStep rejects range queries with a finer step than the policy allows.
+func checkStep(ctx context.Context, step time.Duration) error {
+	policy := policyFrom(ctx)
+	minStep := time.Duration(policy.MinStep)
+	if minStep > 0 && step < minStep {
+		metrics.ObserveRejectedQuery(policy.tool, metrics.RejectedMinStep)
+		return fmt.Errorf("step %s is below the minimum of %s allowed by the server policy; increase step",
+			model.Duration(step), model.Duration(minStep))
+	}
+	return nil
+}
+
+// toolAllowed reports whether policy exposes tool.
+func toolAllowed(policy config.Policy, tool mcp.Tool) bool {
+	if len(policy.EnabledTools) > 0 && !slices.Contains(policy.EnabledTools, tool.Name) {
+		return false
+	}
+	if slices.Contains(policy.DisabledTools, tool.Name) {
+		return false
+	}
+	return true
+}
+
+// validateToolNames catches typos in the tool lists of policy, which would
+// otherwise silently expose or hide tools.
+func validateToolNames(policy config.Policy, tools []server.ServerTool) error {
+	known := make([]string, len(tools))
+	for i, tool := range tools {
+		known[i] = tool.Tool.Name
+	}
+	for _, name := range slices.Concat(policy.EnabledTools, policy.DisabledTools) {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown tool %q in policy, available tools: %s", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
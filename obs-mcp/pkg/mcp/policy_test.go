@@ -0,0 +1,52 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestToolAllowed(t *testing.T) {
+	tool := mcp.NewTool("execute_range_query")
+	tests := []struct {
+		name   string
+		policy config.Policy
+		want   bool
+	}{
+		{name: "no policy", want: true},
+		{name: "enabled", policy: config.Policy{EnabledTools: []string{"list_metrics", "execute_range_query"}}, want: true},
+		{name: "not enabled", policy: config.Policy{EnabledTools: []string{"list_metrics"}}},
+		{name: "disabled", policy: config.Policy{DisabledTools: []string{"execute_range_query"}}},
+		{
+			name:   "enabled and disabled",
+			policy: config.Policy{EnabledTools: []string{"execute_range_query"}, DisabledTools: []string{"execute_range_query"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toolAllowed(tt.policy, tool); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateToolNames(t *testing.T) {
+	tools := []server.ServerTool{{Tool: mcp.NewTool("list_metrics")}, {Tool: mcp.NewTool("execute_range_query")}}
+
+	if err := validateToolNames(config.Policy{EnabledTools: []string{"list_metrics"}, DisabledTools: []string{"execute_range_query"}}, tools); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, policy := range []config.Policy{
+		{EnabledTools: []string{"list_metric"}},
+		{DisabledTools: []string{"execute_query"}},
+	} {
+		err := validateToolNames(policy, tools)
+		if err == nil || !strings.Contains(err.Error(), "list_metrics, execute_range_query") {
+			t.Errorf("expected the unknown tool of %+v to be rejected with the available ones, got %v", policy, err)
+		}
+	}
+}
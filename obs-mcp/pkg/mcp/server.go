@@ -1,37 +1,95 @@
 package mcp
 
 import (
+	"context"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	"github.com/inecas/obs-mcp/pkg/history"
 	"github.com/inecas/obs-mcp/pkg/prometheus"
+	"github.com/inecas/obs-mcp/pkg/ratelimit"
+	"github.com/inecas/obs-mcp/pkg/templates"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func NewMCPServer(promClient *prometheus.PrometheusClient) (*server.MCPServer, error) {
-	mcpServer := server.NewMCPServer(
-		"obs-mcp",
-		"1.0.0",
+func NewMCPServer(datasources *prometheus.Datasources, policy config.Policy, limits config.Limits, sessions config.Sessions, library *templates.Library) (*server.MCPServer, error) {
+	var store *history.Store
+	if sessions.Stateful {
+		store = history.NewStore(sessions.HistorySize())
+	}
+
+	options := []server.ServerOption{
 		server.WithLogging(),
 		server.WithToolCapabilities(true),
-	)
+		server.WithToolHandlerMiddleware(loggingMiddleware),
+		server.WithToolHandlerMiddleware(metricsMiddleware),
+		server.WithToolHandlerMiddleware(progressMiddleware),
+	}
+	if limits.RateLimit > 0 {
+		limiter := ratelimit.NewLimiter(limits.RateLimit, limits.Burst())
+		options = append(options, server.WithToolHandlerMiddleware(rateLimitMiddleware(limiter)))
+	}
+
+	if store != nil {
+		// Forget the history of closed sessions
+		hooks := &server.Hooks{}
+		hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+			store.Remove(session.SessionID())
+		})
+		options = append(options, server.WithResourceCapabilities(false, false), server.WithHooks(hooks))
+	}
+
+	mcpServer := server.NewMCPServer("obs-mcp", "1.0.0", options...)
 
-	if err := SetupTools(mcpServer, promClient); err != nil {
+	if err := SetupTools(mcpServer, datasources, policy, store, library); err != nil {
 		return nil, err
 	}
+	if store != nil {
+		mcpServer.AddResource(CreateQueryHistoryResource(), QueryHistoryResourceHandler(store))
+	}
 
 	return mcpServer, nil
 }
 
-func SetupTools(mcpServer *server.MCPServer, promClient *prometheus.PrometheusClient) error {
-	// Create tool definitions
-	listMetricsTool := CreateListMetricsTool()
-	executeRangeQueryTool := CreateExecuteRangeQueryTool()
+// SetupTools registers the tools permitted by policy. The tools record their
+// queries in store, or keep no history when it is nil, and run the query
+// templates of library.
+func SetupTools(mcpServer *server.MCPServer, datasources *prometheus.Datasources, policy config.Policy, store *history.Store, library *templates.Library) error {
+	tools := []server.ServerTool{
+		{Tool: CreateListDatasourcesTool(), Handler: ListDatasourcesHandler(datasources)},
+		{Tool: CreateListMetricsTool(), Handler: withDatasource(datasources, ListMetricsHandler)},
+		{Tool: CreateExecuteRangeQueryTool(), Handler: withDatasource(datasources, ExecuteRangeQueryHandler)},
+		{Tool: CreateCardinalityReportTool(), Handler: withDatasource(datasources, CardinalityReportHandler)},
+		{Tool: CreateExplainPromQLTool(), Handler: ExplainPromQLHandler()},
+		{Tool: CreateRenderGraphTool(), Handler: withDatasource(datasources, RenderGraphHandler)},
+		{Tool: CreateInvestigateAlertTool(), Handler: withDatasource(datasources, InvestigateAlertHandler)},
+		{Tool: CreateBuildQueryTool(), Handler: withDatasource(datasources, BuildQueryHandler)},
+		{Tool: CreateRerunQueryTool(), Handler: RerunQueryHandler(datasources)},
+		{Tool: CreateTopWorkloadsTool(), Handler: withDatasource(datasources, TopWorkloadsHandler)},
+		{Tool: CreateSLOReportTool(), Handler: withDatasource(datasources, SLOReportHandler)},
+		{Tool: CreateForecastTool(), Handler: withDatasource(datasources, ForecastHandler)},
+		{Tool: CreateFindCorrelatedMetricsTool(), Handler: withDatasource(datasources, FindCorrelatedMetricsHandler)},
+		{Tool: CreateDetectChangepointsTool(), Handler: withDatasource(datasources, DetectChangepointsHandler)},
+		{Tool: CreateListQueryTemplatesTool(), Handler: ListQueryTemplatesHandler(library)},
+		{Tool: CreateRunQueryTemplateTool(library), Handler: withDatasource(datasources, RunQueryTemplateHandler(library))},
+	}
 
-	// Create handlers
-	listMetricsHandler := ListMetricsHandler(promClient)
-	executeRangeQueryHandler := ExecuteRangeQueryHandler(promClient)
+	if err := validateToolNames(policy, tools); err != nil {
+		return err
+	}
 
-	// Add tools to server
-	mcpServer.AddTool(listMetricsTool, listMetricsHandler)
-	mcpServer.AddTool(executeRangeQueryTool, executeRangeQueryHandler)
+	// Add the permitted tools to server
+	for _, tool := range tools {
+		if !toolAllowed(policy, tool.Tool) {
+			continue
+		}
+		handler := tool.Handler
+		if store != nil {
+			handler = withHistory(store, handler)
+		} else if tool.Tool.Name == "rerun_query" {
+			continue
+		}
+		mcpServer.AddTool(tool.Tool, withPolicy(policy, tool.Tool.Name, handler))
+	}
 
 	return nil
 }
@@ -0,0 +1,70 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/inecas/obs-mcp/pkg/prometheus"
+	"github.com/inecas/obs-mcp/pkg/templates"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func ListQueryTemplatesHandler(library *templates.Library) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := json.Marshal(library.List())
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal templates: %s", err.Error())), nil
+		}
+		return mcp.NewToolResultText(string(result)), nil
+	}
+}
+
+func RunQueryTemplateHandler(library *templates.Library) func(*prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(promClient *prometheus.PrometheusClient) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError("name parameter is required and must be a string"), nil
+			}
+			tmpl, err := library.Get(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			args := map[string]any{}
+			if raw, ok := req.GetArguments()["parameters"]; ok && raw != nil {
+				if args, ok = raw.(map[string]any); !ok {
+					return mcp.NewToolResultError("parameters must be an object"), nil
+				}
+			}
+			query, err := tmpl.Render(args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			params, err := parseTimeRangeParams(ctx, req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			params.query = query
+			ctx = prometheus.WithQueryOptions(ctx, params.options)
+
+			result, err := promClient.ExecuteRangeQuery(ctx, query, params.start, params.end, params.step)
+			if err != nil {
+				return queryErrorResult("execute range query", err, params.queryContext()), nil
+			}
+			result["template"] = name
+			result["query"] = query
+			if index := recordQuery(ctx, req.GetString("datasource", ""), params, matrixLength(result)); index > 0 {
+				result["historyIndex"] = index
+			}
+
+			jsonResult, err := json.Marshal(result)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %s", err.Error())), nil
+			}
+			return mcp.NewToolResultText(string(jsonResult)), nil
+		}
+	}
+}
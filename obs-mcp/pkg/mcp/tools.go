@@ -1,12 +1,31 @@
 package mcp
 
 import (
+	"strings"
+
+	"github.com/inecas/obs-mcp/pkg/forecast"
+	"github.com/inecas/obs-mcp/pkg/prometheus"
+	"github.com/inecas/obs-mcp/pkg/promql"
+	"github.com/inecas/obs-mcp/pkg/stats"
+	"github.com/inecas/obs-mcp/pkg/templates"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
 func CreateListMetricsTool() mcp.Tool {
-	tool := mcp.NewTool("list_metrics",
+	return withDatasourceParam(mcp.NewTool("list_metrics",
 		mcp.WithDescription("List all available metrics in Prometheus"),
+		withAnnotations("List metrics", timeDependent),
+	))
+}
+
+func CreateListDatasourcesTool() mcp.Tool {
+	tool := mcp.NewTool("list_datasources",
+		mcp.WithDescription(`List the Prometheus compatible datasources this server can query.
+
+Pass the name of one of them as the 'datasource' argument of the other tools to
+query it instead of the default datasource.
+`),
+		withAnnotations("List datasources", idempotent),
 	)
 	// workaround for tool with no parameter
 	// see https://github.com/containers/kubernetes-mcp-server/pull/341/files#diff-8f8a99cac7a7cbb9c14477d40539efa1494b62835603244ba9f10e6be1c7e44c
@@ -16,7 +35,7 @@ func CreateListMetricsTool() mcp.Tool {
 }
 
 func CreateExecuteRangeQueryTool() mcp.Tool {
-	return mcp.NewTool("execute_range_query",
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("execute_range_query",
 		mcp.WithDescription(`Execute a PromQL range query with flexible time specification.
 
 For current time data queries, use only the 'duration' parameter to specify how far back
@@ -24,7 +43,76 @@ to look from now (e.g., '1h' for last hour, '30m' for last 30 minutes). In that
 YOU MUST NOT provide neither 'start' NOR 'end' at all.
 
 For historical data queries, use explicit 'start' and 'end' times.
+
+When the result is empty, the response explains which label matcher eliminated every
+series and suggests the closest existing label values.
+`),
+		withAnnotations("Execute range query", timeDependent),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("PromQL query string"),
+		),
+		mcp.WithString("step",
+			mcp.Required(),
+			mcp.Description("Query resolution step width (e.g., '15s', '1m', '1h')"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time: RFC3339, Unix timestamp in seconds or milliseconds, date or local time with optional time zone ('2025-03-01 09:00 Europe/Prague'), or relative ('now-2h', 'now-1d/d') (optional)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time, in the same formats as start, e.g. 'now' or 'now/d' (optional)"),
+		),
+		mcp.WithString("duration",
+			mcp.Description("Duration to look back from now (e.g., '1h', '30m', '1d12h', '2w') (optional)"),
+		),
+	)))
+}
+
+func CreateCardinalityReportTool() mcp.Tool {
+	return withDatasourceParam(mcp.NewTool("cardinality_report",
+		mcp.WithDescription(`Report the cardinality of the Prometheus TSDB head block.
+
+Returns the metrics with the most series, the label names with the most values,
+the memory used by each label name and the label/value pairs with the most series.
+Use it to find out which metrics or labels cause a cardinality explosion.
+`),
+		withAnnotations("Cardinality report", timeDependent),
+		mcp.WithString("metric",
+			mcp.Description("Regular expression (RE2, fully anchored) to filter the metric names, e.g. 'kube_.*' (optional)"),
+		),
+		mcp.WithString("label",
+			mcp.Description("Regular expression (RE2, fully anchored) to filter the label names and the label/value pairs by their label, e.g. 'pod|namespace' (optional)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries returned per section (default 10) (optional)"),
+		),
+	))
+}
+
+func CreateExplainPromQLTool() mcp.Tool {
+	return mcp.NewTool("explain_promql",
+		mcp.WithDescription(`Explain in plain English what a PromQL expression computes.
+
+Returns a step-by-step walk through the expression (selectors, range functions,
+aggregations, binary operator matching, offsets) and the label set the result
+series will have. The query is only parsed, never executed.
+`),
+		withAnnotations("Explain PromQL", idempotent),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("PromQL query string"),
+		),
+	)
+}
+
+func CreateRenderGraphTool() mcp.Tool {
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("render_graph",
+		mcp.WithDescription(`Execute a PromQL range query and render the result as a line chart image.
+
+Accepts the same time specification as execute_range_query. Use it when the user
+wants to see a graph and the client cannot plot the raw numbers by itself.
 `),
+		withAnnotations("Render graph", timeDependent),
 		mcp.WithString("query",
 			mcp.Required(),
 			mcp.Description("PromQL query string"),
@@ -34,13 +122,497 @@ For historical data queries, use explicit 'start' and 'end' times.
 			mcp.Description("Query resolution step width (e.g., '15s', '1m', '1h')"),
 		),
 		mcp.WithString("start",
-			mcp.Description("Start time as RFC3339 or Unix timestamp (optional)"),
+			mcp.Description("Start time: RFC3339, Unix timestamp in seconds or milliseconds, date or local time with optional time zone ('2025-03-01 09:00 Europe/Prague'), or relative ('now-2h', 'now-1d/d') (optional)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time, in the same formats as start, e.g. 'now' or 'now/d' (optional)"),
+		),
+		mcp.WithString("duration",
+			mcp.Description("Duration to look back from now (e.g., '1h', '30m', '1d12h', '2w') (optional)"),
+		),
+		mcp.WithString("title",
+			mcp.Description("Chart title, defaults to the query (optional)"),
+		),
+		mcp.WithString("unit",
+			mcp.Description("Unit of the values used to format the y axis: 'bytes', 'seconds', 'percent' (0-100), 'percentunit' (0-1) or any custom unit name (optional)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Image format (optional)"),
+			mcp.Enum("png", "svg"),
+			mcp.DefaultString("png"),
+		),
+		mcp.WithNumber("width",
+			mcp.Description("Image width in pixels (default 800) (optional)"),
+		),
+		mcp.WithNumber("height",
+			mcp.Description("Plot height in pixels, excluding the legend (default 400) (optional)"),
+		),
+	)))
+}
+
+func CreateInvestigateAlertTool() mcp.Tool {
+	return withDatasourceParam(mcp.NewTool("investigate_alert",
+		mcp.WithDescription(`Investigate why an alert fired.
+
+Finds the alerting rule, then evaluates its expression and each of its terms (the
+operands of its comparisons and arithmetic) over a window around the firing time,
+so that it is clear which term crossed the threshold. Also returns the rule labels,
+annotations, runbook URL, currently active alerts and the firing history from the
+ALERTS series.
+`),
+		withAnnotations("Investigate alert", timeDependent),
+		mcp.WithString("alertname",
+			mcp.Required(),
+			mcp.Description("Name of the alert (the alertname label)"),
+		),
+		mcp.WithObject("labels",
+			mcp.Description("Labels identifying the alert instance, e.g. {\"namespace\": \"openshift-monitoring\", \"pod\": \"prometheus-k8s-0\"} (optional)"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("time",
+			mcp.Description("Time the alert fired, in the same formats as the start of execute_range_query (e.g. RFC3339 or 'now-3h'); defaults to the active alert or the latest firing in the history (optional)"),
+		),
+		mcp.WithString("window",
+			mcp.Description("How far before and after the firing time to evaluate the expression (default '1h') (optional)"),
+		),
+		mcp.WithString("history",
+			mcp.Description("How far back to look for previous firings (default '1d') (optional)"),
+		),
+	))
+}
+
+func CreateBuildQueryTool() mcp.Tool {
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("build_query",
+		mcp.WithDescription(`Build a valid, formatted PromQL expression from structured input and optionally run it.
+
+The expression has the form: aggregation by (labels) (range_function(metric{matchers}[window])) comparison threshold.
+Prefer this tool over writing PromQL by hand. With range_function 'auto' (the default) the metric
+metadata decides: counters and histogram buckets get rate(), gauges are selected as they are.
+
+Set 'execute' to true to also run the expression as a range query, using the same time
+parameters as execute_range_query.
+`),
+		withAnnotations("Build query", timeDependent),
+		mcp.WithString("metric",
+			mcp.Required(),
+			mcp.Description("Metric name"),
+		),
+		mcp.WithArray("matchers",
+			mcp.Description("Label matchers (optional)"),
+			mcp.Items(labelMatcherSchema),
+		),
+		mcp.WithString("range_function",
+			mcp.Description("Function applied over the window: 'auto' (default), 'none' or one of "+strings.Join(promql.RangeFunctions, ", ")+" (optional)"),
+		),
+		mcp.WithString("window",
+			mcp.Description("Range window for the range function (default '5m') (optional)"),
+		),
+		mcp.WithString("aggregation",
+			mcp.Description("Aggregation operator (optional)"),
+			mcp.Enum(promql.Aggregations...),
+		),
+		mcp.WithNumber("aggregation_param",
+			mcp.Description("Parameter of topk, bottomk (k) and quantile (0-1) (optional)"),
+		),
+		mcp.WithArray("by",
+			mcp.Description("Labels to aggregate by (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("without",
+			mcp.Description("Labels to aggregate away (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("comparison",
+			mcp.Description("Comparison operator applied with the threshold (optional)"),
+			mcp.Enum(promql.ComparisonOperators...),
+		),
+		mcp.WithNumber("threshold",
+			mcp.Description("Threshold compared against (optional)"),
+		),
+		mcp.WithBoolean("execute",
+			mcp.Description("Run the built expression as a range query (default false) (optional)"),
+		),
+		mcp.WithString("step",
+			mcp.Description("Query resolution step width, required when execute is true (e.g., '15s', '1m', '1h')"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time: RFC3339, Unix timestamp in seconds or milliseconds, date or local time with optional time zone ('2025-03-01 09:00 Europe/Prague'), or relative ('now-2h', 'now-1d/d') (optional)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time, in the same formats as start, e.g. 'now' or 'now/d' (optional)"),
+		),
+		mcp.WithString("duration",
+			mcp.Description("Duration to look back from now (e.g., '1h', '30m', '1d12h', '2w') (optional)"),
+		),
+	)))
+}
+
+// labelMatcherSchema is the schema of the items of label matcher arguments.
+var labelMatcherSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"label": map[string]any{"type": "string", "description": "Label name"},
+		"op":    map[string]any{"type": "string", "enum": promql.MatchOperators, "description": "Match operator, defaults to '='"},
+		"value": map[string]any{"type": "string", "description": "Label value or regular expression"},
+	},
+	"required": []string{"label", "value"},
+}
+
+func CreateRerunQueryTool() mcp.Tool {
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("rerun_query",
+		mcp.WithDescription(`Re-run a range query from the history of this session, optionally changing its
+time range, step or label filters.
+
+Use it for follow-up questions such as "the same for last week" or "only for namespace X".
+Every range query run by execute_range_query, render_graph, build_query or this tool gets a
+'historyIndex'; the obs-mcp://query-history resource lists them all.
+
+Without start/end/duration the original range is reused; 'shift' moves the range, e.g. '-1w'
+for the same window a week earlier. The step, datasource and Thanos query options default to
+the original ones.
+`),
+		withAnnotations("Re-run query", timeDependent),
+		mcp.WithNumber("index",
+			mcp.Required(),
+			mcp.Description("History index of the query; negative values count back from the latest, which is -1"),
+		),
+		mcp.WithString("start",
+			mcp.Description("New start time, in the formats of execute_range_query (optional)"),
 		),
 		mcp.WithString("end",
-			mcp.Description("End time as RFC3339 or Unix timestamp (optional)"),
+			mcp.Description("New end time, in the same formats as start (optional)"),
 		),
 		mcp.WithString("duration",
-			mcp.Description("Duration to look back from now (e.g., '1h', '30m', '1d', '2w') (optional)"),
+			mcp.Description("New duration to look back from now (e.g., '1h', '7d') (optional)"),
+		),
+		mcp.WithString("shift",
+			mcp.Description("Duration to move the range by, e.g. '-1w' for a week earlier (optional)"),
+		),
+		mcp.WithString("step",
+			mcp.Description("New query resolution step width (optional)"),
 		),
+		mcp.WithArray("matchers",
+			mcp.Description("Label matchers added to every selector of the query, replacing matchers on the same labels (optional)"),
+			mcp.Items(labelMatcherSchema),
+		),
+	)))
+}
+
+func CreateListQueryTemplatesTool() mcp.Tool {
+	tool := mcp.NewTool("list_query_templates",
+		mcp.WithDescription(`List the query templates: reviewed PromQL queries for common questions, with
+their typed parameters.
+
+Prefer running a matching template with run_query_template over writing the query yourself.
+`),
+		withAnnotations("List query templates", idempotent),
 	)
+	// workaround for tool with no parameter, see CreateListDatasourcesTool
+	tool.InputSchema = mcp.ToolInputSchema{}
+	tool.RawInputSchema = []byte(`{"type":"object","properties":{}}`)
+	return tool
+}
+
+func CreateRunQueryTemplateTool(library *templates.Library) mcp.Tool {
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("run_query_template",
+		mcp.WithDescription(`Run a query template from list_query_templates as a range query.
+
+Pass the template parameters in 'parameters'; optional parameters left out take their
+defaults. The time parameters are the same as for execute_range_query.
+`),
+		withAnnotations("Run query template", timeDependent),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the template"),
+			mcp.Enum(library.Names()...),
+		),
+		mcp.WithObject("parameters",
+			mcp.Description("Template parameter values by name, as strings or numbers (optional)"),
+		),
+		mcp.WithString("step",
+			mcp.Required(),
+			mcp.Description("Query resolution step width (e.g., '15s', '1m', '1h')"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time, in the formats of execute_range_query (optional)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time, in the same formats as start (optional)"),
+		),
+		mcp.WithString("duration",
+			mcp.Description("Duration to look back from now (e.g., '1h', '30m', '1d12h', '2w') (optional)"),
+		),
+	)))
+}
+
+func CreateTopWorkloadsTool() mcp.Tool {
+	return withDatasourceParam(mcp.NewTool("top_workloads",
+		mcp.WithDescription(`Rank the pods, workloads or namespaces using the most CPU, memory, network or
+restarting the most, from the cAdvisor and kube-state-metrics series.
+
+At the workload level pods are resolved to their owners through kube_pod_owner and
+kube_replicaset_owner, so that the pods of a Deployment are summed up under the
+Deployment, and those of a ReplicaSet not owned by a Deployment under the
+ReplicaSet.
+
+Returns the ranked entries with their values and units, also formatted as a Markdown
+table, along with the query used.
+`),
+		withAnnotations("Top workloads", timeDependent),
+		mcp.WithString("resource",
+			mcp.Required(),
+			mcp.Description("Resource to rank by: CPU cores, memory working set bytes, network bytes per second received or transmitted, or container restarts"),
+			mcp.Enum(prometheus.WorkloadResources...),
+		),
+		mcp.WithString("level",
+			mcp.Description("What to rank: pods, workloads (Deployments, StatefulSets, DaemonSets, Jobs...) or namespaces (default 'pod') (optional)"),
+			mcp.Enum(prometheus.WorkloadLevels...),
+		),
+		mcp.WithString("namespace",
+			mcp.Description("Only rank within this namespace (optional)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Number of entries to return (default 10) (optional)"),
+		),
+		mcp.WithString("window",
+			mcp.Description("Rate window, or for restarts the period they are counted over (default '5m', '1h' for restarts) (optional)"),
+		),
+		mcp.WithString("time",
+			mcp.Description("Time to rank at, in the same formats as the start of execute_range_query; defaults to now (optional)"),
+		),
+	))
+}
+
+func CreateSLOReportTool() mcp.Tool {
+	return withDatasourceParam(mcp.NewTool("slo_report",
+		mcp.WithDescription(`Report how a service meets its service level objective (SLO) and how fast it
+burns its error budget.
+
+The service level indicator (SLI) is either the ratio of the 'good' and 'total' counter
+selectors, e.g. good 'http_requests_total{job="api", code!~"5.."}' and total
+'http_requests_total{job="api"}', or an 'availability' expression between 0 and 1 such as
+'up{job="api"}', which is averaged over time.
+
+Returns the SLI over the compliance window, the error budget consumed and remaining, the
+burn rates over 5m, 30m, 1h, 6h and 3d, whether the multiwindow burn rate alerts of the
+Google SRE workbook (1h/5m and 6h/30m paging, 3d/6h ticket) would fire, and when the
+budget runs out at the 1h burn rate.
+`),
+		withAnnotations("SLO report", timeDependent),
+		mcp.WithString("good",
+			mcp.Description("Series selector of the counter of good events; requires total (optional)"),
+		),
+		mcp.WithString("total",
+			mcp.Description("Series selector of the counter of all events; requires good (optional)"),
+		),
+		mcp.WithString("availability",
+			mcp.Description("Expression of the ratio of good events between 0 and 1, instead of good and total (optional)"),
+		),
+		mcp.WithNumber("objective",
+			mcp.Required(),
+			mcp.Description("Target SLI as a ratio between 0 and 1 or a percentage between 50 and 100, e.g. 0.999 or 99.9"),
+		),
+		mcp.WithString("window",
+			mcp.Description("Compliance window (default '30d') (optional)"),
+		),
+		mcp.WithString("time",
+			mcp.Description("Time to report at, in the same formats as the start of execute_range_query; defaults to now (optional)"),
+		),
+	))
+}
+
+func CreateForecastTool() mcp.Tool {
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("forecast",
+		mcp.WithDescription(`Forecast when each series of a range query crosses a threshold, e.g. when a PVC
+fills up or when node memory usage reaches 90%.
+
+Fits a least squares trend to every series over the queried range: a line, or with the
+seasonal model a line plus the daily (or other 'season') pattern. Reports the trend per
+hour, the quality of the fit, the expected crossing time and the earliest and latest
+crossing times of the prediction interval, as well as the forecast at the end of the
+horizon. Query a range long enough to show the trend, at least two seasons for the
+seasonal model.
+`),
+		withAnnotations("Forecast", timeDependent),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("PromQL query of the series to forecast, e.g. kubelet_volume_stats_used_bytes / kubelet_volume_stats_capacity_bytes"),
+		),
+		mcp.WithNumber("threshold",
+			mcp.Required(),
+			mcp.Description("Value whose crossing is forecast, e.g. 0.9"),
+		),
+		mcp.WithString("step",
+			mcp.Required(),
+			mcp.Description("Query resolution step width (e.g., '5m', '1h')"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time, in the formats of execute_range_query (optional)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time, in the same formats as start (optional)"),
+		),
+		mcp.WithString("duration",
+			mcp.Description("Duration to look back from now (e.g., '7d', '2w') (optional)"),
+		),
+		mcp.WithString("model",
+			mcp.Description("Trend model (default 'linear') (optional)"),
+			mcp.Enum(forecast.Models...),
+		),
+		mcp.WithString("season",
+			mcp.Description("Period of the seasonal model (default '1d') (optional)"),
+		),
+		mcp.WithString("horizon",
+			mcp.Description("How far past the end of the range to forecast (default '30d') (optional)"),
+		),
+		mcp.WithNumber("confidence",
+			mcp.Description("Probability covered by the prediction interval (default 0.95) (optional)"),
+		),
+	)))
+}
+
+func CreateFindCorrelatedMetricsTool() mcp.Tool {
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("find_correlated_metrics",
+		mcp.WithDescription(`Find what else moved at the same time as a target query.
+
+Correlates the target (the sum of its series) with candidate series over the range, also
+shifted in time by up to 'max_lag' in both directions, and returns the strongest positive
+or negative correlations. A positive 'bestLag' means the candidate moved before the
+target, a negative one after it.
+
+The candidates are either the given 'metrics' queries, or all metrics sharing the values
+of the 'overlap_labels' (by default namespace and pod) with the target series; the rate
+of candidate counters is used. Correlation does not imply causation: use the signals as
+leads to investigate.
+`),
+		withAnnotations("Find correlated metrics", timeDependent),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("PromQL query of the target signal"),
+		),
+		mcp.WithString("step",
+			mcp.Required(),
+			mcp.Description("Query resolution step width (e.g., '30s', '1m')"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time, in the formats of execute_range_query (optional)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time, in the same formats as start (optional)"),
+		),
+		mcp.WithString("duration",
+			mcp.Description("Duration to look back from now (e.g., '1h', '6h') (optional)"),
+		),
+		mcp.WithArray("metrics",
+			mcp.Description("Candidate PromQL queries, e.g. 'rate(container_cpu_usage_seconds_total{pod=\"x\"}[5m])'; by default candidates are found by label overlap (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("overlap_labels",
+			mcp.Description("Labels whose target values the candidate metrics must share (default ['namespace', 'pod']) (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("max_lag",
+			mcp.Description("Largest time shift tried between the target and a candidate (default '10m', '0s' for none) (optional)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Number of signals to return (default 10) (optional)"),
+		),
+	)))
+}
+
+func CreateDetectChangepointsTool() mcp.Tool {
+	return withDatasourceParam(withQueryOptionParams(mcp.NewTool("detect_changepoints",
+		mcp.WithDescription(`Find when the level or the variance of each series of a range query shifted,
+e.g. when latency started climbing.
+
+Runs the PELT change point algorithm over every series and returns the times of the
+changes with the mean, standard deviation and time span of the segments before and after
+each of them, and a score of its significance. Gradual trends show up as a sequence of
+small changes, the first of which marks their start.
+`),
+		withAnnotations("Detect change points", timeDependent),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("PromQL query of the series to analyze"),
+		),
+		mcp.WithString("step",
+			mcp.Required(),
+			mcp.Description("Query resolution step width (e.g., '1m', '5m')"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time, in the formats of execute_range_query (optional)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time, in the same formats as start (optional)"),
+		),
+		mcp.WithString("duration",
+			mcp.Description("Duration to look back from now (e.g., '6h', '1d') (optional)"),
+		),
+		mcp.WithString("change",
+			mcp.Description("Changes to detect: shifts of the level or the variance, or of the level only (default 'mean_variance') (optional)"),
+			mcp.Enum(stats.Changes...),
+		),
+		mcp.WithNumber("min_segment",
+			mcp.Description("Least number of samples between change points (default 5) (optional)"),
+		),
+		mcp.WithNumber("penalty",
+			mcp.Description("Multiplier of the cost of a change point; higher values report fewer, more significant changes (default 1) (optional)"),
+		),
+		mcp.WithNumber("max_changepoints",
+			mcp.Description("Most significant change points returned per series (default 5) (optional)"),
+		),
+	)))
+}
+
+// withQueryOptionParams adds the optional Thanos query parameters to a tool
+// running range queries.
+func withQueryOptionParams(tool mcp.Tool) mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithBoolean("dedup",
+			mcp.Description("Thanos: deduplicate series from HA replicas (querier default is true) (optional)"),
+		),
+		mcp.WithBoolean("partial_response",
+			mcp.Description("Thanos: return partial results when some stores are unavailable instead of failing; the response reports whether it was partial (optional)"),
+		),
+		mcp.WithString("max_source_resolution",
+			mcp.Description("Thanos: maximum downsampling resolution to read from; 'auto' (default) picks 5m or 1h data for ranges over 2 days (optional)"),
+			mcp.Enum("auto", "0s", "5m", "1h"),
+		),
+	}
+	for _, option := range options {
+		option(&tool)
+	}
+	return tool
+}
+
+// withDatasourceParam adds the optional datasource argument to a tool querying
+// Prometheus.
+func withDatasourceParam(tool mcp.Tool) mcp.Tool {
+	mcp.WithString("datasource",
+		mcp.Description("Name of the datasource to query, as returned by list_datasources; defaults to the default datasource (optional)"),
+	)(&tool)
+	return tool
+}
+
+// Whether the result of a tool depends only on its arguments, or also on the
+// current time and the data stored in the datasource.
+const (
+	idempotent    = true
+	timeDependent = false
+)
+
+// withAnnotations sets the MCP annotations of a tool. All the tools only read
+// from the datasources and the configuration of the server.
+func withAnnotations(title string, idempotentHint bool) mcp.ToolOption {
+	return func(tool *mcp.Tool) {
+		for _, option := range []mcp.ToolOption{
+			mcp.WithTitleAnnotation(title),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithIdempotentHintAnnotation(idempotentHint),
+			mcp.WithOpenWorldHintAnnotation(false),
+		} {
+			option(tool)
+		}
+	}
 }
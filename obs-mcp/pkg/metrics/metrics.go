@@ -0,0 +1,126 @@
+// Package metrics instruments obs-mcp itself. The metrics are registered with
+// the default Prometheus registry and served on /metrics in HTTP mode.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "obs_mcp"
+
+// OutcomeSuccess is the outcome of tool calls which did not fail; failed calls
+// are labeled with their error class.
+const OutcomeSuccess = "success"
+
+// Reasons for rejecting a query before it reaches Prometheus.
+const (
+	RejectedMaxRange  = "max_range"
+	RejectedMinStep   = "min_step"
+	RejectedRateLimit = "rate_limit"
+)
+
+var (
+	toolCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Tool calls by tool and outcome, which is 'success' or the error class of the failure.",
+	}, []string{"tool", "outcome"})
+
+	toolCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_call_duration_seconds",
+		Help:      "Duration of tool calls.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"tool"})
+
+	toolResultSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_result_size_bytes",
+		Help:      "Size of the content returned by tool calls.",
+		Buckets:   prometheus.ExponentialBuckets(256, 4, 9),
+	}, []string{"tool"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Duration of requests to the Prometheus API of datasources.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"datasource", "endpoint", "code"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result ('hit' or 'miss').",
+	}, []string{"cache", "result"})
+
+	rejectedQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_queries_total",
+		Help:      "Queries rejected before reaching Prometheus, by tool and reason.",
+	}, []string{"tool", "reason"})
+)
+
+// ObserveToolCall records a finished tool call.
+func ObserveToolCall(tool, outcome string, duration time.Duration, resultSize int) {
+	toolCalls.WithLabelValues(tool, outcome).Inc()
+	toolCallDuration.WithLabelValues(tool).Observe(duration.Seconds())
+	toolResultSize.WithLabelValues(tool).Observe(float64(resultSize))
+}
+
+// ObserveCacheLookup records a lookup in the named cache.
+func ObserveCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveRejectedQuery records a query refused by a server guard.
+func ObserveRejectedQuery(tool, reason string) {
+	rejectedQueries.WithLabelValues(tool, reason).Inc()
+}
+
+// InstrumentRoundTripper measures the requests next makes to the Prometheus
+// API of datasource.
+func InstrumentRoundTripper(datasource string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		upstreamDuration.WithLabelValues(datasource, endpoint(req.URL.Path), code).Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// endpoint names the API endpoint of path, such as "query_range", without
+// parts like label names which would make the label unbounded.
+func endpoint(path string) string {
+	_, rest, found := strings.Cut(path, "/api/v1/")
+	if !found {
+		return "other"
+	}
+	if strings.HasPrefix(rest, "label/") {
+		return "label_values"
+	}
+	return rest
+}
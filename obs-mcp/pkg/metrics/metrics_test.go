@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/query_range":            "query_range",
+		"/prometheus/api/v1/query":       "query",
+		"/api/v1/label/namespace/values": "label_values",
+		"/api/v1/status/tsdb":            "status/tsdb",
+		"/federate":                      "other",
+	}
+	for path, want := range tests {
+		if got := endpoint(path); got != want {
+			t.Errorf("endpoint(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestInstrumentRoundTripper(t *testing.T) {
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/api/v1/query" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	})
+	client := &http.Client{Transport: InstrumentRoundTripper("test-upstream", next)}
+
+	before := testutil.CollectAndCount(upstreamDuration)
+	for _, path := range []string{"/api/v1/query_range", "/api/v1/query_range", "/api/v1/query"} {
+		req := httptest.NewRequest(http.MethodGet, "http://prometheus"+path, nil)
+		req.RequestURI = ""
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	// One series per datasource, endpoint and code
+	if got := testutil.CollectAndCount(upstreamDuration) - before; got != 2 {
+		t.Errorf("expected 2 new series, got %d", got)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	ObserveToolCall("test_tool", OutcomeSuccess, 0, 10)
+	ObserveToolCall("test_tool", "PARSE_ERROR", 0, 10)
+	ObserveToolCall("test_tool", OutcomeSuccess, 0, 10)
+	if got := testutil.ToFloat64(toolCalls.WithLabelValues("test_tool", OutcomeSuccess)); got != 2 {
+		t.Errorf("expected 2 successful calls, got %v", got)
+	}
+	if got := testutil.ToFloat64(toolCalls.WithLabelValues("test_tool", "PARSE_ERROR")); got != 1 {
+		t.Errorf("expected 1 failed call, got %v", got)
+	}
+
+	ObserveRejectedQuery("test_tool", RejectedMinStep)
+	if got := testutil.ToFloat64(rejectedQueries.WithLabelValues("test_tool", RejectedMinStep)); got != 1 {
+		t.Errorf("expected 1 rejected query, got %v", got)
+	}
+
+	ObserveCacheLookup("test_cache", true)
+	ObserveCacheLookup("test_cache", false)
+	ObserveCacheLookup("test_cache", false)
+	if got := testutil.ToFloat64(cacheRequests.WithLabelValues("test_cache", "miss")); got != 2 {
+		t.Errorf("expected 2 cache misses, got %v", got)
+	}
+}
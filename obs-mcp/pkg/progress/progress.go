@@ -0,0 +1,42 @@
+// Package progress reports the steps of long-running tool calls, such as
+// dispatching an upstream query and receiving its response, to whoever
+// started the call.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SendFunc delivers a progress update. progress increases with every update.
+type SendFunc func(progress float64, message string)
+
+type reporter struct {
+	mu       sync.Mutex
+	send     SendFunc
+	progress float64
+}
+
+type reporterKey struct{}
+
+// WithReporter returns a context whose progress updates are delivered by
+// send.
+func WithReporter(ctx context.Context, send SendFunc) context.Context {
+	return context.WithValue(ctx, reporterKey{}, &reporter{send: send})
+}
+
+// Report sends a progress update formatted from format and args, if the
+// context has a reporter.
+func Report(ctx context.Context, format string, args ...any) {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return
+	}
+
+	// Updates are sent in the order of their progress
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress++
+	r.send(r.progress, fmt.Sprintf(format, args...))
+}
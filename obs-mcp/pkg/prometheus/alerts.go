@@ -0,0 +1,353 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/progress"
+	"github.com/inecas/obs-mcp/pkg/promql"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+const (
+	// investigationPoints is the number of samples each term is evaluated at.
+	investigationPoints  = 240
+	minInvestigationStep = 15 * time.Second
+
+	// maxInvestigationSeries caps the series reported per evaluated term.
+	maxInvestigationSeries = 20
+	maxHistoryPoints       = 1000
+)
+
+// AlertInvestigation describes an alerting rule and how its expression behaved
+// around the time the alert fired.
+type AlertInvestigation struct {
+	Alert            string            `json:"alert"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Rule             AlertRule         `json:"rule"`
+	RunbookURL       string            `json:"runbookURL,omitempty"`
+	Active           []*v1.Alert       `json:"activeAlerts"`
+	FiringTime       time.Time         `json:"firingTime"`
+	FiringTimeSource string            `json:"firingTimeSource"`
+	Window           TimeWindow        `json:"window"`
+	Expression       EvaluatedTerm     `json:"expression"`
+	Terms            []EvaluatedTerm   `json:"terms"`
+	History          []FiringInterval  `json:"firingHistory"`
+}
+
+// AlertRule is the alerting rule definition the investigation is based on.
+type AlertRule struct {
+	Group       string         `json:"group"`
+	File        string         `json:"file"`
+	Expression  string         `json:"expression"`
+	For         string         `json:"for,omitempty"`
+	Labels      model.LabelSet `json:"labels,omitempty"`
+	Annotations model.LabelSet `json:"annotations,omitempty"`
+	Health      v1.RuleHealth  `json:"health"`
+	LastError   string         `json:"lastError,omitempty"`
+}
+
+// TimeWindow is the range the terms were evaluated over.
+type TimeWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Step  string    `json:"step"`
+}
+
+// EvaluatedTerm summarizes the series an expression returned in the window.
+type EvaluatedTerm struct {
+	promql.Term
+	Series         []SeriesSummary `json:"series"`
+	TruncatedCount int             `json:"truncatedSeries,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// SeriesSummary describes the values of a single series in the window. NaN
+// samples are ignored by Min and Max.
+type SeriesSummary struct {
+	Labels model.Metric      `json:"labels"`
+	Min    model.SampleValue `json:"min"`
+	Max    model.SampleValue `json:"max"`
+	Last   model.SampleValue `json:"last"`
+	// AtFiring is the sample closest to the firing time.
+	AtFiring model.SampleValue `json:"atFiring"`
+	// ConditionMet reports whether AtFiring satisfies the term's condition.
+	ConditionMet *bool `json:"conditionMet,omitempty"`
+}
+
+// FiringInterval is a period in which the ALERTS series reported the alert as
+// firing.
+type FiringInterval struct {
+	Labels model.Metric `json:"labels"`
+	Start  time.Time    `json:"start"`
+	End    time.Time    `json:"end"`
+}
+
+// AlertInvestigationOptions configures InvestigateAlert.
+type AlertInvestigationOptions struct {
+	// Labels narrow down the alert instance, e.g. {"namespace": "foo"}.
+	Labels map[string]string
+	// At is the time to investigate. When zero, it is taken from the active
+	// alert or the firing history, falling back to now.
+	At time.Time
+	// Window is evaluated before and after the firing time.
+	Window time.Duration
+	// History is how far back the ALERTS series is inspected.
+	History time.Duration
+}
+
+// InvestigateAlert finds the alerting rule called name and evaluates its
+// expression, as well as each of its terms, around the firing time.
+func (p *PrometheusClient) InvestigateAlert(ctx context.Context, name string, opts AlertInvestigationOptions) (*AlertInvestigation, error) {
+	rules, err := p.Rules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rule, group, found := findAlertingRule(rules, name, opts.Labels)
+	if !found {
+		return nil, fmt.Errorf("no alerting rule named %q found", name)
+	}
+
+	now := time.Now()
+	inv := &AlertInvestigation{
+		Alert:  name,
+		Labels: opts.Labels,
+		Rule: AlertRule{
+			Group:       group.Name,
+			File:        group.File,
+			Expression:  rule.Query,
+			Labels:      rule.Labels,
+			Annotations: rule.Annotations,
+			Health:      rule.Health,
+			LastError:   rule.LastError,
+		},
+		RunbookURL: string(rule.Annotations["runbook_url"]),
+		Active:     matchingAlerts(rule.Alerts, opts.Labels),
+		Terms:      []EvaluatedTerm{},
+	}
+	if rule.Duration > 0 {
+		inv.Rule.For = model.Duration(time.Duration(rule.Duration * float64(time.Second))).String()
+	}
+
+	progress.Report(ctx, "Fetching the firing history of %s", name)
+	inv.History, err = p.firingHistory(ctx, name, opts.Labels, now.Add(-opts.History), now)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.FiringTime, inv.FiringTimeSource = firingTime(opts.At, inv.Active, rule, inv.History, now)
+
+	start := inv.FiringTime.Add(-opts.Window)
+	end := inv.FiringTime.Add(opts.Window)
+	if end.After(now) {
+		end = now
+	}
+	step := max(end.Sub(start)/investigationPoints, minInvestigationStep).Round(time.Second)
+	inv.Window = TimeWindow{Start: start, End: end, Step: model.Duration(step).String()}
+
+	terms, err := promql.Terms(rule.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rule expression: %w", err)
+	}
+
+	progress.Report(ctx, "Evaluating the expression of %s around %s", name, inv.FiringTime.UTC().Format(time.RFC3339))
+	inv.Expression = p.evaluateTerm(ctx, promql.Term{Expr: rule.Query}, opts.Labels, start, end, step, inv.FiringTime)
+	for i, term := range terms {
+		progress.Report(ctx, "Evaluating term %d of %d: %s", i+1, len(terms), term.Expr)
+		inv.Terms = append(inv.Terms, p.evaluateTerm(ctx, term, opts.Labels, start, end, step, inv.FiringTime))
+	}
+
+	return inv, nil
+}
+
+// findAlertingRule returns the rule called name, preferring rules whose
+// static labels and active alerts agree with the requested labels.
+func findAlertingRule(rules v1.RulesResult, name string, want map[string]string) (v1.AlertingRule, v1.RuleGroup, bool) {
+	var (
+		best      v1.AlertingRule
+		bestGroup v1.RuleGroup
+		bestScore = -1
+	)
+	for _, group := range rules.Groups {
+		for _, r := range group.Rules {
+			rule, ok := r.(v1.AlertingRule)
+			if !ok || rule.Name != name {
+				continue
+			}
+			if !labelsConsistent(model.Metric(rule.Labels), want) {
+				continue
+			}
+			score := 0
+			if len(matchingAlerts(rule.Alerts, want)) > 0 {
+				score++
+			}
+			if score > bestScore {
+				best, bestGroup, bestScore = rule, group, score
+			}
+		}
+	}
+	return best, bestGroup, bestScore >= 0
+}
+
+func matchingAlerts(alerts []*v1.Alert, want map[string]string) []*v1.Alert {
+	matching := []*v1.Alert{}
+	for _, alert := range alerts {
+		if labelsConsistent(model.Metric(alert.Labels), want) {
+			matching = append(matching, alert)
+		}
+	}
+	return matching
+}
+
+// labelsConsistent reports whether every wanted label that is present in
+// metric has the wanted value.
+func labelsConsistent(metric model.Metric, want map[string]string) bool {
+	for name, value := range want {
+		if v, ok := metric[model.LabelName(name)]; ok && string(v) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func firingTime(at time.Time, active []*v1.Alert, rule v1.AlertingRule, history []FiringInterval, now time.Time) (time.Time, string) {
+	if !at.IsZero() {
+		return at, "requested"
+	}
+	for _, alert := range active {
+		if alert.State == v1.AlertStateFiring {
+			return alert.ActiveAt.Add(time.Duration(rule.Duration * float64(time.Second))), "active alert"
+		}
+	}
+	if len(history) > 0 {
+		latest := history[0].Start
+		for _, interval := range history[1:] {
+			if interval.Start.After(latest) {
+				latest = interval.Start
+			}
+		}
+		return latest, "firing history"
+	}
+	return now, "now"
+}
+
+func (p *PrometheusClient) firingHistory(ctx context.Context, name string, want map[string]string, start, end time.Time) ([]FiringInterval, error) {
+	matchers := []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, "alertname", name),
+		labels.MustNewMatcher(labels.MatchEqual, "alertstate", "firing"),
+	}
+	for _, labelName := range sortedLabelNames(want) {
+		if labelName == "alertname" || labelName == "alertstate" {
+			continue
+		}
+		matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, labelName, want[labelName]))
+	}
+	selectors := make([]string, len(matchers))
+	for i, m := range matchers {
+		selectors[i] = m.String()
+	}
+	query := "ALERTS{" + strings.Join(selectors, ",") + "}"
+
+	step := max(end.Sub(start)/maxHistoryPoints, time.Minute).Round(time.Second)
+	matrix, err := p.QueryRangeMatrix(ctx, query, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching firing history: %w", err)
+	}
+	return firingIntervals(matrix, step), nil
+}
+
+// firingIntervals merges the samples of the ALERTS series into the intervals
+// the alert fired in, sorted by their start. Samples more than a step and a
+// half apart start a new interval.
+func firingIntervals(matrix model.Matrix, step time.Duration) []FiringInterval {
+	intervals := []FiringInterval{}
+	for _, stream := range matrix {
+		var current *FiringInterval
+		for _, sample := range stream.Values {
+			t := sample.Timestamp.Time()
+			if current != nil && t.Sub(current.End) <= step*3/2 {
+				current.End = t
+				continue
+			}
+			if current != nil {
+				intervals = append(intervals, *current)
+			}
+			current = &FiringInterval{Labels: stream.Metric, Start: t, End: t}
+		}
+		if current != nil {
+			intervals = append(intervals, *current)
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start.Before(intervals[j].Start) })
+	return intervals
+}
+
+func (p *PrometheusClient) evaluateTerm(ctx context.Context, term promql.Term, want map[string]string, start, end time.Time, step time.Duration, at time.Time) EvaluatedTerm {
+	evaluated := EvaluatedTerm{Term: term, Series: []SeriesSummary{}}
+
+	matrix, err := p.QueryRangeMatrix(ctx, term.Expr, start, end, step)
+	if err != nil {
+		evaluated.Error = err.Error()
+		return evaluated
+	}
+
+	for _, stream := range matrix {
+		if len(stream.Values) == 0 || !labelsConsistent(stream.Metric, want) {
+			continue
+		}
+		if len(evaluated.Series) == maxInvestigationSeries {
+			evaluated.TruncatedCount++
+			continue
+		}
+		evaluated.Series = append(evaluated.Series, summarizeSeries(stream, term.Condition, at))
+	}
+	return evaluated
+}
+
+func summarizeSeries(stream *model.SampleStream, condition *promql.Condition, at time.Time) SeriesSummary {
+	summary := SeriesSummary{
+		Labels: stream.Metric,
+		Min:    model.SampleValue(math.NaN()),
+		Max:    model.SampleValue(math.NaN()),
+		Last:   stream.Values[len(stream.Values)-1].Value,
+	}
+
+	closest := time.Duration(math.MaxInt64)
+	for _, sample := range stream.Values {
+		if d := sample.Timestamp.Time().Sub(at).Abs(); d < closest {
+			closest = d
+			summary.AtFiring = sample.Value
+		}
+		if math.IsNaN(float64(sample.Value)) {
+			continue
+		}
+		if math.IsNaN(float64(summary.Min)) || sample.Value < summary.Min {
+			summary.Min = sample.Value
+		}
+		if math.IsNaN(float64(summary.Max)) || sample.Value > summary.Max {
+			summary.Max = sample.Value
+		}
+	}
+
+	if condition != nil {
+		met := condition.Holds(float64(summary.AtFiring))
+		summary.ConditionMet = &met
+	}
+	return summary
+}
+
+func sortedLabelNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/promql"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+var historyEnd = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// firingSeries returns an ALERTS series with a sample a minute at each of the
+// minutes before historyEnd.
+func firingSeries(instance string, minutesAgo ...int) *model.SampleStream {
+	stream := &model.SampleStream{Metric: model.Metric{"alertname": "HighErrorRate", "instance": model.LabelValue(instance)}}
+	for _, ago := range minutesAgo {
+		stream.Values = append(stream.Values, model.SamplePair{
+			Timestamp: model.TimeFromUnixNano(historyEnd.Add(-time.Duration(ago) * time.Minute).UnixNano()),
+			Value:     1,
+		})
+	}
+	return stream
+}
+
+// minutes returns the minutes from from down to to.
+func minutes(from, to int) []int {
+	var m []int
+	for ago := from; ago >= to; ago-- {
+		m = append(m, ago)
+	}
+	return m
+}
+
+func TestFiringIntervals(t *testing.T) {
+	ago := func(m int) time.Time { return historyEnd.Add(-time.Duration(m) * time.Minute) }
+
+	tests := []struct {
+		name   string
+		matrix model.Matrix
+		// want are the start and end of the intervals in minutes ago.
+		want [][2]int
+	}{
+		{
+			name: "never fired",
+		},
+		{
+			name:   "still firing at the end",
+			matrix: model.Matrix{firingSeries("api-0", minutes(30, 0)...)},
+			want:   [][2]int{{30, 0}},
+		},
+		{
+			name:   "separate intervals",
+			matrix: model.Matrix{firingSeries("api-0", append(minutes(120, 100), minutes(40, 35)...)...)},
+			want:   [][2]int{{120, 100}, {40, 35}},
+		},
+		{
+			name: "several series",
+			matrix: model.Matrix{
+				firingSeries("api-0", minutes(10, 5)...),
+				firingSeries("api-1", minutes(60, 50)...),
+			},
+			want: [][2]int{{60, 50}, {10, 5}},
+		},
+		{
+			name:   "missed evaluation",
+			matrix: model.Matrix{firingSeries("api-0", 20, 19, 18, 16, 15)},
+			want:   [][2]int{{20, 18}, {16, 15}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := firingIntervals(tt.matrix, time.Minute)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d intervals, got %+v", len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				if !got[i].Start.Equal(ago(want[0])) || !got[i].End.Equal(ago(want[1])) {
+					t.Errorf("expected interval %d from %s to %s, got %+v", i, ago(want[0]), ago(want[1]), got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFiringTime(t *testing.T) {
+	now := historyEnd
+	rule := v1.AlertingRule{Duration: 300}
+	history := []FiringInterval{
+		{Start: now.Add(-2 * time.Hour), End: now.Add(-100 * time.Minute)},
+		{Start: now.Add(-40 * time.Minute), End: now},
+	}
+	active := []*v1.Alert{
+		{State: v1.AlertStatePending, ActiveAt: now.Add(-time.Minute)},
+		{State: v1.AlertStateFiring, ActiveAt: now.Add(-15 * time.Minute)},
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		active  []*v1.Alert
+		history []FiringInterval
+		want    time.Time
+		source  string
+	}{
+		{name: "requested", at: now.Add(-time.Hour), active: active, history: history, want: now.Add(-time.Hour), source: "requested"},
+		{name: "active alert", active: active, history: history, want: now.Add(-10 * time.Minute), source: "active alert"},
+		{name: "latest firing", active: active[:1], history: history, want: now.Add(-40 * time.Minute), source: "firing history"},
+		{name: "never fired", want: now, source: "now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, source := firingTime(tt.at, tt.active, rule, tt.history, now)
+			if !got.Equal(tt.want) || source != tt.source {
+				t.Errorf("expected %s from %s, got %s from %s", tt.want, tt.source, got, source)
+			}
+		})
+	}
+}
+
+func TestSummarizeSeries(t *testing.T) {
+	stream := firingSeries("api-0", 3, 2, 1, 0)
+	for i, v := range []float64{0.5, 0, 2, 1} {
+		stream.Values[i].Value = model.SampleValue(v)
+	}
+	stream.Values[1].Value = model.SampleValue(math.NaN())
+
+	summary := summarizeSeries(stream, &promql.Condition{Op: ">", Threshold: 1}, historyEnd.Add(-70*time.Second))
+	if summary.Min != 0.5 || summary.Max != 2 || summary.Last != 1 || summary.AtFiring != 2 {
+		t.Errorf("expected min 0.5, max 2, last 1 and 2 at firing, got %+v", summary)
+	}
+	if summary.ConditionMet == nil || !*summary.ConditionMet {
+		t.Errorf("expected the condition to be met at firing, got %+v", summary)
+	}
+}
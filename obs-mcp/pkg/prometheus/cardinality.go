@@ -0,0 +1,86 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// CardinalityReport summarizes the TSDB head statistics that matter when
+// hunting cardinality explosions.
+type CardinalityReport struct {
+	HeadStats                   v1.TSDBHeadStats `json:"headStats"`
+	SeriesCountByMetricName     []v1.Stat        `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []v1.Stat        `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []v1.Stat        `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []v1.Stat        `json:"seriesCountByLabelValuePair"`
+}
+
+// CardinalityFilter restricts the entries of a cardinality report. Both
+// expressions are fully anchored regular expressions; empty ones match
+// everything.
+type CardinalityFilter struct {
+	// Metric filters the metric names.
+	Metric string
+	// Label filters the label names, and the label/value pairs by their
+	// label name.
+	Label string
+}
+
+// NewCardinalityReport builds a report from a TSDB status response, keeping at
+// most limit entries per section that pass the filter.
+func NewCardinalityReport(status v1.TSDBResult, filter CardinalityFilter, limit int) (*CardinalityReport, error) {
+	metric, err := compileFilter("metric", filter.Metric)
+	if err != nil {
+		return nil, err
+	}
+	label, err := compileFilter("label", filter.Label)
+	if err != nil {
+		return nil, err
+	}
+	labelOfPair := func(pair string) string {
+		name, _, _ := strings.Cut(pair, "=")
+		return name
+	}
+
+	return &CardinalityReport{
+		HeadStats:                   status.HeadStats,
+		SeriesCountByMetricName:     filterStats(status.SeriesCountByMetricName, metric, nil, limit),
+		LabelValueCountByLabelName:  filterStats(status.LabelValueCountByLabelName, label, nil, limit),
+		MemoryInBytesByLabelName:    filterStats(status.MemoryInBytesByLabelName, label, nil, limit),
+		SeriesCountByLabelValuePair: filterStats(status.SeriesCountByLabelValuePair, label, labelOfPair, limit),
+	}, nil
+}
+
+func compileFilter(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s expression: %w", name, err)
+	}
+	return re, nil
+}
+
+// filterStats keeps the first limit stats whose name, or the part of it
+// returned by key when not nil, matches re.
+func filterStats(stats []v1.Stat, re *regexp.Regexp, key func(string) string, limit int) []v1.Stat {
+	filtered := make([]v1.Stat, 0, len(stats))
+	for _, stat := range stats {
+		if limit > 0 && len(filtered) >= limit {
+			break
+		}
+		name := stat.Name
+		if key != nil {
+			name = key(name)
+		}
+		if re != nil && !re.MatchString(name) {
+			continue
+		}
+		filtered = append(filtered, stat)
+	}
+	return filtered
+}
@@ -0,0 +1,79 @@
+package prometheus
+
+import (
+	"slices"
+	"testing"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestNewCardinalityReportFilter(t *testing.T) {
+	status := v1.TSDBResult{
+		SeriesCountByMetricName:     []v1.Stat{{Name: "kube_pod_info", Value: 30}, {Name: "up", Value: 10}},
+		LabelValueCountByLabelName:  []v1.Stat{{Name: "pod", Value: 20}, {Name: "namespace", Value: 5}},
+		MemoryInBytesByLabelName:    []v1.Stat{{Name: "pod", Value: 2000}, {Name: "namespace", Value: 100}},
+		SeriesCountByLabelValuePair: []v1.Stat{{Name: "namespace=shop", Value: 25}, {Name: "pod=web-0", Value: 3}},
+	}
+	names := func(stats []v1.Stat) []string {
+		var names []string
+		for _, stat := range stats {
+			names = append(names, stat.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name            string
+		filter          CardinalityFilter
+		metrics, labels []string
+		memory, pairs   []string
+	}{
+		{
+			name:    "none",
+			metrics: []string{"kube_pod_info", "up"},
+			labels:  []string{"pod", "namespace"},
+			memory:  []string{"pod", "namespace"},
+			pairs:   []string{"namespace=shop", "pod=web-0"},
+		},
+		{
+			name:    "metric",
+			filter:  CardinalityFilter{Metric: "kube_.*"},
+			metrics: []string{"kube_pod_info"},
+			labels:  []string{"pod", "namespace"},
+			memory:  []string{"pod", "namespace"},
+			pairs:   []string{"namespace=shop", "pod=web-0"},
+		},
+		{
+			name:    "label",
+			filter:  CardinalityFilter{Label: "namespace"},
+			metrics: []string{"kube_pod_info", "up"},
+			labels:  []string{"namespace"},
+			memory:  []string{"namespace"},
+			pairs:   []string{"namespace=shop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := NewCardinalityReport(status, tt.filter, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(report.SeriesCountByMetricName); !slices.Equal(got, tt.metrics) {
+				t.Errorf("metrics: got %v, want %v", got, tt.metrics)
+			}
+			if got := names(report.LabelValueCountByLabelName); !slices.Equal(got, tt.labels) {
+				t.Errorf("labels: got %v, want %v", got, tt.labels)
+			}
+			if got := names(report.MemoryInBytesByLabelName); !slices.Equal(got, tt.memory) {
+				t.Errorf("memory: got %v, want %v", got, tt.memory)
+			}
+			if got := names(report.SeriesCountByLabelValuePair); !slices.Equal(got, tt.pairs) {
+				t.Errorf("label/value pairs: got %v, want %v", got, tt.pairs)
+			}
+		})
+	}
+
+	if _, err := NewCardinalityReport(status, CardinalityFilter{Label: "("}, 10); err == nil {
+		t.Error("expected an invalid label expression to be rejected")
+	}
+}
@@ -3,37 +3,64 @@ package prometheus
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/inecas/obs-mcp/pkg/progress"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
 )
 
+// Backend is the part of the Prometheus HTTP API the client uses. The v1 API
+// client implements it against a live Prometheus or Thanos; the embedded
+// package implements it over fixture data.
+type Backend interface {
+	Query(ctx context.Context, query string, ts time.Time, opts ...v1.Option) (model.Value, v1.Warnings, error)
+	QueryRange(ctx context.Context, query string, r v1.Range, opts ...v1.Option) (model.Value, v1.Warnings, error)
+	LabelValues(ctx context.Context, label string, matches []string, startTime, endTime time.Time, opts ...v1.Option) (model.LabelValues, v1.Warnings, error)
+	Metadata(ctx context.Context, metric, limit string) (map[string][]v1.Metadata, error)
+	Rules(ctx context.Context) (v1.RulesResult, error)
+	TSDB(ctx context.Context, opts ...v1.Option) (v1.TSDBResult, error)
+}
+
 type PrometheusClient struct {
-	client v1.API
+	client Backend
+}
+
+// NewPrometheusClientFromBackend creates a client querying backend.
+func NewPrometheusClientFromBackend(backend Backend) *PrometheusClient {
+	return &PrometheusClient{client: backend}
 }
 
 func NewPrometheusClient(prometheusURL string) (*PrometheusClient, error) {
 	if prometheusURL == "" {
 		prometheusURL = "http://localhost:9090"
 	}
+	return newPrometheusClient(prometheusURL, nil)
+}
 
+func newPrometheusClient(prometheusURL string, roundTripper http.RoundTripper) (*PrometheusClient, error) {
 	client, err := api.NewClient(api.Config{
-		Address: prometheusURL,
+		Address:      prometheusURL,
+		RoundTripper: roundTripper,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating prometheus client: %w", err)
 	}
 
-	v1api := v1.NewAPI(client)
+	v1api := v1.NewAPI(queryOptionsClient{client})
 	return &PrometheusClient{client: v1api}, nil
 }
 
 func (p *PrometheusClient) ListMetrics(ctx context.Context) ([]string, error) {
+	progress.Report(ctx, "Fetching metric names")
 	labelValues, _, err := p.client.LabelValues(ctx, "__name__", []string{}, time.Now().Add(-time.Hour), time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("error fetching metric names: %w", err)
 	}
+	progress.Report(ctx, "Received %d metric names", len(labelValues))
 
 	metrics := make([]string, len(labelValues))
 	for i, value := range labelValues {
@@ -49,10 +76,23 @@ func (p *PrometheusClient) ExecuteRangeQuery(ctx context.Context, query string,
 		Step:  step,
 	}
 
+	opts, hasOpts := queryOptionsFrom(ctx)
+	if hasOpts {
+		opts = opts.Resolve(start, end, step)
+		ctx = WithQueryOptions(ctx, opts)
+	}
+
+	progress.Report(ctx, "Dispatched range query %s over %s with step %s", query, model.Duration(end.Sub(start)), model.Duration(step))
 	result, warnings, err := p.client.QueryRange(ctx, query, r, v1.WithTimeout(30*time.Second))
 	if err != nil {
+		progress.Report(ctx, "Range query failed: %s", query)
 		return nil, fmt.Errorf("error executing range query: %w", err)
 	}
+	if matrix, ok := result.(model.Matrix); ok {
+		progress.Report(ctx, "Prometheus responded with %d series for %s", len(matrix), query)
+	} else {
+		progress.Report(ctx, "Prometheus responded to %s", query)
+	}
 
 	response := map[string]interface{}{
 		"resultType": "matrix",
@@ -63,5 +103,93 @@ func (p *PrometheusClient) ExecuteRangeQuery(ctx context.Context, query string,
 		response["warnings"] = warnings
 	}
 
+	if hasOpts && !opts.empty() {
+		response["queryOptions"] = opts
+	}
+	// Thanos enables partial responses by default, so they are reported
+	// unless they were disabled
+	if opts.PartialResponse == nil || *opts.PartialResponse {
+		if partial := isPartialResponse(warnings); partial || opts.PartialResponse != nil {
+			response["partialResponse"] = partial
+		}
+	}
+
 	return response, nil
 }
+
+func (p *PrometheusClient) TSDBStatus(ctx context.Context, limit uint64) (v1.TSDBResult, error) {
+	var opts []v1.Option
+	if limit > 0 {
+		opts = append(opts, v1.WithLimit(limit))
+	}
+
+	progress.Report(ctx, "Fetching TSDB status")
+	result, err := p.client.TSDB(ctx, opts...)
+	if err != nil {
+		return v1.TSDBResult{}, fmt.Errorf("error fetching TSDB status: %w", err)
+	}
+	progress.Report(ctx, "Received TSDB status of %d head series", result.HeadStats.NumSeries)
+	return result, nil
+}
+
+// QueryRangeMatrix executes a range query and returns its result as a matrix.
+func (p *PrometheusClient) QueryRangeMatrix(ctx context.Context, query string, start, end time.Time, step time.Duration) (model.Matrix, error) {
+	response, err := p.ExecuteRangeQuery(ctx, query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix, ok := response["result"].(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type for range query: %T", response["result"])
+	}
+	return matrix, nil
+}
+
+func (p *PrometheusClient) Rules(ctx context.Context) (v1.RulesResult, error) {
+	progress.Report(ctx, "Fetching rules")
+	result, err := p.client.Rules(ctx)
+	if err != nil {
+		return v1.RulesResult{}, fmt.Errorf("error fetching rules: %w", err)
+	}
+	progress.Report(ctx, "Received %d rule groups", len(result.Groups))
+	return result, nil
+}
+
+// MetricType returns the type of metric as reported by the metadata API. For
+// the series of classic histograms and summaries the type of the base metric
+// is returned. It returns an empty type when no metadata is known.
+func (p *PrometheusClient) MetricType(ctx context.Context, metric string) (v1.MetricType, error) {
+	candidates := []string{metric}
+	for _, suffix := range []string{"_bucket", "_count", "_sum", "_total"} {
+		if base, found := strings.CutSuffix(metric, suffix); found {
+			candidates = append(candidates, base)
+		}
+	}
+
+	progress.Report(ctx, "Fetching metadata of %s", metric)
+	for _, name := range candidates {
+		metadata, err := p.client.Metadata(ctx, name, "1")
+		if err != nil {
+			return "", fmt.Errorf("error fetching metric metadata: %w", err)
+		}
+		if entries := metadata[name]; len(entries) > 0 {
+			return entries[0].Type, nil
+		}
+	}
+	return "", nil
+}
+
+func (p *PrometheusClient) LabelValues(ctx context.Context, label string, matches []string, start, end time.Time) ([]string, error) {
+	progress.Report(ctx, "Fetching values of label %s", label)
+	labelValues, _, err := p.client.LabelValues(ctx, label, matches, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching values of label %s: %w", label, err)
+	}
+
+	values := make([]string, len(labelValues))
+	for i, value := range labelValues {
+		values[i] = string(value)
+	}
+	return values, nil
+}
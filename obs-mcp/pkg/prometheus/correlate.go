@@ -0,0 +1,312 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/progress"
+	"github.com/inecas/obs-mcp/pkg/stats"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const (
+	// maxCorrelationCandidates caps the candidate metrics queried.
+	maxCorrelationCandidates = 30
+	// maxSeriesPerCandidate caps the series of a candidate correlated with
+	// the target.
+	maxSeriesPerCandidate = 20
+	// minCorrelationPoints is the number of samples both series need at the
+	// same times for a correlation.
+	minCorrelationPoints = 10
+	// minCorrelationRateWindow is the shortest window the rate of candidate
+	// counters is taken over.
+	minCorrelationRateWindow = 5 * time.Minute
+)
+
+// DefaultOverlapLabels are the labels candidate metrics share with the target
+// by default.
+var DefaultOverlapLabels = []string{"namespace", "pod"}
+
+// CorrelationOptions configures FindCorrelatedMetrics.
+type CorrelationOptions struct {
+	// Query is the target; the sum of its series is correlated with the
+	// candidates.
+	Query string
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+	// Metrics are the candidate queries. When empty, the candidates are the
+	// metrics sharing the values of OverlapLabels with the target series.
+	Metrics       []string
+	OverlapLabels []string
+	// MaxLag is how far the candidates are shifted in time against the
+	// target, in both directions.
+	MaxLag time.Duration
+	// Limit is the number of signals returned.
+	Limit int
+}
+
+// CorrelatedMetrics are the candidate series most correlated with a target.
+type CorrelatedMetrics struct {
+	Target string `json:"target"`
+	// Selector is the label overlap the candidate metrics were found by.
+	Selector            string             `json:"selector,omitempty"`
+	Candidates          []string           `json:"candidates"`
+	TruncatedCandidates int                `json:"truncatedCandidates,omitempty"`
+	SeriesScanned       int                `json:"seriesScanned"`
+	Signals             []CorrelatedSignal `json:"signals"`
+	Errors              []string           `json:"errors,omitempty"`
+}
+
+// CorrelatedSignal is a candidate series and its correlation with the target.
+type CorrelatedSignal struct {
+	Query  string       `json:"query"`
+	Labels model.Metric `json:"labels"`
+	// Correlation is the Pearson correlation at the same times, nil when
+	// the series overlap too little.
+	Correlation *float64 `json:"correlation"`
+	// BestLag is the shift with the strongest correlation: positive when
+	// the candidate moves before the target, negative when after it.
+	BestLag        string  `json:"bestLag"`
+	LagCorrelation float64 `json:"lagCorrelation"`
+	Points         int     `json:"points"`
+}
+
+// FindCorrelatedMetrics correlates the target query with the candidate
+// metrics, shifted by up to the maximum lag, and returns the candidate series
+// with the strongest correlation, positive or negative.
+func (p *PrometheusClient) FindCorrelatedMetrics(ctx context.Context, opts CorrelationOptions) (*CorrelatedMetrics, error) {
+	expr, err := parser.ParseExpr(opts.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Report(ctx, "Querying the target %s", opts.Query)
+	target, err := p.QueryRangeMatrix(ctx, opts.Query, opts.Start, opts.End, opts.Step)
+	if err != nil {
+		return nil, err
+	}
+	if len(target) == 0 {
+		return nil, fmt.Errorf("the target query returned no series")
+	}
+
+	result := &CorrelatedMetrics{Target: opts.Query, Candidates: slices.Clone(opts.Metrics), Signals: []CorrelatedSignal{}}
+	if len(opts.Metrics) == 0 {
+		selector := overlapSelector(target, opts.OverlapLabels)
+		if len(selector) == 0 {
+			return nil, fmt.Errorf("the target series have none of the labels %s; pass the candidate metrics explicitly",
+				strings.Join(opts.OverlapLabels, ", "))
+		}
+		result.Selector = formatSelector(selector)
+
+		progress.Report(ctx, "Finding the metrics of %s", result.Selector)
+		names, err := p.LabelValues(ctx, labels.MetricName, []string{result.Selector}, opts.Start, opts.End)
+		if err != nil {
+			return nil, err
+		}
+		names = candidateMetrics(names, targetMetrics(expr))
+		if len(names) > maxCorrelationCandidates {
+			result.TruncatedCandidates = len(names) - maxCorrelationCandidates
+			names = names[:maxCorrelationCandidates]
+		}
+
+		rateWindow := model.Duration(max(2*opts.Step, minCorrelationRateWindow))
+		result.Candidates = []string{}
+		for _, name := range names {
+			result.Candidates = append(result.Candidates, candidateQuery(name, selector, rateWindow))
+		}
+	}
+
+	targetValues := sumByTime(target)
+	lagSteps := int(opts.MaxLag / opts.Step)
+	for i, query := range result.Candidates {
+		progress.Report(ctx, "Correlating candidate %d of %d: %s", i+1, len(result.Candidates), query)
+		// The candidates are queried from earlier, to be shifted by the lag
+		matrix, err := p.QueryRangeMatrix(ctx, query, opts.Start.Add(-time.Duration(lagSteps)*opts.Step), opts.End, opts.Step)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", query, err.Error()))
+			continue
+		}
+
+		for j, stream := range matrix {
+			if j == maxSeriesPerCandidate {
+				break
+			}
+			result.SeriesScanned++
+			signal, ok := correlateSeries(targetValues, stream, lagSteps, opts.Step)
+			if !ok {
+				continue
+			}
+			signal.Query = query
+			result.Signals = append(result.Signals, signal)
+		}
+	}
+
+	sort.SliceStable(result.Signals, func(i, j int) bool {
+		return math.Abs(result.Signals[i].LagCorrelation) > math.Abs(result.Signals[j].LagCorrelation)
+	})
+	if len(result.Signals) > opts.Limit {
+		result.Signals = result.Signals[:opts.Limit]
+	}
+	return result, nil
+}
+
+// overlapSelector returns matchers selecting the values the target series
+// have for each of the overlap labels.
+func overlapSelector(target model.Matrix, overlap []string) []*labels.Matcher {
+	var matchers []*labels.Matcher
+	for _, name := range overlap {
+		var values []string
+		for _, stream := range target {
+			if value := string(stream.Metric[model.LabelName(name)]); value != "" && !slices.Contains(values, value) {
+				values = append(values, value)
+			}
+		}
+		switch len(values) {
+		case 0:
+			continue
+		case 1:
+			matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, name, values[0]))
+		default:
+			slices.Sort(values)
+			for i, value := range values {
+				values[i] = regexp.QuoteMeta(value)
+			}
+			matchers = append(matchers, labels.MustNewMatcher(labels.MatchRegexp, name, strings.Join(values, "|")))
+		}
+	}
+	return matchers
+}
+
+// targetMetrics returns the metric names selected by the target query.
+func targetMetrics(expr parser.Expr) []string {
+	var names []string
+	for _, matchers := range parser.ExtractSelectors(expr) {
+		for _, m := range matchers {
+			if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+				names = append(names, m.Value)
+			}
+		}
+	}
+	return names
+}
+
+// candidateMetrics returns the sorted metric names worth correlating: not the
+// target itself, not alerts and not histogram buckets, which are better
+// correlated through their _count and _sum.
+func candidateMetrics(names, exclude []string) []string {
+	var candidates []string
+	for _, name := range names {
+		if slices.Contains(exclude, name) || strings.HasPrefix(name, "ALERTS") || strings.HasSuffix(name, "_bucket") {
+			continue
+		}
+		candidates = append(candidates, name)
+	}
+	slices.Sort(candidates)
+	return candidates
+}
+
+// candidateQuery selects the series of metric sharing the labels of the
+// target, taking the rate of the ones named like counters.
+func candidateQuery(metric string, selector []*labels.Matcher, rateWindow model.Duration) string {
+	query := metric + formatSelector(selector)
+	for _, suffix := range []string{"_total", "_count", "_sum"} {
+		if strings.HasSuffix(metric, suffix) {
+			return fmt.Sprintf("rate(%s[%s])", query, rateWindow)
+		}
+	}
+	return query
+}
+
+// sumByTime sums the series of matrix at each timestamp.
+func sumByTime(matrix model.Matrix) map[model.Time]float64 {
+	sums := map[model.Time]float64{}
+	for _, stream := range matrix {
+		for _, sample := range stream.Values {
+			if !math.IsNaN(float64(sample.Value)) {
+				sums[sample.Timestamp] += float64(sample.Value)
+			}
+		}
+	}
+	return sums
+}
+
+// correlateSeries correlates the target with the candidate stream shifted by
+// each lag between -lagSteps and lagSteps steps. It reports false when no lag
+// leaves enough samples at the same times.
+func correlateSeries(target map[model.Time]float64, stream *model.SampleStream, lagSteps int, step time.Duration) (CorrelatedSignal, bool) {
+	candidate := make(map[model.Time]float64, len(stream.Values))
+	for _, sample := range stream.Values {
+		if !math.IsNaN(float64(sample.Value)) {
+			candidate[sample.Timestamp] = float64(sample.Value)
+		}
+	}
+
+	times := make([]model.Time, 0, len(target))
+	for t := range target {
+		times = append(times, t)
+	}
+	slices.Sort(times)
+
+	signal := CorrelatedSignal{Labels: stream.Metric}
+	found := false
+	// Lags are tried from the smallest, so that the smallest one wins among
+	// equally strong correlations
+	for _, lag := range lagOrder(lagSteps) {
+		shift := model.Time((time.Duration(lag) * step).Milliseconds())
+		var xs, ys []float64
+		for _, t := range times {
+			if v, ok := candidate[t-shift]; ok {
+				xs = append(xs, target[t])
+				ys = append(ys, v)
+			}
+		}
+		if len(xs) < minCorrelationPoints {
+			continue
+		}
+		r, ok := stats.Pearson(xs, ys)
+		if !ok {
+			continue
+		}
+
+		if lag == 0 {
+			signal.Correlation = &r
+		}
+		if !found || math.Abs(r) > math.Abs(signal.LagCorrelation)+1e-9 {
+			signal.LagCorrelation = r
+			signal.BestLag = formatLag(time.Duration(lag) * step)
+			signal.Points = len(xs)
+			found = true
+		}
+	}
+	return signal, found
+}
+
+// lagOrder returns the lags from 0 to n steps in both directions, smallest
+// first.
+func lagOrder(n int) []int {
+	lags := []int{0}
+	for i := 1; i <= n; i++ {
+		lags = append(lags, i, -i)
+	}
+	return lags
+}
+
+// formatLag formats a lag with its sign, e.g. +2m or -30s.
+func formatLag(lag time.Duration) string {
+	switch {
+	case lag > 0:
+		return "+" + model.Duration(lag).String()
+	case lag < 0:
+		return "-" + model.Duration(-lag).String()
+	}
+	return "0s"
+}
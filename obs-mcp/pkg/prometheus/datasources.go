@@ -0,0 +1,174 @@
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+	"github.com/inecas/obs-mcp/pkg/embedded"
+	"github.com/inecas/obs-mcp/pkg/metrics"
+	"github.com/inecas/obs-mcp/pkg/ratelimit"
+	"github.com/inecas/obs-mcp/pkg/traffic"
+	promconfig "github.com/prometheus/common/config"
+)
+
+// Datasource is a named Prometheus compatible API.
+type Datasource struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	Default     bool   `json:"default"`
+
+	Client *PrometheusClient `json:"-"`
+}
+
+// Datasources is the set of datasources tools can query, looked up by name.
+type Datasources struct {
+	byName      map[string]*Datasource
+	defaultName string
+}
+
+// NewDatasources creates a client for every datasource of cfg. The default
+// datasource is the one marked as such, or the first one otherwise.
+func NewDatasources(cfg *config.Config) (*Datasources, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	// All datasources share the cap on concurrent queries
+	var concurrency *ratelimit.ConcurrencyLimiter
+	if cfg.Limits.MaxConcurrentQueries > 0 {
+		queueTimeout := cfg.Limits.QueueTimeout
+		if queueTimeout == 0 {
+			queueTimeout = config.DefaultQueueTimeout
+		}
+		concurrency = ratelimit.NewConcurrencyLimiter(cfg.Limits.MaxConcurrentQueries, time.Duration(queueTimeout))
+	}
+
+	opts := clientOptions{concurrency: concurrency}
+	var err error
+	if cfg.Traffic.Record != "" {
+		if opts.recorder, err = traffic.NewRecorder(cfg.Traffic.Record); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Traffic.Replay != "" {
+		if opts.player, err = traffic.NewPlayer(cfg.Traffic.Replay); err != nil {
+			return nil, err
+		}
+	}
+
+	ds := &Datasources{byName: map[string]*Datasource{}, defaultName: cfg.Datasources[0].Name}
+	for _, dsCfg := range cfg.Datasources {
+		client, err := newDatasourceClient(dsCfg, opts)
+		if err != nil {
+			return nil, fmt.Errorf("datasource %q: %w", dsCfg.Name, err)
+		}
+		ds.byName[dsCfg.Name] = &Datasource{
+			Name:        dsCfg.Name,
+			URL:         dsCfg.URL,
+			Description: dsCfg.Description,
+			Client:      client,
+		}
+		if dsCfg.Default {
+			ds.defaultName = dsCfg.Name
+		}
+	}
+	ds.byName[ds.defaultName].Default = true
+
+	return ds, nil
+}
+
+// Get returns the datasource called name, or the default one if name is empty.
+func (d *Datasources) Get(name string) (*Datasource, error) {
+	if name == "" {
+		name = d.defaultName
+	}
+	ds, ok := d.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown datasource %q, available datasources: %s", name, strings.Join(d.Names(), ", "))
+	}
+	return ds, nil
+}
+
+// Default returns the datasource used when a tool call does not name one.
+func (d *Datasources) Default() *Datasource {
+	return d.byName[d.defaultName]
+}
+
+// Names returns the sorted names of all datasources.
+func (d *Datasources) Names() []string {
+	names := make([]string, 0, len(d.byName))
+	for name := range d.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns all datasources sorted by name.
+func (d *Datasources) List() []*Datasource {
+	list := make([]*Datasource, 0, len(d.byName))
+	for _, name := range d.Names() {
+		list = append(list, d.byName[name])
+	}
+	return list
+}
+
+// NewPrometheusClientFromConfig creates a client for dsCfg, authenticating
+// and configuring TLS as its HTTP client config describes.
+func NewPrometheusClientFromConfig(dsCfg config.DatasourceConfig) (*PrometheusClient, error) {
+	return newDatasourceClient(dsCfg, clientOptions{})
+}
+
+// clientOptions are shared by the clients of all datasources. Nil fields are
+// disabled.
+type clientOptions struct {
+	// concurrency is the cap on requests in flight.
+	concurrency *ratelimit.ConcurrencyLimiter
+	// recorder records the requests and responses.
+	recorder *traffic.Recorder
+	// player answers the requests from a recording instead of the datasource.
+	player *traffic.Player
+}
+
+// newDatasourceClient creates a client for dsCfg. Datasources with fixtures
+// are served by the embedded engine in process: they make no HTTP requests,
+// so the concurrency cap, the upstream metrics and the traffic recorder and
+// player, which all wrap the HTTP round tripper, do not apply to them.
+func newDatasourceClient(dsCfg config.DatasourceConfig, opts clientOptions) (*PrometheusClient, error) {
+	if len(dsCfg.Fixtures) > 0 {
+		backend, err := embedded.Load(dsCfg.Fixtures, embedded.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return NewPrometheusClientFromBackend(backend), nil
+	}
+
+	var roundTripper http.RoundTripper
+	var err error
+	if opts.player != nil {
+		// A replay needs neither the datasource nor its credentials
+		roundTripper, err = opts.player.RoundTripper(dsCfg.Name)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		roundTripper, err = promconfig.NewRoundTripperFromConfig(dsCfg.HTTPClientConfig, "obs-mcp-"+dsCfg.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error creating HTTP client: %w", err)
+		}
+		if opts.recorder != nil {
+			roundTripper = opts.recorder.RoundTripper(dsCfg.Name, roundTripper)
+		}
+	}
+
+	roundTripper = metrics.InstrumentRoundTripper(dsCfg.Name, roundTripper)
+	if opts.concurrency != nil {
+		roundTripper = opts.concurrency.RoundTripper(roundTripper)
+	}
+	return newPrometheusClient(dsCfg.URL, roundTripper)
+}
@@ -0,0 +1,19 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inecas/obs-mcp/pkg/config"
+)
+
+func TestNewDatasourcesValidates(t *testing.T) {
+	// As when --record is passed with a replay in the config file
+	cfg := &config.Config{
+		Datasources: []config.DatasourceConfig{{Name: "prometheus", URL: "http://localhost:9090"}},
+		Traffic:     config.Traffic{Record: t.TempDir(), Replay: t.TempDir()},
+	}
+	if _, err := NewDatasources(cfg); err == nil || !strings.Contains(err.Error(), "recorded and replayed") {
+		t.Errorf("expected recording and replaying together to be rejected, got %v", err)
+	}
+}
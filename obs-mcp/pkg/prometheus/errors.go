@@ -0,0 +1,165 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/ratelimit"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// ErrorCode is a stable identifier of a class of query failures.
+type ErrorCode string
+
+const (
+	ErrCodeParse             ErrorCode = "PARSE_ERROR"
+	ErrCodeTimeout           ErrorCode = "QUERY_TIMEOUT"
+	ErrCodeMaxResolution     ErrorCode = "MAX_RESOLUTION_EXCEEDED"
+	ErrCodeTooManySamples    ErrorCode = "TOO_MANY_SAMPLES"
+	ErrCodeBadData           ErrorCode = "BAD_DATA"
+	ErrCodeConnectionRefused ErrorCode = "CONNECTION_REFUSED"
+	ErrCodeCanceled          ErrorCode = "CANCELED"
+	ErrCodeUpstream          ErrorCode = "UPSTREAM_ERROR"
+	ErrCodeThrottled         ErrorCode = "THROTTLED"
+)
+
+// maxPointsPerSeries is the limit Prometheus enforces on range queries.
+const maxPointsPerSeries = 11000
+
+var parseErrorPosition = regexp.MustCompile(`(\d+):(\d+): parse error: (.*)`)
+
+// QueryError is a classified query failure with a hint on how to fix it.
+type QueryError struct {
+	Code    ErrorCode
+	Message string
+	Hint    string
+	// Line and Column locate parse errors in the query, starting at 1.
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// QueryContext carries the query parameters used to make hints concrete.
+// Fields which do not apply are left empty.
+type QueryContext struct {
+	Query string
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// ClassifyError maps err to an error code and a remediation hint.
+func ClassifyError(err error, qc QueryContext) *QueryError {
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		return queryErr
+	}
+
+	qe := &QueryError{Code: ErrCodeUpstream, Message: err.Error(), Err: err}
+
+	var apiErr *v1.Error
+	var parseErrs parser.ParseErrors
+	var queueErr *ratelimit.QueueTimeoutError
+	msg := err.Error()
+	switch {
+	case errors.As(err, &queueErr):
+		qe.Code = ErrCodeThrottled
+		qe.Hint = fmt.Sprintf("The server is already running its maximum of %d concurrent Prometheus queries. "+
+			"Retry after a few seconds, and avoid issuing many queries in parallel.", queueErr.MaxConcurrent)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		qe.Code = ErrCodeConnectionRefused
+		qe.Hint = "Prometheus refused the connection. Check that the datasource URL points to a running Prometheus or Thanos querier " +
+			"(and that any port-forward is still active); retrying the same call will not help until it is reachable."
+	case errors.Is(err, context.DeadlineExceeded):
+		qe.Code = ErrCodeTimeout
+		qe.Hint = timeoutHint(qc)
+	case errors.Is(err, context.Canceled):
+		qe.Code = ErrCodeCanceled
+		qe.Hint = "The request was canceled before Prometheus answered; retry if the result is still needed."
+	case errors.As(err, &parseErrs) && len(parseErrs) > 0:
+		qe.Code = ErrCodeParse
+		pos := parseErrs[0].PositionRange.StartPosInput(parseErrs[0].Query, parseErrs[0].LineOffset)
+		setParsePosition(qe, pos+": parse error: "+parseErrs[0].Err.Error(), qc.Query)
+	case strings.Contains(msg, "exceeded maximum resolution"):
+		qe.Code = ErrCodeMaxResolution
+		qe.Hint = maxResolutionHint(qc)
+	case strings.Contains(msg, "too many samples"):
+		qe.Code = ErrCodeTooManySamples
+		qe.Hint = "The query touches more samples than Prometheus allows. Shorten the time range, increase step, " +
+			"shorten range windows such as [1h], or add label matchers/aggregations so that fewer series are selected."
+	case parseErrorPosition.MatchString(msg):
+		qe.Code = ErrCodeParse
+		setParsePosition(qe, msg, qc.Query)
+	case errors.As(err, &apiErr) && apiErr.Type == v1.ErrTimeout, strings.Contains(msg, "query timed out"):
+		qe.Code = ErrCodeTimeout
+		qe.Hint = timeoutHint(qc)
+	case errors.As(err, &apiErr) && apiErr.Type == v1.ErrBadData:
+		qe.Code = ErrCodeBadData
+		qe.Hint = "Prometheus rejected the request parameters: " + apiErr.Msg +
+			". Check the query, the start/end timestamps (start must be before end) and the step."
+	case errors.As(err, &apiErr) && apiErr.Type == v1.ErrCanceled:
+		qe.Code = ErrCodeCanceled
+		qe.Hint = "Prometheus canceled the query, usually because it was shutting down or overloaded; retry later."
+	case errors.As(err, &apiErr) && apiErr.Type == v1.ErrClient && apiErr.Msg == fmt.Sprintf("client error: %d", http.StatusTooManyRequests):
+		qe.Code = ErrCodeThrottled
+		qe.Hint = "Prometheus is rate limiting the requests of this server. Retry after a while, and avoid issuing many queries in a row."
+	default:
+		qe.Hint = "Prometheus failed to answer the request; retrying may help if the failure is transient."
+	}
+	return qe
+}
+
+func setParsePosition(qe *QueryError, msg, query string) {
+	match := parseErrorPosition.FindStringSubmatch(msg)
+	if match == nil {
+		qe.Hint = "Fix the PromQL syntax; explain_promql and build_query can help."
+		return
+	}
+	qe.Line, _ = strconv.Atoi(match[1])
+	qe.Column, _ = strconv.Atoi(match[2])
+	qe.Hint = fmt.Sprintf("Fix the PromQL syntax at line %d, column %d: %s.", qe.Line, qe.Column, match[3])
+
+	lines := strings.Split(query, "\n")
+	if qe.Line >= 1 && qe.Line <= len(lines) {
+		line := lines[qe.Line-1]
+		caret := strings.Repeat(" ", max(0, min(qe.Column-1, len(line)))) + "^"
+		qe.Hint += "\n" + line + "\n" + caret
+	}
+}
+
+func maxResolutionHint(qc QueryContext) string {
+	if qc.Start.IsZero() || qc.End.IsZero() {
+		return fmt.Sprintf("The range query would return more than %d points per series; increase step or shorten the time range.", maxPointsPerSeries)
+	}
+	span := qc.End.Sub(qc.Start)
+	minStep := time.Duration(math.Ceil(span.Seconds()/maxPointsPerSeries)) * time.Second
+	return fmt.Sprintf("Increase step to at least %s: a %s range allows at most %d points per series.",
+		model.Duration(minStep), model.Duration(span), maxPointsPerSeries)
+}
+
+func timeoutHint(qc QueryContext) string {
+	hint := "The query took too long. Shorten the time range, increase step, add label matchers, or aggregate early " +
+		"(e.g. sum by (namespace) (...)) so that fewer series are processed."
+	if qc.Step > 0 && !qc.Start.IsZero() && !qc.End.IsZero() {
+		hint += fmt.Sprintf(" The failed query covered %s with step %s.", model.Duration(qc.End.Sub(qc.Start)), model.Duration(qc.Step))
+	}
+	return hint
+}
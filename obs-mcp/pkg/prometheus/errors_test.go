@@ -0,0 +1,118 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/ratelimit"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestClassifyError(t *testing.T) {
+	end := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	qc := QueryContext{Query: "sum(rate(up[5m])", Start: end.Add(-24 * time.Hour), End: end, Step: time.Second}
+
+	tests := []struct {
+		name string
+		err  error
+		code ErrorCode
+		// hint is a fragment of the expected remediation hint.
+		hint string
+	}{
+		{
+			name: "timeout",
+			err:  &v1.Error{Type: v1.ErrTimeout, Msg: "query timed out in expression evaluation"},
+			code: ErrCodeTimeout,
+			hint: "covered 1d with step 1s",
+		},
+		{
+			name: "bad data",
+			err:  &v1.Error{Type: v1.ErrBadData, Msg: "end timestamp must not be before start time"},
+			code: ErrCodeBadData,
+			hint: "end timestamp must not be before start time",
+		},
+		{
+			name: "canceled by Prometheus",
+			err:  &v1.Error{Type: v1.ErrCanceled, Msg: "query was canceled"},
+			code: ErrCodeCanceled,
+			hint: "retry later",
+		},
+		{
+			name: "too many samples",
+			err:  &v1.Error{Type: v1.ErrExec, Msg: "query processing would load too many samples into memory in query execution"},
+			code: ErrCodeTooManySamples,
+			hint: "Shorten the time range",
+		},
+		{
+			name: "maximum resolution",
+			err:  &v1.Error{Type: v1.ErrBadData, Msg: "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)"},
+			code: ErrCodeMaxResolution,
+			hint: "Increase step to at least 8s",
+		},
+		{
+			name: "parse error",
+			err:  &v1.Error{Type: v1.ErrBadData, Msg: `invalid parameter "query": 1:17: parse error: unclosed left parenthesis`},
+			code: ErrCodeParse,
+			hint: "line 1, column 17",
+		},
+		{
+			name: "connection refused",
+			err: fmt.Errorf("Post \"http://localhost:9090/api/v1/query_range\": %w", &net.OpError{
+				Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+			}),
+			code: ErrCodeConnectionRefused,
+			hint: "Check that the datasource URL",
+		},
+		{
+			name: "deadline exceeded",
+			err:  fmt.Errorf("request failed: %w", context.DeadlineExceeded),
+			code: ErrCodeTimeout,
+			hint: "The query took too long",
+		},
+		{
+			name: "canceled by the client",
+			err:  context.Canceled,
+			code: ErrCodeCanceled,
+			hint: "canceled before Prometheus answered",
+		},
+		{
+			name: "rate limited by Prometheus",
+			err:  &v1.Error{Type: v1.ErrClient, Msg: "client error: 429"},
+			code: ErrCodeThrottled,
+			hint: "rate limiting",
+		},
+		{
+			name: "concurrency limit",
+			err:  &ratelimit.QueueTimeoutError{MaxConcurrent: 4},
+			code: ErrCodeThrottled,
+			hint: "maximum of 4 concurrent",
+		},
+		{
+			name: "unknown",
+			err:  errors.New("something unexpected"),
+			code: ErrCodeUpstream,
+			hint: "retrying may help",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qe := ClassifyError(tt.err, qc)
+			if qe.Code != tt.code {
+				t.Errorf("expected code %s, got %s", tt.code, qe.Code)
+			}
+			if qe.Hint == "" || !strings.Contains(qe.Hint, tt.hint) {
+				t.Errorf("expected a hint containing %q, got %q", tt.hint, qe.Hint)
+			}
+			if !errors.Is(qe, tt.err) {
+				t.Errorf("expected the classified error to wrap %v", tt.err)
+			}
+		})
+	}
+}
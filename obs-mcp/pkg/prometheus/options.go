@@ -0,0 +1,119 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// Thanos downsampling resolutions accepted by max_source_resolution.
+const (
+	ResolutionRaw = "0s"
+	Resolution5m  = "5m"
+	Resolution1h  = "1h"
+	// ResolutionAuto picks the resolution from the query range and step.
+	ResolutionAuto = "auto"
+)
+
+// downsamplingThreshold is the range after which automatic resolution picks
+// downsampled data; Thanos only downsamples blocks older than 40h.
+const downsamplingThreshold = 48 * time.Hour
+
+// QueryOptions are Thanos specific query parameters. Prometheus ignores them.
+// Nil fields are not sent, leaving the querier defaults in place.
+type QueryOptions struct {
+	Dedup               *bool  `json:"dedup,omitempty"`
+	PartialResponse     *bool  `json:"partial_response,omitempty"`
+	MaxSourceResolution string `json:"max_source_resolution,omitempty"`
+}
+
+func (o QueryOptions) empty() bool {
+	return o.Dedup == nil && o.PartialResponse == nil && o.MaxSourceResolution == ""
+}
+
+// Resolve replaces ResolutionAuto with a concrete resolution for the range.
+func (o QueryOptions) Resolve(start, end time.Time, step time.Duration) QueryOptions {
+	if o.MaxSourceResolution == ResolutionAuto {
+		o.MaxSourceResolution = AutoMaxSourceResolution(start, end, step)
+	}
+	return o
+}
+
+// AutoMaxSourceResolution picks the downsampling resolution for a range query
+// the way Thanos auto-downsampling does (a fifth of the step), but only for
+// ranges long enough to reach downsampled blocks.
+func AutoMaxSourceResolution(start, end time.Time, step time.Duration) string {
+	if end.Sub(start) < downsamplingThreshold {
+		return ""
+	}
+	switch resolution := step / 5; {
+	case resolution >= time.Hour:
+		return Resolution1h
+	case resolution >= 5*time.Minute:
+		return Resolution5m
+	}
+	return ""
+}
+
+type queryOptionsKey struct{}
+
+// WithQueryOptions returns a context whose query and query_range requests
+// carry opts as extra query parameters.
+func WithQueryOptions(ctx context.Context, opts QueryOptions) context.Context {
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+func queryOptionsFrom(ctx context.Context) (QueryOptions, bool) {
+	opts, ok := ctx.Value(queryOptionsKey{}).(QueryOptions)
+	return opts, ok && !opts.empty()
+}
+
+// queryOptionsClient adds the QueryOptions of the request context to query
+// requests, as the v1 API has no way to pass custom parameters.
+type queryOptionsClient struct {
+	api.Client
+}
+
+func (c queryOptionsClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	opts, ok := queryOptionsFrom(ctx)
+	if ok && (strings.HasSuffix(req.URL.Path, "/query") || strings.HasSuffix(req.URL.Path, "/query_range")) {
+		q := req.URL.Query()
+		if opts.Dedup != nil {
+			q.Set("dedup", strconv.FormatBool(*opts.Dedup))
+		}
+		if opts.PartialResponse != nil {
+			q.Set("partial_response", strconv.FormatBool(*opts.PartialResponse))
+		}
+		if opts.MaxSourceResolution != "" {
+			q.Set("max_source_resolution", opts.MaxSourceResolution)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	return c.Client.Do(ctx, req)
+}
+
+// partialResponseWarnings are fragments of the warnings the Thanos store proxy
+// adds when some store APIs did not answer and partial responses are enabled.
+var partialResponseWarnings = []string{
+	"fetch series for ",
+	"receive series from ",
+	"failed to receive any data",
+}
+
+// isPartialResponse reports whether warnings show that Thanos left out the
+// data of some stores.
+func isPartialResponse(warnings v1.Warnings) bool {
+	for _, warning := range warnings {
+		for _, fragment := range partialResponseWarnings {
+			if strings.Contains(warning, fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
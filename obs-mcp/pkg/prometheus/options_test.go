@@ -0,0 +1,159 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestIsPartialResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		warnings v1.Warnings
+		want     bool
+	}{
+		{name: "none"},
+		{
+			name:     "fetch series",
+			warnings: v1.Warnings{`fetch series for {cluster="eu"} Addr: 10.0.0.1:10901: rpc error: code = Unavailable desc = connection refused`},
+			want:     true,
+		},
+		{
+			name:     "receive series",
+			warnings: v1.Warnings{"receive series from Addr: 10.0.0.2:10901: context deadline exceeded"},
+			want:     true,
+		},
+		{
+			name:     "timeout",
+			warnings: v1.Warnings{"failed to receive any data in 10s from Addr: 10.0.0.3:10901"},
+			want:     true,
+		},
+		{
+			name:     "unrelated",
+			warnings: v1.Warnings{"No StoreAPIs matched for this query", "PromQL info: metric might not be a counter, name does not end in _total"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPartialResponse(tt.warnings); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoMaxSourceResolution(t *testing.T) {
+	end := time.Now()
+	tests := []struct {
+		name string
+		span time.Duration
+		step time.Duration
+		want string
+	}{
+		{name: "short range", span: 24 * time.Hour, step: 6 * time.Hour},
+		{name: "fine step", span: 7 * 24 * time.Hour, step: 10 * time.Minute},
+		{name: "5m", span: 7 * 24 * time.Hour, step: time.Hour, want: Resolution5m},
+		{name: "1h", span: 90 * 24 * time.Hour, step: 6 * time.Hour, want: Resolution1h},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AutoMaxSourceResolution(end.Add(-tt.span), end, tt.step); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// newThanosServer serves empty range query results with warnings, recording
+// the query parameters of the last request.
+func newThanosServer(t *testing.T, warnings []string) (*PrometheusClient, *url.Values) {
+	t.Helper()
+	var params url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing request: %v", err)
+		}
+		params = r.Form
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"status":   "success",
+			"data":     map[string]any{"resultType": "matrix", "result": []any{}},
+			"warnings": warnings,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewPrometheusClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &params
+}
+
+func TestQueryOptionsParameters(t *testing.T) {
+	client, params := newThanosServer(t, nil)
+	end := time.Now()
+
+	dedup := false
+	partial := true
+	ctx := WithQueryOptions(context.Background(), QueryOptions{
+		Dedup:               &dedup,
+		PartialResponse:     &partial,
+		MaxSourceResolution: ResolutionAuto,
+	})
+	response, err := client.ExecuteRangeQuery(ctx, "up", end.Add(-7*24*time.Hour), end, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"dedup": "false", "partial_response": "true", "max_source_resolution": "5m"} {
+		if got := params.Get(name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if opts := response["queryOptions"].(QueryOptions); opts.MaxSourceResolution != Resolution5m {
+		t.Errorf("expected the resolved resolution in the response, got %+v", opts)
+	}
+	if partial, ok := response["partialResponse"]; !ok || partial != false {
+		t.Errorf("expected a complete response to be reported, got %v", response["partialResponse"])
+	}
+
+	// Without options, nothing is added
+	if _, err := client.ExecuteRangeQuery(context.Background(), "up", end.Add(-time.Hour), end, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dedup", "partial_response", "max_source_resolution"} {
+		if params.Has(name) {
+			t.Errorf("unexpected parameter %s=%s", name, params.Get(name))
+		}
+	}
+}
+
+func TestPartialResponseReported(t *testing.T) {
+	client, _ := newThanosServer(t, []string{"receive series from Addr: 10.0.0.2:10901: context deadline exceeded"})
+	end := time.Now()
+
+	// Thanos returns partial responses by default
+	response, err := client.ExecuteRangeQuery(context.Background(), "up", end.Add(-time.Hour), end, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response["partialResponse"] != true {
+		t.Errorf("expected a partial response to be reported, got %v", response)
+	}
+
+	partial := false
+	ctx := WithQueryOptions(context.Background(), QueryOptions{PartialResponse: &partial})
+	response, err = client.ExecuteRangeQuery(ctx, "up", end.Add(-time.Hour), end, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := response["partialResponse"]; ok {
+		t.Errorf("expected no report with partial responses disabled, got %v", response)
+	}
+}
@@ -0,0 +1,285 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/progress"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// exhaustionBurnWindow is the burn rate window the budget exhaustion is
+// projected from.
+const exhaustionBurnWindow = time.Hour
+
+// burnRateAlerts are the multiwindow, multi-burn-rate alerts of the Google
+// SRE workbook: each fires when both windows burn faster than the rate which
+// would consume budgetSpent of the error budget within the long window.
+var burnRateAlerts = []struct {
+	severity    string
+	long, short time.Duration
+	budgetSpent float64
+}{
+	{"page", time.Hour, 5 * time.Minute, 0.02},
+	{"page", 6 * time.Hour, 30 * time.Minute, 0.05},
+	{"ticket", 3 * 24 * time.Hour, 6 * time.Hour, 0.10},
+}
+
+// SLOOptions configures SLOReport. The SLI is either the ratio of the Good
+// and Total counters, or the Availability expression.
+type SLOOptions struct {
+	// Good and Total are selectors of the counters of good and all events.
+	Good  string
+	Total string
+	// Availability is an expression of the ratio of good events, between 0
+	// and 1, averaged over time.
+	Availability string
+	// Objective is the target SLI, e.g. 0.999; see ParseObjective.
+	Objective float64
+	// Window is the compliance window, e.g. 30d.
+	Window time.Duration
+	// At is the evaluation time, now when zero.
+	At time.Time
+}
+
+// SLOReport describes how a service meets its objective in the compliance
+// window and how fast it burns its error budget.
+type SLOReport struct {
+	Objective float64   `json:"objective"`
+	Window    string    `json:"window"`
+	Time      time.Time `json:"time"`
+	// SLI is the ratio of good events in the window, nil without events.
+	SLI         *float64        `json:"sli"`
+	ErrorBudget ErrorBudget     `json:"errorBudget"`
+	BurnRates   []BurnRate      `json:"burnRates"`
+	Alerts      []BurnRateAlert `json:"alerts"`
+	Exhaustion  *Exhaustion     `json:"exhaustion,omitempty"`
+}
+
+// ErrorBudget is the ratio of bad events the objective allows in the
+// window, and the fractions of it consumed and remaining.
+type ErrorBudget struct {
+	Allowed   float64  `json:"allowed"`
+	Consumed  *float64 `json:"consumed"`
+	Remaining *float64 `json:"remaining"`
+}
+
+// BurnRate is how fast the error budget is consumed in a window: 1 consumes
+// exactly the budget over the compliance window.
+type BurnRate struct {
+	Window     string   `json:"window"`
+	ErrorRatio *float64 `json:"errorRatio"`
+	BurnRate   *float64 `json:"burnRate"`
+	Query      string   `json:"query"`
+}
+
+// BurnRateAlert is a multiwindow burn rate alert, firing when both windows
+// exceed the threshold.
+type BurnRateAlert struct {
+	Severity    string  `json:"severity"`
+	LongWindow  string  `json:"longWindow"`
+	ShortWindow string  `json:"shortWindow"`
+	Threshold   float64 `json:"threshold"`
+	Firing      bool    `json:"firing"`
+}
+
+// Exhaustion projects when the error budget runs out at the current burn
+// rate.
+type Exhaustion struct {
+	// BurnRateWindow is the window of the burn rate the projection uses.
+	BurnRateWindow string `json:"burnRateWindow"`
+	// Exhausted reports that no budget is left.
+	Exhausted bool       `json:"exhausted"`
+	At        *time.Time `json:"at,omitempty"`
+	In        string     `json:"in,omitempty"`
+}
+
+// ParseObjective parses an objective given as a ratio (0.999) or as a
+// percentage (99.9). Values from 1 up to 50 are rejected as ambiguous: 1
+// could be a ratio of 100%, and an objective below 50% is more likely a
+// mistaken scale than intended.
+func ParseObjective(objective float64) (float64, error) {
+	if objective >= 1 && objective < 50 {
+		return 0, fmt.Errorf("ambiguous objective %v, give a ratio between 0 and 1 or a percentage between 50 and 100, e.g. 0.999 or 99.9", objective)
+	}
+	if objective >= 50 && objective < 100 {
+		objective /= 100
+	}
+	if objective <= 0 || objective >= 1 {
+		return 0, fmt.Errorf("objective must be a ratio between 0 and 1 or a percentage between 50 and 100, e.g. 0.999 or 99.9")
+	}
+	return objective, nil
+}
+
+// SLOReport computes the SLI over the compliance window, the error budget
+// left, the burn rates in the windows of the multiwindow burn rate alerts
+// and when the budget would be exhausted.
+func (p *PrometheusClient) SLOReport(ctx context.Context, opts SLOOptions) (*SLOReport, error) {
+	errorRatio, err := errorRatioQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Objective <= 0 || opts.Objective >= 1 {
+		return nil, fmt.Errorf("objective must be between 0 and 1")
+	}
+	if opts.Window <= 0 {
+		return nil, fmt.Errorf("window must be positive")
+	}
+	if opts.At.IsZero() {
+		opts.At = time.Now()
+	}
+
+	allowed := 1 - opts.Objective
+	report := &SLOReport{
+		Objective:   opts.Objective,
+		Window:      model.Duration(opts.Window).String(),
+		Time:        opts.At.UTC(),
+		ErrorBudget: ErrorBudget{Allowed: allowed},
+		BurnRates:   []BurnRate{},
+		Alerts:      []BurnRateAlert{},
+	}
+
+	progress.Report(ctx, "Computing the SLI over %s", model.Duration(opts.Window))
+	ratio, err := p.valueAt(ctx, errorRatio(opts.Window), opts.At)
+	if err != nil {
+		return nil, err
+	}
+	if ratio != nil {
+		sli := 1 - *ratio
+		consumed := *ratio / allowed
+		remaining := 1 - consumed
+		report.SLI = &sli
+		report.ErrorBudget.Consumed = &consumed
+		report.ErrorBudget.Remaining = &remaining
+	}
+
+	burnRates := map[time.Duration]*float64{}
+	for _, window := range burnRateWindows() {
+		query := errorRatio(window)
+		progress.Report(ctx, "Computing the burn rate over %s", model.Duration(window))
+		ratio, err := p.valueAt(ctx, query, opts.At)
+		if err != nil {
+			return nil, err
+		}
+
+		burn := BurnRate{Window: model.Duration(window).String(), ErrorRatio: ratio, Query: query}
+		if ratio != nil {
+			rate := *ratio / allowed
+			burn.BurnRate = &rate
+		}
+		burnRates[window] = burn.BurnRate
+		report.BurnRates = append(report.BurnRates, burn)
+	}
+
+	for _, a := range burnRateAlerts {
+		threshold := a.budgetSpent * opts.Window.Hours() / a.long.Hours()
+		long, short := burnRates[a.long], burnRates[a.short]
+		report.Alerts = append(report.Alerts, BurnRateAlert{
+			Severity:    a.severity,
+			LongWindow:  model.Duration(a.long).String(),
+			ShortWindow: model.Duration(a.short).String(),
+			Threshold:   math.Round(threshold*100) / 100,
+			Firing:      long != nil && short != nil && *long > threshold && *short > threshold,
+		})
+	}
+
+	report.Exhaustion = projectExhaustion(report.ErrorBudget.Remaining, burnRates[exhaustionBurnWindow], opts.Window, opts.At)
+	return report, nil
+}
+
+// projectExhaustion returns when the remaining budget is consumed at the
+// burn rate, or nil when it is not being consumed.
+func projectExhaustion(remaining, burnRate *float64, window time.Duration, at time.Time) *Exhaustion {
+	if remaining == nil {
+		return nil
+	}
+	exhaustion := &Exhaustion{BurnRateWindow: model.Duration(exhaustionBurnWindow).String()}
+	if *remaining <= 0 {
+		exhaustion.Exhausted = true
+		return exhaustion
+	}
+	if burnRate == nil || *burnRate <= 0 {
+		return nil
+	}
+
+	// A burn rate of 1 consumes the whole budget in the window
+	left := time.Duration(*remaining / *burnRate * float64(window)).Round(time.Minute)
+	exhausted := at.Add(left).UTC()
+	exhaustion.At = &exhausted
+	exhaustion.In = model.Duration(left).String()
+	return exhaustion
+}
+
+// burnRateWindows returns the windows of the burn rate alerts, longest first.
+func burnRateWindows() []time.Duration {
+	var windows []time.Duration
+	for _, a := range burnRateAlerts {
+		windows = append(windows, a.long, a.short)
+	}
+	slices.Sort(windows)
+	slices.Reverse(windows)
+	return slices.Compact(windows)
+}
+
+// errorRatioQuery validates the SLI of opts and returns a function building
+// the query of the ratio of bad events in a window.
+func errorRatioQuery(opts SLOOptions) (func(time.Duration) string, error) {
+	switch {
+	case opts.Availability != "" && (opts.Good != "" || opts.Total != ""):
+		return nil, fmt.Errorf("either good and total, or availability must be given, not both")
+	case opts.Availability != "":
+		if _, err := parser.ParseExpr(opts.Availability); err != nil {
+			return nil, fmt.Errorf("invalid availability expression: %w", err)
+		}
+		return func(window time.Duration) string {
+			return fmt.Sprintf("1 - avg(avg_over_time((%s)[%s:%s]))",
+				opts.Availability, model.Duration(window), model.Duration(subqueryStep(window)))
+		}, nil
+	case opts.Good != "" && opts.Total != "":
+		for name, selector := range map[string]string{"good": opts.Good, "total": opts.Total} {
+			expr, err := parser.ParseExpr(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s selector: %w", name, err)
+			}
+			if _, ok := expr.(*parser.VectorSelector); !ok {
+				return nil, fmt.Errorf("%s must be a series selector of a counter, such as http_requests_total{code!~\"5..\"}", name)
+			}
+		}
+		return func(window time.Duration) string {
+			return fmt.Sprintf("1 - sum(increase(%s[%s])) / sum(increase(%s[%s]))",
+				opts.Good, model.Duration(window), opts.Total, model.Duration(window))
+		}, nil
+	}
+	return nil, fmt.Errorf("the SLI requires either good and total selectors, or an availability expression")
+}
+
+// subqueryStep is the resolution the availability expression is averaged at
+// over window.
+func subqueryStep(window time.Duration) time.Duration {
+	return max(time.Minute, (window / 720).Truncate(time.Minute))
+}
+
+// valueAt evaluates query at a single time and returns the value of its only
+// series, or nil when it returns no series or NaN.
+func (p *PrometheusClient) valueAt(ctx context.Context, query string, at time.Time) (*float64, error) {
+	matrix, err := p.QueryRangeMatrix(ctx, query, at, at, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if len(matrix) == 0 || len(matrix[0].Values) == 0 {
+		return nil, nil
+	}
+	if len(matrix) > 1 {
+		return nil, fmt.Errorf("query %s returned %d series instead of one", query, len(matrix))
+	}
+
+	value := float64(matrix[0].Values[len(matrix[0].Values)-1].Value)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, nil
+	}
+	return &value, nil
+}
@@ -0,0 +1,37 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseObjective(t *testing.T) {
+	tests := []struct {
+		objective float64
+		want      float64
+		err       bool
+	}{
+		{objective: 0.999, want: 0.999},
+		{objective: 0.5, want: 0.5},
+		{objective: 99.9, want: 0.999},
+		{objective: 50, want: 0.5},
+		{objective: 1, err: true},
+		{objective: 5, err: true},
+		{objective: 49.9, err: true},
+		{objective: 0, err: true},
+		{objective: -0.5, err: true},
+		{objective: 100, err: true},
+		{objective: 150, err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseObjective(tt.objective)
+		switch {
+		case tt.err && err == nil:
+			t.Errorf("ParseObjective(%v) = %v, expected an error", tt.objective, got)
+		case !tt.err && err != nil:
+			t.Errorf("ParseObjective(%v): unexpected error: %v", tt.objective, err)
+		case !tt.err && math.Abs(got-tt.want) > 1e-9:
+			t.Errorf("ParseObjective(%v) = %v, want %v", tt.objective, got, tt.want)
+		}
+	}
+}
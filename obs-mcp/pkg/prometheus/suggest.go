@@ -0,0 +1,206 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/progress"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const (
+	// maxSuggestions is the number of "did you mean" values offered per matcher.
+	maxSuggestions = 3
+	// lookbackDelta widens the label value lookup the same way instant vector
+	// selectors look back for samples.
+	lookbackDelta = 5 * time.Minute
+)
+
+// EmptyResultDiagnosis explains why a query returned no series.
+type EmptyResultDiagnosis struct {
+	Summary   string              `json:"summary"`
+	Selectors []SelectorDiagnosis `json:"selectors"`
+}
+
+// SelectorDiagnosis describes whether a selector of the query matches any
+// series in the queried range.
+type SelectorDiagnosis struct {
+	Selector string `json:"selector"`
+	Matches  bool   `json:"matchesSeries"`
+	// EliminatedBy is the first matcher after which no series were left.
+	EliminatedBy string `json:"eliminatedBy,omitempty"`
+	// UnknownValues lists equality matchers whose value does not exist for
+	// the label among the series selected by the other matchers.
+	UnknownValues []UnknownValue `json:"unknownValues,omitempty"`
+}
+
+// UnknownValue is an equality matcher with a value that does not exist,
+// together with the closest existing values.
+type UnknownValue struct {
+	Matcher    string   `json:"matcher"`
+	DidYouMean []string `json:"didYouMean"`
+}
+
+// DiagnoseEmptyResult finds the selectors of query which match no series
+// between start and end, and offers the closest existing values for their
+// equality matchers.
+func (p *PrometheusClient) DiagnoseEmptyResult(ctx context.Context, query string, start, end time.Time) (*EmptyResultDiagnosis, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, err
+	}
+	start = start.Add(-lookbackDelta)
+
+	diagnosis := &EmptyResultDiagnosis{Selectors: []SelectorDiagnosis{}}
+	selectors := parser.ExtractSelectors(expr)
+	for i, matchers := range selectors {
+		progress.Report(ctx, "Checking selector %d of %d: %s", i+1, len(selectors), formatSelector(matchers))
+		selector, err := p.diagnoseSelector(ctx, matchers, start, end)
+		if err != nil {
+			return nil, err
+		}
+		diagnosis.Selectors = append(diagnosis.Selectors, *selector)
+	}
+
+	var failing []string
+	for _, s := range diagnosis.Selectors {
+		if !s.Matches {
+			failing = append(failing, s.Selector)
+		}
+	}
+	switch {
+	case len(failing) > 0:
+		diagnosis.Summary = fmt.Sprintf("no series match %s in the queried range", strings.Join(failing, ", "))
+	default:
+		diagnosis.Summary = "every selector matches series, so the result was emptied by the operators, functions or filters of the query"
+	}
+	return diagnosis, nil
+}
+
+func (p *PrometheusClient) diagnoseSelector(ctx context.Context, matchers []*labels.Matcher, start, end time.Time) (*SelectorDiagnosis, error) {
+	diagnosis := &SelectorDiagnosis{Selector: formatSelector(matchers), Matches: true}
+
+	// Apply the matchers one by one, metric name first, to find the one
+	// after which no series are left.
+	ordered := slices.Clone(matchers)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Name == labels.MetricName && ordered[j].Name != labels.MetricName
+	})
+	for i, m := range ordered {
+		names, err := p.LabelValues(ctx, labels.MetricName, selectorFilter(ordered[:i+1]), start, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			diagnosis.Matches = false
+			diagnosis.EliminatedBy = m.String()
+			break
+		}
+	}
+	if diagnosis.Matches {
+		return diagnosis, nil
+	}
+
+	// Check each equality matcher against the values that exist among the
+	// series selected by all the other matchers. When the others select
+	// nothing, the matcher is not the one to blame.
+	for i, m := range ordered {
+		if m.Type != labels.MatchEqual || m.Value == "" {
+			continue
+		}
+		others := slices.Concat(ordered[:i], ordered[i+1:])
+		values, err := p.LabelValues(ctx, m.Name, selectorFilter(others), start, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 || slices.Contains(values, m.Value) {
+			continue
+		}
+		diagnosis.UnknownValues = append(diagnosis.UnknownValues, UnknownValue{
+			Matcher:    m.String(),
+			DidYouMean: closestValues(m.Value, values, maxSuggestions),
+		})
+	}
+	return diagnosis, nil
+}
+
+// selectorFilter turns matchers into a match[] argument. Without a matcher
+// that requires a non-empty value the API rejects the selector, so nothing is
+// filtered in that case.
+func selectorFilter(matchers []*labels.Matcher) []string {
+	for _, m := range matchers {
+		if !m.Matches("") {
+			return []string{formatSelector(matchers)}
+		}
+	}
+	return nil
+}
+
+func formatSelector(matchers []*labels.Matcher) string {
+	parts := make([]string, len(matchers))
+	for i, m := range matchers {
+		parts[i] = m.String()
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// closestValues returns up to n candidates closest to value by edit distance,
+// ignoring candidates too different to be a plausible typo.
+func closestValues(value string, candidates []string, n int) []string {
+	type scored struct {
+		value    string
+		distance int
+	}
+
+	lower := strings.ToLower(value)
+	limit := max(2, len([]rune(value))/2)
+	var matches []scored
+	for _, candidate := range candidates {
+		lowerCandidate := strings.ToLower(candidate)
+		distance := levenshtein(lower, lowerCandidate)
+		if len(lowerCandidate) >= 3 && (strings.Contains(lowerCandidate, lower) || strings.Contains(lower, lowerCandidate)) {
+			distance = min(distance, 1)
+		}
+		if distance <= limit {
+			matches = append(matches, scored{candidate, distance})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].value < matches[j].value
+	})
+
+	result := []string{}
+	for i := 0; i < len(matches) && i < n; i++ {
+		result = append(result, matches[i].value)
+	}
+	return result
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
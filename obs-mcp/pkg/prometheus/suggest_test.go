@@ -0,0 +1,129 @@
+package prometheus
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// seriesAPI answers label value requests from a fixed set of series. The
+// other methods of the API are not implemented.
+type seriesAPI struct {
+	v1.API
+	series []labels.Labels
+}
+
+func (a seriesAPI) LabelValues(_ context.Context, label string, matches []string, _, _ time.Time, _ ...v1.Option) (model.LabelValues, v1.Warnings, error) {
+	var selectors [][]*labels.Matcher
+	for _, match := range matches {
+		matchers, err := parser.ParseMetricSelector(match)
+		if err != nil {
+			return nil, nil, err
+		}
+		selectors = append(selectors, matchers)
+	}
+
+	values := model.LabelValues{}
+	for _, series := range a.series {
+		selected := len(selectors) == 0
+		for _, matchers := range selectors {
+			selected = selected || !slices.ContainsFunc(matchers, func(m *labels.Matcher) bool { return !m.Matches(series.Get(m.Name)) })
+		}
+		if value := model.LabelValue(series.Get(label)); selected && value != "" && !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	sort.Sort(values)
+	return values, nil, nil
+}
+
+func newSeriesClient() *PrometheusClient {
+	return &PrometheusClient{client: seriesAPI{series: []labels.Labels{
+		labels.FromStrings(labels.MetricName, "kube_pod_info", "namespace", "production", "pod", "web-0"),
+		labels.FromStrings(labels.MetricName, "kube_pod_info", "namespace", "staging", "pod", "web-0"),
+		labels.FromStrings(labels.MetricName, "kube_pod_info", "namespace", "monitoring", "pod", "prometheus-0"),
+	}}}
+}
+
+func TestDiagnoseEmptyResult(t *testing.T) {
+	client := newSeriesClient()
+	end := time.Now()
+	start := end.Add(-time.Hour)
+
+	diagnosis, err := client.DiagnoseEmptyResult(context.Background(),
+		`sum(kube_pod_info{namespace="prodution", pod="web-0"}) / sum(kube_pod_info)`, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnosis.Selectors) != 2 {
+		t.Fatalf("expected two selectors, got %+v", diagnosis.Selectors)
+	}
+
+	misspelled := diagnosis.Selectors[0]
+	if misspelled.Matches || misspelled.EliminatedBy != `namespace="prodution"` {
+		t.Errorf("expected the namespace matcher to eliminate the series, got %+v", misspelled)
+	}
+	if len(misspelled.UnknownValues) != 1 || misspelled.UnknownValues[0].Matcher != `namespace="prodution"` ||
+		!slices.Equal(misspelled.UnknownValues[0].DidYouMean, []string{"production"}) {
+		t.Errorf("expected production to be suggested for the namespace, got %+v", misspelled.UnknownValues)
+	}
+	if !diagnosis.Selectors[1].Matches {
+		t.Errorf("expected the second selector to match, got %+v", diagnosis.Selectors[1])
+	}
+
+	diagnosis, err = client.DiagnoseEmptyResult(context.Background(), `kube_pod_info{namespace="staging"} > 1`, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnosis.Selectors) != 1 || !diagnosis.Selectors[0].Matches {
+		t.Errorf("expected the selector to match, got %+v", diagnosis)
+	}
+}
+
+func TestClosestValues(t *testing.T) {
+	candidates := []string{"production", "staging", "monitoring", "prod", "kube-system"}
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		// Substrings rank as a single edit
+		{value: "prodution", want: []string{"prod", "production"}},
+		{value: "Staging", want: []string{"staging"}},
+		{value: "stagin", want: []string{"staging"}},
+		{value: "kube", want: []string{"kube-system"}},
+		{value: "default", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := closestValues(tt.value, candidates, maxSuggestions); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"prodution", "production", 1},
+		{"naïve", "naive", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -2,46 +2,230 @@ package prometheus
 
 import (
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 )
 
+// durationUnits are the units accepted by ParseDuration, longest first so
+// that "ms" is not read as minutes.
+var durationUnits = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"ms", time.Millisecond},
+	{"us", time.Microsecond},
+	{"µs", time.Microsecond},
+	{"ns", time.Nanosecond},
+	{"y", 365 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+var (
+	durationNumber = regexp.MustCompile(`^\d+(\.\d+)?`)
+	unixNumber     = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+)
+
+// ParseDuration parses a duration made of one or more number and unit pairs,
+// such as "90s", "1d12h" or "1.5h". Besides the units of time.ParseDuration it
+// accepts days (d), weeks (w) and years (y, 365 days).
 func ParseDuration(duration string) (time.Duration, error) {
 	if duration == "" {
 		return 0, fmt.Errorf("empty duration")
 	}
 
-	// Handle weeks (not supported by time.ParseDuration)
-	if len(duration) > 1 && duration[len(duration)-1] == 'w' {
-		weeks, err := strconv.Atoi(duration[:len(duration)-1])
+	var total float64
+	rest := duration
+	for rest != "" {
+		number := durationNumber.FindString(rest)
+		if number == "" {
+			return 0, fmt.Errorf("invalid duration %q: expected a number at %q", duration, rest)
+		}
+		value, err := strconv.ParseFloat(number, 64)
 		if err != nil {
-			return 0, fmt.Errorf("invalid weeks format: %s", duration)
+			return 0, fmt.Errorf("invalid duration %q: %w", duration, err)
 		}
-		return time.Duration(weeks) * 7 * 24 * time.Hour, nil
-	}
+		rest = rest[len(number):]
 
-	// Handle days (not supported by time.ParseDuration)
-	if len(duration) > 1 && duration[len(duration)-1] == 'd' {
-		days, err := strconv.Atoi(duration[:len(duration)-1])
-		if err != nil {
-			return 0, fmt.Errorf("invalid days format: %s", duration)
+		found := false
+		for _, unit := range durationUnits {
+			if strings.HasPrefix(rest, unit.name) {
+				total += value * float64(unit.duration)
+				rest = rest[len(unit.name):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid duration %q: missing or unknown unit after %s, expected one of y, w, d, h, m, s, ms", duration, number)
 		}
-		return time.Duration(days) * 24 * time.Hour, nil
 	}
 
-	return time.ParseDuration(duration)
+	if total > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid duration %q: too long", duration)
+	}
+	return time.Duration(total), nil
 }
 
+// ParseTimestamp parses an absolute or relative time relative to the
+// current time. See ParseTime for the accepted formats.
 func ParseTimestamp(timestamp string) (time.Time, error) {
-	// Try parsing as RFC3339 first
-	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+	return ParseTime(timestamp, time.Now())
+}
+
+// localTimeLayouts are the layouts of times without a UTC offset, which are
+// interpreted in UTC or in the time zone following them.
+var localTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// millisecondThreshold is the smallest integer timestamp read as milliseconds;
+// as seconds it would be in the year 5138.
+const millisecondThreshold = 1e11
+
+// ParseTime parses the time expressions accepted by the tools:
+//
+//   - RFC3339 times, such as "2025-03-01T09:00:00Z" or "2025-03-01T10:00:00+01:00"
+//   - Unix timestamps in seconds, possibly fractional ("1740819600.5"), or
+//     milliseconds ("1740819600500")
+//   - dates and local times without an offset ("2025-03-01", "2025-03-01 09:00"),
+//     in UTC unless followed by a time zone ("2025-03-01 09:00 Europe/Prague")
+//   - "now" with optional offsets and rounding, such as "now-2h", "now-1d12h"
+//     or "now-1d/d" (the start of yesterday, in UTC)
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+
+	if strings.HasPrefix(s, "now") {
+		return parseRelativeTime(s, now)
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
 		return t, nil
 	}
 
-	// Try parsing as Unix timestamp
-	if unixTime, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
-		return time.Unix(unixTime, 0), nil
+	if unixNumber.MatchString(s) {
+		unix, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid Unix timestamp %q: %w", s, err)
+		}
+		return parseUnixTime(s, unix), nil
 	}
 
-	return time.Time{}, fmt.Errorf("timestamp must be RFC3339 format or Unix timestamp")
+	if t, ok, err := parseLocalTime(s); ok {
+		return t, err
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp %q: expected RFC3339 (2025-03-01T09:00:00Z), a Unix timestamp, "+
+		"a date or local time optionally followed by a time zone (2025-03-01 09:00 Europe/Prague), or a relative time (now-2h, now-1d/d)", s)
+}
+
+func parseUnixTime(s string, unix float64) time.Time {
+	if !strings.Contains(s, ".") {
+		// Keep full precision for integers
+		n, _ := strconv.ParseInt(s, 10, 64)
+		if n >= millisecondThreshold || n <= -millisecondThreshold {
+			return time.UnixMilli(n)
+		}
+		return time.Unix(n, 0)
+	}
+	if math.Abs(unix) >= millisecondThreshold {
+		return time.UnixMicro(int64(math.Round(unix * 1e3)))
+	}
+	seconds, fraction := math.Modf(unix)
+	return time.Unix(int64(seconds), int64(math.Round(fraction*1e9)))
+}
+
+// parseLocalTime parses the local time layouts, with an optional trailing
+// time zone name. ok reports whether s looks like a local time at all.
+func parseLocalTime(s string) (t time.Time, ok bool, err error) {
+	value, zone := s, ""
+	if i := strings.LastIndex(s, " "); i > 0 && i+1 < len(s) && unicode.IsLetter(rune(s[i+1])) {
+		value, zone = s[:i], s[i+1:]
+	}
+
+	loc := time.UTC
+	if zone != "" {
+		loc, err = time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("invalid timestamp %q: unknown time zone %q", s, zone)
+		}
+	}
+
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// parseRelativeTime parses "now" followed by any number of "+duration" or
+// "-duration" offsets and an optional "/unit" rounding down to the start of
+// a second, minute, hour, day, week (Monday), month or year in UTC.
+func parseRelativeTime(s string, now time.Time) (time.Time, error) {
+	expr, rounding, hasRounding := strings.Cut(strings.TrimPrefix(s, "now"), "/")
+
+	t := now
+	for expr != "" {
+		sign := expr[0]
+		if sign != '+' && sign != '-' {
+			return time.Time{}, fmt.Errorf("invalid relative time %q: expected + or - after now", s)
+		}
+		expr = expr[1:]
+
+		end := strings.IndexAny(expr, "+-")
+		if end < 0 {
+			end = len(expr)
+		}
+		offset, err := ParseDuration(expr[:end])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q: %w", s, err)
+		}
+		if sign == '-' {
+			offset = -offset
+		}
+		t = t.Add(offset)
+		expr = expr[end:]
+	}
+
+	if !hasRounding {
+		return t, nil
+	}
+	return roundDown(t.UTC(), rounding, s)
+}
+
+func roundDown(t time.Time, unit, expr string) (time.Time, error) {
+	year, month, day := t.Date()
+	switch unit {
+	case "s":
+		return t.Truncate(time.Second), nil
+	case "m":
+		return t.Truncate(time.Minute), nil
+	case "h":
+		return t.Truncate(time.Hour), nil
+	case "d":
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), nil
+	case "w":
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, time.UTC), nil
+	case "M":
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC), nil
+	case "y":
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid relative time %q: unknown rounding unit %q, expected one of s, m, h, d, w, M, y", expr, unit)
 }
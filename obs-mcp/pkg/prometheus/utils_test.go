@@ -0,0 +1,137 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "30s", want: 30 * time.Second},
+		{input: "5m", want: 5 * time.Minute},
+		{input: "1d", want: 24 * time.Hour},
+		{input: "2w", want: 14 * 24 * time.Hour},
+		{input: "1y", want: 365 * 24 * time.Hour},
+		{input: "1d12h", want: 36 * time.Hour},
+		{input: "1h30m15s", want: time.Hour + 30*time.Minute + 15*time.Second},
+		{input: "1w2d", want: 9 * 24 * time.Hour},
+		{input: "1.5h", want: 90 * time.Minute},
+		{input: "0.5d", want: 12 * time.Hour},
+		{input: "250ms", want: 250 * time.Millisecond},
+		{input: "1m500ms", want: time.Minute + 500*time.Millisecond},
+		{input: "10us", want: 10 * time.Microsecond},
+		{input: "0s", want: 0},
+		{input: "", wantErr: true},
+		{input: "10", wantErr: true},
+		{input: "h", wantErr: true},
+		{input: "1x", wantErr: true},
+		{input: "-1h", wantErr: true},
+		{input: "1h ", wantErr: true},
+		{input: "1..5h", wantErr: true},
+		{input: "1000000y", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDuration(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	// Wednesday
+	now := time.Date(2025, time.March, 12, 14, 35, 20, 500_000_000, time.UTC)
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		// RFC3339
+		{name: "rfc3339 utc", input: "2025-03-01T09:00:00Z", want: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{name: "rfc3339 offset", input: "2025-03-01T10:00:00+01:00", want: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{name: "rfc3339 fractional", input: "2025-03-01T09:00:00.25Z", want: time.Date(2025, 3, 1, 9, 0, 0, 250_000_000, time.UTC)},
+
+		// Unix timestamps
+		{name: "unix seconds", input: "1740819600", want: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{name: "unix fractional seconds", input: "1740819600.5", want: time.Date(2025, 3, 1, 9, 0, 0, 500_000_000, time.UTC)},
+		{name: "unix milliseconds", input: "1740819600250", want: time.Date(2025, 3, 1, 9, 0, 0, 250_000_000, time.UTC)},
+		{name: "unix fractional milliseconds", input: "1740819600250.5", want: time.Date(2025, 3, 1, 9, 0, 0, 250_500_000, time.UTC)},
+		{name: "unix zero", input: "0", want: time.Unix(0, 0)},
+		{name: "unix nan", input: "NaN", wantErr: true},
+		{name: "unix exponent", input: "1.7e9", wantErr: true},
+
+		// Dates and local times
+		{name: "date", input: "2025-03-01", want: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "local minutes", input: "2025-03-01 09:00", want: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{name: "local seconds with T", input: "2025-03-01T09:00:30", want: time.Date(2025, 3, 1, 9, 0, 30, 0, time.UTC)},
+		{name: "local fractional seconds", input: "2025-03-01 09:00:30.5", want: time.Date(2025, 3, 1, 9, 0, 30, 500_000_000, time.UTC)},
+		{name: "local time in zone", input: "2025-03-01 09:00 Europe/Prague", want: time.Date(2025, 3, 1, 9, 0, 0, 0, prague)},
+		{name: "local time in zone during dst", input: "2025-07-01 09:00:00 Europe/Prague", want: time.Date(2025, 7, 1, 7, 0, 0, 0, time.UTC)},
+		{name: "date in zone", input: "2025-03-01 America/New_York", want: time.Date(2025, 3, 1, 5, 0, 0, 0, time.UTC)},
+		{name: "date in utc", input: "2025-03-01 UTC", want: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "unknown zone", input: "2025-03-01 09:00 Mars/Olympus", wantErr: true},
+		{name: "invalid date", input: "2025-02-30", wantErr: true},
+
+		// Relative times
+		{name: "now", input: "now", want: now},
+		{name: "now minus", input: "now-2h", want: now.Add(-2 * time.Hour)},
+		{name: "now plus", input: "now+30m", want: now.Add(30 * time.Minute)},
+		{name: "now compound", input: "now-1d12h", want: now.Add(-36 * time.Hour)},
+		{name: "now chained offsets", input: "now-1d+2h", want: now.Add(-22 * time.Hour)},
+		{name: "start of today", input: "now/d", want: time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{name: "start of yesterday", input: "now-1d/d", want: time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{name: "start of hour", input: "now/h", want: time.Date(2025, 3, 12, 14, 0, 0, 0, time.UTC)},
+		{name: "start of minute", input: "now-5m/m", want: time.Date(2025, 3, 12, 14, 30, 0, 0, time.UTC)},
+		{name: "start of second", input: "now/s", want: time.Date(2025, 3, 12, 14, 35, 20, 0, time.UTC)},
+		{name: "start of week", input: "now/w", want: time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "start of last week", input: "now-1w/w", want: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{name: "start of month", input: "now/M", want: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "start of year", input: "now/y", want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "surrounding spaces", input: " now-1h ", want: now.Add(-time.Hour)},
+		{name: "missing sign", input: "now2h", wantErr: true},
+		{name: "missing duration", input: "now-", wantErr: true},
+		{name: "unknown rounding", input: "now/q", wantErr: true},
+
+		// Garbage
+		{name: "empty", input: "", wantErr: true},
+		{name: "words", input: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTime(tt.input, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/chart"
+	"github.com/inecas/obs-mcp/pkg/progress"
+	"github.com/prometheus/common/model"
+)
+
+// Resources the workloads are ranked by.
+const (
+	ResourceCPU             = "cpu"
+	ResourceMemory          = "memory"
+	ResourceNetworkReceive  = "network_receive"
+	ResourceNetworkTransmit = "network_transmit"
+	ResourceRestarts        = "restarts"
+)
+
+// Levels the usage is aggregated at.
+const (
+	WorkloadLevelPod       = "pod"
+	WorkloadLevelWorkload  = "workload"
+	WorkloadLevelNamespace = "namespace"
+)
+
+const (
+	defaultUsageWindow    = 5 * time.Minute
+	defaultRestartsWindow = time.Hour
+)
+
+var (
+	WorkloadResources = []string{ResourceCPU, ResourceMemory, ResourceNetworkReceive, ResourceNetworkTransmit, ResourceRestarts}
+	WorkloadLevels    = []string{WorkloadLevelPod, WorkloadLevelWorkload, WorkloadLevelNamespace}
+)
+
+// workloadResource is how the usage of a resource is queried per pod, from
+// the cAdvisor and kube-state-metrics series.
+type workloadResource struct {
+	// query is the usage by namespace and pod; %[1]s is the pod selector
+	// matchers and %[2]s the window.
+	query string
+	unit  string
+}
+
+var workloadResourceQueries = map[string]workloadResource{
+	ResourceCPU: {
+		query: `sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{container!="", image!=""%[1]s}[%[2]s]))`,
+		unit:  "cores",
+	},
+	ResourceMemory: {
+		query: `sum by (namespace, pod) (container_memory_working_set_bytes{container!="", image!=""%[1]s})`,
+		unit:  "bytes",
+	},
+	ResourceNetworkReceive: {
+		query: `sum by (namespace, pod) (rate(container_network_receive_bytes_total{pod!=""%[1]s}[%[2]s]))`,
+		unit:  "bytes/s",
+	},
+	ResourceNetworkTransmit: {
+		query: `sum by (namespace, pod) (rate(container_network_transmit_bytes_total{pod!=""%[1]s}[%[2]s]))`,
+		unit:  "bytes/s",
+	},
+	ResourceRestarts: {
+		query: `sum by (namespace, pod) (increase(kube_pod_container_status_restarts_total{pod!=""%[1]s}[%[2]s]))`,
+		unit:  "restarts",
+	},
+}
+
+// podWorkloads maps every pod to the workload owning it, as the labels
+// workload and workload_kind. Pods of ReplicaSets are resolved to their
+// Deployment, or are reported as the ReplicaSet itself when it is not owned
+// by a Deployment (a bare ReplicaSet, or one of an Argo Rollout). Pods
+// without an owner are their own workload of kind Pod.
+// %[1]s is the pod selector matchers.
+const podWorkloads = `max by (namespace, pod, workload, workload_kind) (
+  label_replace(label_replace(
+    max by (namespace, pod, replicaset) (label_replace(kube_pod_owner{owner_kind="ReplicaSet"%[1]s}, "replicaset", "$1", "owner_name", "(.*)"))
+      * on (namespace, replicaset) group_left (owner_kind, owner_name)
+    max by (namespace, replicaset, owner_kind, owner_name) (kube_replicaset_owner{owner_kind="Deployment"}),
+  "workload", "$1", "owner_name", "(.*)"), "workload_kind", "$1", "owner_kind", "(.*)")
+  or
+  label_replace(label_replace(
+    max by (namespace, pod, replicaset) (label_replace(kube_pod_owner{owner_kind="ReplicaSet"%[1]s}, "replicaset", "$1", "owner_name", "(.*)"))
+      unless on (namespace, replicaset)
+    kube_replicaset_owner{owner_kind="Deployment"},
+  "workload", "$1", "replicaset", "(.*)"), "workload_kind", "ReplicaSet", "replicaset", ".*")
+  or
+  label_replace(label_replace(
+    kube_pod_owner{owner_kind!="ReplicaSet", owner_kind!="<none>"%[1]s},
+  "workload", "$1", "owner_name", "(.*)"), "workload_kind", "$1", "owner_kind", "(.*)")
+  or
+  label_replace(label_replace(
+    kube_pod_owner{owner_kind="<none>"%[1]s},
+  "workload", "$1", "pod", "(.*)"), "workload_kind", "Pod", "pod", ".*")
+)`
+
+// TopWorkloadsOptions configures TopWorkloads.
+type TopWorkloadsOptions struct {
+	// Resource is one of WorkloadResources.
+	Resource string
+	// Level is one of WorkloadLevels.
+	Level string
+	// Namespace limits the ranking to a namespace when not empty.
+	Namespace string
+	// Limit is the number of entries returned.
+	Limit int
+	// Window is the rate window, or for restarts the period they are
+	// counted over. Zero selects a default for the resource.
+	Window time.Duration
+	// At is the evaluation time, now when zero.
+	At time.Time
+}
+
+// TopWorkloads is a ranking of the pods, workloads or namespaces by their
+// usage of a resource.
+type TopWorkloads struct {
+	Resource string         `json:"resource"`
+	Level    string         `json:"level"`
+	Unit     string         `json:"unit"`
+	Time     time.Time      `json:"time"`
+	Window   string         `json:"window,omitempty"`
+	Query    string         `json:"query"`
+	Entries  []WorkloadRank `json:"entries"`
+	// Table is the ranking formatted as a Markdown table.
+	Table string `json:"table"`
+}
+
+// WorkloadRank is an entry of the ranking.
+type WorkloadRank struct {
+	Rank      int     `json:"rank"`
+	Namespace string  `json:"namespace,omitempty"`
+	Kind      string  `json:"kind,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Value     float64 `json:"value"`
+	// Formatted is the value with its unit, e.g. 1.5 GiB.
+	Formatted string `json:"formatted"`
+}
+
+// TopWorkloads ranks the pods, workloads or namespaces by their usage of a
+// resource, joining the pods to their owners through kube_pod_owner and
+// kube_replicaset_owner for the workload level.
+func (p *PrometheusClient) TopWorkloads(ctx context.Context, opts TopWorkloadsOptions) (*TopWorkloads, error) {
+	resource, ok := workloadResourceQueries[opts.Resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource %q, expected one of %s", opts.Resource, strings.Join(WorkloadResources, ", "))
+	}
+	if !slices.Contains(WorkloadLevels, opts.Level) {
+		return nil, fmt.Errorf("unknown level %q, expected one of %s", opts.Level, strings.Join(WorkloadLevels, ", "))
+	}
+	if opts.Limit <= 0 {
+		return nil, fmt.Errorf("limit must be a positive number")
+	}
+	if opts.Window == 0 {
+		opts.Window = defaultUsageWindow
+		if opts.Resource == ResourceRestarts {
+			opts.Window = defaultRestartsWindow
+		}
+	}
+	if opts.At.IsZero() {
+		opts.At = time.Now()
+	}
+
+	query := topWorkloadsQuery(resource.query, opts)
+	progress.Report(ctx, "Ranking %s by %s usage", opts.Level, opts.Resource)
+	// A range query over a single point, the evaluation time
+	matrix, err := p.QueryRangeMatrix(ctx, query, opts.At, opts.At, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	top := &TopWorkloads{
+		Resource: opts.Resource,
+		Level:    opts.Level,
+		Unit:     resource.unit,
+		Time:     opts.At.UTC(),
+		Query:    query,
+		Entries:  []WorkloadRank{},
+	}
+	if opts.Resource != ResourceMemory {
+		top.Window = model.Duration(opts.Window).String()
+	}
+
+	for _, stream := range matrix {
+		if len(stream.Values) == 0 {
+			continue
+		}
+		value := float64(stream.Values[len(stream.Values)-1].Value)
+		if math.IsNaN(value) {
+			continue
+		}
+		entry := WorkloadRank{
+			Namespace: string(stream.Metric["namespace"]),
+			Value:     value,
+			Formatted: formatUsage(value, resource.unit),
+		}
+		switch opts.Level {
+		case WorkloadLevelPod:
+			entry.Kind = "Pod"
+			entry.Name = string(stream.Metric["pod"])
+		case WorkloadLevelWorkload:
+			entry.Kind = string(stream.Metric["workload_kind"])
+			entry.Name = string(stream.Metric["workload"])
+		}
+		top.Entries = append(top.Entries, entry)
+	}
+
+	sort.SliceStable(top.Entries, func(i, j int) bool {
+		a, b := top.Entries[i], top.Entries[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	if len(top.Entries) > opts.Limit {
+		top.Entries = top.Entries[:opts.Limit]
+	}
+	for i := range top.Entries {
+		top.Entries[i].Rank = i + 1
+	}
+	top.Table = top.table()
+	return top, nil
+}
+
+// topWorkloadsQuery builds the ranking query from the per pod usage query of
+// a resource.
+func topWorkloadsQuery(usage string, opts TopWorkloadsOptions) string {
+	selector := ""
+	if opts.Namespace != "" {
+		selector = ", namespace=" + strconv.Quote(opts.Namespace)
+	}
+	usage = fmt.Sprintf(usage, selector, model.Duration(opts.Window))
+
+	var aggregated string
+	switch opts.Level {
+	case WorkloadLevelPod:
+		aggregated = usage
+	case WorkloadLevelWorkload:
+		aggregated = fmt.Sprintf("sum by (namespace, workload_kind, workload) (\n  %s\n  * on (namespace, pod) group_left (workload_kind, workload)\n  %s\n)",
+			usage, fmt.Sprintf(podWorkloads, selector))
+	case WorkloadLevelNamespace:
+		aggregated = fmt.Sprintf("sum by (namespace) (%s)", usage)
+	}
+	return fmt.Sprintf("topk(%d, %s)", opts.Limit, aggregated)
+}
+
+// formatUsage formats a value of a resource with its unit.
+func formatUsage(v float64, unit string) string {
+	switch unit {
+	case "bytes":
+		return chart.FormatValue(v, chart.UnitBytes)
+	case "bytes/s":
+		return chart.FormatValue(v, chart.UnitBytes) + "/s"
+	case "restarts":
+		return strconv.FormatFloat(math.Round(v), 'f', 0, 64) + " restarts"
+	}
+	return chart.FormatValue(v, unit)
+}
+
+func (t *TopWorkloads) table() string {
+	var b strings.Builder
+	switch t.Level {
+	case WorkloadLevelNamespace:
+		b.WriteString("| # | Namespace | " + t.Resource + " |\n|---|---|---|\n")
+	default:
+		b.WriteString("| # | Namespace | Kind | Name | " + t.Resource + " |\n|---|---|---|---|---|\n")
+	}
+	for _, e := range t.Entries {
+		switch t.Level {
+		case WorkloadLevelNamespace:
+			fmt.Fprintf(&b, "| %d | %s | %s |\n", e.Rank, e.Namespace, e.Formatted)
+		default:
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n", e.Rank, e.Namespace, e.Kind, e.Name, e.Formatted)
+		}
+	}
+	return b.String()
+}
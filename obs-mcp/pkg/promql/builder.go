@@ -0,0 +1,224 @@
+package promql
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// RangeFunctions are the functions over a range vector that QuerySpec
+// accepts. They all take the range vector as their only argument.
+var RangeFunctions = []string{
+	"rate", "irate", "increase", "delta", "idelta", "deriv", "changes", "resets",
+	"avg_over_time", "min_over_time", "max_over_time", "sum_over_time", "count_over_time",
+	"stddev_over_time", "stdvar_over_time", "last_over_time", "present_over_time",
+}
+
+// Aggregations are the aggregation operators QuerySpec accepts.
+var Aggregations = []string{
+	"sum", "avg", "min", "max", "count", "group", "stddev", "stdvar", "topk", "bottomk", "quantile",
+}
+
+// parameterAggregations need a numeric parameter.
+var parameterAggregations = []string{"topk", "bottomk", "quantile"}
+
+// MatchOperators are the label matcher operators QuerySpec accepts.
+var MatchOperators = []string{"=", "!=", "=~", "!~"}
+
+// ComparisonOperators are the operators QuerySpec accepts for thresholds.
+var ComparisonOperators = []string{"==", "!=", ">", "<", ">=", "<="}
+
+// LabelMatcher is a single label condition of a QuerySpec.
+type LabelMatcher struct {
+	Label string `json:"label"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// QuerySpec is a structured description of a PromQL expression of the form
+// aggregation by (labels) (range_function(metric{matchers}[window])) > threshold,
+// where every part but the metric is optional.
+type QuerySpec struct {
+	Metric        string
+	Matchers      []LabelMatcher
+	RangeFunction string
+	Window        time.Duration
+	Aggregation   string
+	// AggregationParam is the k of topk and bottomk or the quantile.
+	AggregationParam *float64
+	By               []string
+	Without          []string
+	Comparison       string
+	Threshold        *float64
+}
+
+// Build validates spec and returns the PromQL expression in its canonical
+// formatting.
+func Build(spec QuerySpec) (string, error) {
+	if spec.Metric == "" {
+		return "", fmt.Errorf("metric is required")
+	}
+
+	matchers := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, spec.Metric)}
+	for _, m := range spec.Matchers {
+		matcher, err := newMatcher(m)
+		if err != nil {
+			return "", err
+		}
+		matchers = append(matchers, matcher)
+	}
+	query := (&parser.VectorSelector{Name: spec.Metric, LabelMatchers: matchers}).String()
+
+	if spec.RangeFunction != "" {
+		if !slices.Contains(RangeFunctions, spec.RangeFunction) {
+			return "", fmt.Errorf("unsupported range function %q, expected one of: %s", spec.RangeFunction, strings.Join(RangeFunctions, ", "))
+		}
+		if spec.Window <= 0 {
+			return "", fmt.Errorf("range function %s requires a positive window", spec.RangeFunction)
+		}
+		query = fmt.Sprintf("%s(%s[%s])", spec.RangeFunction, query, model.Duration(spec.Window))
+	}
+
+	if len(spec.By) > 0 && len(spec.Without) > 0 {
+		return "", fmt.Errorf("by and without cannot be used together")
+	}
+	if spec.Aggregation != "" {
+		aggregation, err := buildAggregation(spec, query)
+		if err != nil {
+			return "", err
+		}
+		query = aggregation
+	} else if len(spec.By) > 0 || len(spec.Without) > 0 {
+		return "", fmt.Errorf("by and without require an aggregation")
+	}
+
+	if spec.Comparison != "" {
+		if !slices.Contains(ComparisonOperators, spec.Comparison) {
+			return "", fmt.Errorf("unsupported comparison %q, expected one of: %s", spec.Comparison, strings.Join(ComparisonOperators, ", "))
+		}
+		if spec.Threshold == nil {
+			return "", fmt.Errorf("comparison %s requires a threshold", spec.Comparison)
+		}
+		query = fmt.Sprintf("%s %s %s", query, spec.Comparison, formatFloat(*spec.Threshold))
+	} else if spec.Threshold != nil {
+		return "", fmt.Errorf("threshold requires a comparison operator")
+	}
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", fmt.Errorf("built an invalid expression %q: %w", query, err)
+	}
+	return expr.String(), nil
+}
+
+func newMatcher(m LabelMatcher) (*labels.Matcher, error) {
+	if m.Label == "" {
+		return nil, fmt.Errorf("matcher label must not be empty")
+	}
+
+	var matchType labels.MatchType
+	switch m.Op {
+	case "=", "":
+		matchType = labels.MatchEqual
+	case "!=":
+		matchType = labels.MatchNotEqual
+	case "=~":
+		matchType = labels.MatchRegexp
+	case "!~":
+		matchType = labels.MatchNotRegexp
+	default:
+		return nil, fmt.Errorf("unsupported matcher operator %q, expected one of: %s", m.Op, strings.Join(MatchOperators, ", "))
+	}
+
+	matcher, err := labels.NewMatcher(matchType, m.Label, m.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid matcher for label %s: %w", m.Label, err)
+	}
+	return matcher, nil
+}
+
+func buildAggregation(spec QuerySpec, inner string) (string, error) {
+	if !slices.Contains(Aggregations, spec.Aggregation) {
+		return "", fmt.Errorf("unsupported aggregation %q, expected one of: %s", spec.Aggregation, strings.Join(Aggregations, ", "))
+	}
+
+	var b strings.Builder
+	b.WriteString(spec.Aggregation)
+	switch {
+	case len(spec.By) > 0:
+		fmt.Fprintf(&b, " by (%s)", strings.Join(quoteLabelNames(spec.By), ", "))
+	case len(spec.Without) > 0:
+		fmt.Fprintf(&b, " without (%s)", strings.Join(quoteLabelNames(spec.Without), ", "))
+	}
+
+	b.WriteString(" (")
+	if slices.Contains(parameterAggregations, spec.Aggregation) {
+		if spec.AggregationParam == nil {
+			return "", fmt.Errorf("aggregation %s requires a parameter", spec.Aggregation)
+		}
+		b.WriteString(formatFloat(*spec.AggregationParam) + ", ")
+	} else if spec.AggregationParam != nil {
+		return "", fmt.Errorf("aggregation %s does not take a parameter", spec.Aggregation)
+	}
+	b.WriteString(inner + ")")
+	return b.String(), nil
+}
+
+// quoteLabelNames quotes names which are not valid legacy label names, as
+// required by the UTF-8 grouping syntax.
+func quoteLabelNames(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		if model.LegacyValidation.IsValidLabelName(name) {
+			quoted[i] = name
+		} else {
+			quoted[i] = strconv.Quote(name)
+		}
+	}
+	return quoted
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// AddMatchers adds matchers to every vector selector of query, replacing the
+// selectors' own matchers on the same labels, and returns the formatted
+// result.
+func AddMatchers(query string, matchers []LabelMatcher) (string, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", err
+	}
+
+	added := make([]*labels.Matcher, 0, len(matchers))
+	for _, m := range matchers {
+		matcher, err := newMatcher(m)
+		if err != nil {
+			return "", err
+		}
+		if matcher.Name == labels.MetricName {
+			return "", fmt.Errorf("the metric name cannot be filtered, change the query instead")
+		}
+		added = append(added, matcher)
+	}
+
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		vs.LabelMatchers = slices.DeleteFunc(vs.LabelMatchers, func(existing *labels.Matcher) bool {
+			return slices.ContainsFunc(added, func(m *labels.Matcher) bool { return m.Name == existing.Name })
+		})
+		vs.LabelMatchers = append(vs.LabelMatchers, added...)
+		return nil
+	})
+	return expr.String(), nil
+}
@@ -0,0 +1,133 @@
+package promql
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		spec QuerySpec
+		want string
+		err  string
+	}{
+		{
+			name: "selector",
+			spec: QuerySpec{Metric: "up"},
+			want: "up",
+		},
+		{
+			name: "full",
+			spec: QuerySpec{
+				Metric:        "http_requests_total",
+				Matchers:      []LabelMatcher{{Label: "job", Value: "api"}, {Label: "code", Op: "=~", Value: "5.."}},
+				RangeFunction: "rate",
+				Window:        5 * time.Minute,
+				Aggregation:   "sum",
+				By:            []string{"instance", "k8s.pod"},
+				Comparison:    ">",
+				Threshold:     float(0.5),
+			},
+			want: `sum by (instance, "k8s.pod") (rate(http_requests_total{code=~"5..",job="api"}[5m])) > 0.5`,
+		},
+		{
+			name: "parameter aggregation without labels",
+			spec: QuerySpec{Metric: "up", Aggregation: "topk", AggregationParam: float(3), Without: []string{"instance"}},
+			want: "topk without (instance) (3, up)",
+		},
+		{
+			name: "missing metric",
+			spec: QuerySpec{Aggregation: "sum"},
+			err:  "metric is required",
+		},
+		{
+			name: "by and without",
+			spec: QuerySpec{Metric: "up", Aggregation: "sum", By: []string{"job"}, Without: []string{"instance"}},
+			err:  "by and without cannot be used together",
+		},
+		{
+			name: "by without aggregation",
+			spec: QuerySpec{Metric: "up", By: []string{"job"}},
+			err:  "by and without require an aggregation",
+		},
+		{
+			name: "threshold without comparison",
+			spec: QuerySpec{Metric: "up", Threshold: float(1)},
+			err:  "threshold requires a comparison operator",
+		},
+		{
+			name: "comparison without threshold",
+			spec: QuerySpec{Metric: "up", Comparison: ">"},
+			err:  "comparison > requires a threshold",
+		},
+		{
+			name: "invalid comparison",
+			spec: QuerySpec{Metric: "up", Comparison: "=>", Threshold: float(1)},
+			err:  `unsupported comparison "=>"`,
+		},
+		{
+			name: "invalid matcher operator",
+			spec: QuerySpec{Metric: "up", Matchers: []LabelMatcher{{Label: "job", Op: "~=", Value: "api"}}},
+			err:  `unsupported matcher operator "~="`,
+		},
+		{
+			name: "invalid matcher regex",
+			spec: QuerySpec{Metric: "up", Matchers: []LabelMatcher{{Label: "job", Op: "=~", Value: "api("}}},
+			err:  "invalid matcher for label job",
+		},
+		{
+			name: "range function without window",
+			spec: QuerySpec{Metric: "http_requests_total", RangeFunction: "rate"},
+			err:  "range function rate requires a positive window",
+		},
+		{
+			name: "unsupported range function",
+			spec: QuerySpec{Metric: "http_requests_total", RangeFunction: "histogram_quantile", Window: time.Minute},
+			err:  `unsupported range function "histogram_quantile"`,
+		},
+		{
+			name: "missing aggregation parameter",
+			spec: QuerySpec{Metric: "up", Aggregation: "quantile"},
+			err:  "aggregation quantile requires a parameter",
+		},
+		{
+			name: "unexpected aggregation parameter",
+			spec: QuerySpec{Metric: "up", Aggregation: "sum", AggregationParam: float(1)},
+			err:  "aggregation sum does not take a parameter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Build(tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %q, %v", tt.err, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+
+			// The output is canonical: it round-trips through the parser
+			expr, err := parser.ParseExpr(got)
+			if err != nil {
+				t.Fatalf("built an invalid query %s: %v", got, err)
+			}
+			if expr.String() != got {
+				t.Errorf("expected %s to round-trip, got %s", got, expr.String())
+			}
+		})
+	}
+}
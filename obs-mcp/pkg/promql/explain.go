@@ -0,0 +1,657 @@
+package promql
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Explanation is a plain-English description of a PromQL expression.
+type Explanation struct {
+	Query        string       `json:"query"`
+	ResultType   string       `json:"resultType"`
+	Steps        []string     `json:"steps"`
+	OutputLabels OutputLabels `json:"outputLabels"`
+}
+
+// OutputLabels describes the label set of the series an expression returns.
+type OutputLabels struct {
+	// Exact is true when the result carries exactly Labels. Otherwise the
+	// result keeps the labels of the selected series, of which Labels are
+	// known to be present and Excluded are known to be removed.
+	Exact       bool     `json:"exact"`
+	Labels      []string `json:"labels"`
+	Excluded    []string `json:"excluded,omitempty"`
+	Description string   `json:"description"`
+}
+
+// Explain parses query and walks its AST bottom-up, producing one step per
+// operation along with the label set of the final result.
+func Explain(query string) (*Explanation, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &explainer{}
+	_, ls := e.explain(expr)
+
+	return &Explanation{
+		Query:        expr.String(),
+		ResultType:   string(expr.Type()),
+		Steps:        e.steps,
+		OutputLabels: ls.output(expr.Type()),
+	}, nil
+}
+
+type explainer struct {
+	steps []string
+}
+
+// addStep records a step and returns the reference later steps use for it.
+func (e *explainer) addStep(format string, args ...any) string {
+	e.steps = append(e.steps, fmt.Sprintf("Step %d: ", len(e.steps)+1)+fmt.Sprintf(format, args...))
+	return fmt.Sprintf("step %d", len(e.steps))
+}
+
+// explain describes node and returns a short reference to its value together
+// with the labels it produces.
+func (e *explainer) explain(node parser.Expr) (string, *labelSet) {
+	switch n := node.(type) {
+	case *parser.ParenExpr:
+		return e.explain(n.Expr)
+	case *parser.StepInvariantExpr:
+		return e.explain(n.Expr)
+	case *parser.NumberLiteral:
+		return "the number " + strconv.FormatFloat(n.Val, 'g', -1, 64), newExactLabelSet()
+	case *parser.StringLiteral:
+		return strconv.Quote(n.Val), newExactLabelSet()
+	case *parser.VectorSelector:
+		return e.explainVectorSelector(n), selectorLabelSet(n)
+	case *parser.MatrixSelector:
+		vs := n.VectorSelector.(*parser.VectorSelector)
+		ref := e.explainVectorSelector(vs)
+		return e.addStep("For every evaluation timestamp, take the raw samples of each series from %s within the preceding %s window.",
+			ref, formatDuration(n.Range)), selectorLabelSet(vs)
+	case *parser.SubqueryExpr:
+		return e.explainSubquery(n)
+	case *parser.UnaryExpr:
+		ref, ls := e.explain(n.Expr)
+		if n.Op == parser.SUB {
+			ls.drop(labels.MetricName)
+			return e.addStep("Negate every value of %s.", ref), ls
+		}
+		return ref, ls
+	case *parser.Call:
+		return e.explainCall(n)
+	case *parser.AggregateExpr:
+		return e.explainAggregation(n)
+	case *parser.BinaryExpr:
+		return e.explainBinary(n)
+	}
+	return e.addStep("Evaluate %s.", node.String()), newLabelSet()
+}
+
+func (e *explainer) explainVectorSelector(vs *parser.VectorSelector) string {
+	var conditions []string
+	for _, m := range vs.LabelMatchers {
+		if vs.Name != "" && m.Name == labels.MetricName {
+			continue
+		}
+		conditions = append(conditions, describeMatcher(m))
+	}
+
+	var b strings.Builder
+	if vs.Name != "" {
+		fmt.Fprintf(&b, "Select the series of metric `%s`", vs.Name)
+	} else {
+		b.WriteString("Select all series")
+	}
+	if len(conditions) > 0 {
+		b.WriteString(" where " + strings.Join(conditions, " and "))
+	}
+	if vs.OriginalOffset > 0 {
+		fmt.Fprintf(&b, ", shifted %s into the past (offset)", formatDuration(vs.OriginalOffset))
+	} else if vs.OriginalOffset < 0 {
+		fmt.Fprintf(&b, ", shifted %s into the future (negative offset)", formatDuration(-vs.OriginalOffset))
+	}
+	b.WriteString(describeAt(vs.Timestamp, vs.StartOrEnd))
+	b.WriteString(".")
+	return e.addStep("%s", b.String())
+}
+
+func (e *explainer) explainSubquery(n *parser.SubqueryExpr) (string, *labelSet) {
+	ref, ls := e.explain(n.Expr)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Evaluate %s repeatedly over the preceding %s window", ref, formatDuration(n.Range))
+	if n.Step > 0 {
+		fmt.Fprintf(&b, " at a %s resolution", formatDuration(n.Step))
+	} else {
+		b.WriteString(" at the default evaluation interval")
+	}
+	b.WriteString(" (subquery), producing a range of values for each series")
+	if n.OriginalOffset > 0 {
+		fmt.Fprintf(&b, ", shifted %s into the past (offset)", formatDuration(n.OriginalOffset))
+	}
+	b.WriteString(describeAt(n.Timestamp, n.StartOrEnd))
+	b.WriteString(".")
+	return e.addStep("%s", b.String()), ls
+}
+
+func (e *explainer) explainCall(n *parser.Call) (string, *labelSet) {
+	refs := make([]string, len(n.Args))
+	sets := make([]*labelSet, len(n.Args))
+	for i, arg := range n.Args {
+		refs[i], sets[i] = e.explain(arg)
+	}
+
+	name := n.Func.Name
+	var ls *labelSet
+	switch {
+	case len(n.Args) == 0 || n.Func.ReturnType == parser.ValueTypeScalar:
+		ls = newExactLabelSet()
+	case name == "vector":
+		ls = newExactLabelSet()
+	case name == "absent" || name == "absent_over_time":
+		ls = newExactLabelSet()
+		if vs := selectorOf(n.Args[0]); vs != nil {
+			for _, m := range vs.LabelMatchers {
+				if m.Type == labels.MatchEqual && m.Name != labels.MetricName {
+					ls.add(m.Name)
+				}
+			}
+		}
+	default:
+		ls = sets[argumentIndex(n)]
+		if !slices.Contains(nameKeepingFunctions, name) {
+			ls.drop(labels.MetricName)
+		}
+		switch name {
+		case "histogram_quantile", "histogram_fraction":
+			ls.drop(model.BucketLabel)
+		case "label_replace", "label_join":
+			if dst, ok := n.Args[1].(*parser.StringLiteral); ok {
+				ls.add(dst.Val)
+			}
+		}
+	}
+
+	description, ok := functionDescriptions[name]
+	if !ok {
+		description = fmt.Sprintf("apply the `%s` function", name)
+	}
+
+	step := fmt.Sprintf("Compute `%s`: %s", name, description)
+	if len(refs) > 0 {
+		step += fmt.Sprintf(", using %s", joinRefs(refs))
+	}
+	return e.addStep("%s.", step), ls
+}
+
+func (e *explainer) explainAggregation(n *parser.AggregateExpr) (string, *labelSet) {
+	var paramRef string
+	if n.Param != nil {
+		paramRef, _ = e.explain(n.Param)
+	}
+	ref, ls := e.explain(n.Expr)
+
+	op := n.Op.String()
+	description, ok := aggregationDescriptions[op]
+	if !ok {
+		description = fmt.Sprintf("apply the `%s` aggregation to", op)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Aggregate with `%s`: %s the values of %s", op, description, ref)
+	if paramRef != "" {
+		fmt.Fprintf(&b, " (parameter: %s)", paramRef)
+	}
+
+	switch op {
+	case "topk", "bottomk", "limitk", "limit_ratio":
+		// Selection aggregations return input series unchanged.
+		if len(n.Grouping) > 0 {
+			fmt.Fprintf(&b, ", separately within each group of %s %s", groupingKind(n.Without), formatLabels(n.Grouping))
+		}
+		b.WriteString("; the selected series keep all their labels")
+		return e.addStep("%s.", b.String()), ls
+	}
+
+	switch {
+	case n.Without:
+		fmt.Fprintf(&b, ", producing one series per distinct combination of all labels except %s", formatLabels(n.Grouping))
+		ls.without(n.Grouping)
+		ls.drop(labels.MetricName)
+	case len(n.Grouping) > 0:
+		fmt.Fprintf(&b, ", producing one series per distinct combination of %s", formatLabels(n.Grouping))
+		ls.keep(n.Grouping)
+	default:
+		b.WriteString(" across all series, producing a single series without labels")
+		ls.keep(nil)
+	}
+	if op == "count_values" {
+		if label, ok := n.Param.(*parser.StringLiteral); ok {
+			fmt.Fprintf(&b, "; each distinct value is stored in the `%s` label", label.Val)
+			ls.add(label.Val)
+		}
+	}
+	return e.addStep("%s.", b.String()), ls
+}
+
+func (e *explainer) explainBinary(n *parser.BinaryExpr) (string, *labelSet) {
+	lhsRef, lhs := e.explain(n.LHS)
+	rhsRef, rhs := e.explain(n.RHS)
+
+	lhsScalar := n.LHS.Type() == parser.ValueTypeScalar
+	rhsScalar := n.RHS.Type() == parser.ValueTypeScalar
+
+	var b strings.Builder
+	switch {
+	case n.Op.IsSetOperator():
+		b.WriteString(describeSetOperation(n.Op, lhsRef, rhsRef))
+	case n.Op.IsComparisonOperator() && !n.ReturnBool && lhsScalar && !rhsScalar:
+		fmt.Fprintf(&b, "Keep only the series of %s for which %s is %s their value; other series are dropped",
+			rhsRef, lhsRef, comparisonDescriptions[n.Op.String()])
+	case n.Op.IsComparisonOperator() && !n.ReturnBool && !(lhsScalar && rhsScalar):
+		fmt.Fprintf(&b, "Keep only the series of %s whose value is %s %s; other series are dropped",
+			lhsRef, comparisonDescriptions[n.Op.String()], rhsRef)
+	case n.Op.IsComparisonOperator():
+		fmt.Fprintf(&b, "Compare whether %s is %s %s, returning 1 for true and 0 for false",
+			lhsRef, comparisonDescriptions[n.Op.String()], rhsRef)
+	default:
+		fmt.Fprintf(&b, "%s", describeArithmetic(n.Op, lhsRef, rhsRef))
+	}
+
+	filter := n.Op.IsComparisonOperator() && !n.ReturnBool
+
+	var ls *labelSet
+	switch {
+	case lhsScalar && rhsScalar:
+		ls = newExactLabelSet()
+	case rhsScalar || lhsScalar:
+		ls = lhs
+		if lhsScalar {
+			ls = rhs
+		}
+		if !filter {
+			b.WriteString(", applied to every series")
+		}
+	default:
+		ls = e.vectorMatchingLabels(n, lhs, rhs, &b)
+	}
+
+	if !n.Op.IsSetOperator() && !filter {
+		ls.drop(labels.MetricName)
+	}
+	return e.addStep("%s.", b.String()), ls
+}
+
+func (e *explainer) vectorMatchingLabels(n *parser.BinaryExpr, lhs, rhs *labelSet, b *strings.Builder) *labelSet {
+	vm := n.VectorMatching
+	if vm == nil {
+		vm = &parser.VectorMatching{Card: parser.CardOneToOne}
+	}
+
+	switch {
+	case vm.On:
+		fmt.Fprintf(b, ", pairing series that have equal values of %s", formatLabels(vm.MatchingLabels))
+	case len(vm.MatchingLabels) > 0:
+		fmt.Fprintf(b, ", pairing series that have identical labels apart from %s", formatLabels(vm.MatchingLabels))
+	default:
+		b.WriteString(", pairing series that have identical label sets (ignoring the metric name)")
+	}
+
+	switch n.Op {
+	case parser.LOR:
+		return lhs.union(rhs)
+	case parser.LAND, parser.LUNLESS:
+		return lhs
+	}
+
+	switch vm.Card {
+	case parser.CardManyToOne, parser.CardOneToMany:
+		many, one := "left", "right"
+		result := lhs
+		if vm.Card == parser.CardOneToMany {
+			many, one = "right", "left"
+			result = rhs
+		}
+		fmt.Fprintf(b, " (%s: several series on the %s side may match the same series on the %s side", vm.Card, many, one)
+		if len(vm.Include) > 0 {
+			fmt.Fprintf(b, ", and %s are copied from the %s side", formatLabels(vm.Include), one)
+			for _, l := range vm.Include {
+				result.add(l)
+			}
+		}
+		b.WriteString(")")
+		return result
+	default:
+		b.WriteString("; series without a match on the other side are dropped")
+		if vm.On {
+			lhs.keep(vm.MatchingLabels)
+		} else {
+			lhs.without(vm.MatchingLabels)
+		}
+		return lhs
+	}
+}
+
+func describeMatcher(m *labels.Matcher) string {
+	switch m.Type {
+	case labels.MatchEqual:
+		if m.Value == "" {
+			return fmt.Sprintf("label `%s` is empty or missing", m.Name)
+		}
+		return fmt.Sprintf("`%s` equals %q", m.Name, m.Value)
+	case labels.MatchNotEqual:
+		return fmt.Sprintf("`%s` is not %q", m.Name, m.Value)
+	case labels.MatchRegexp:
+		return fmt.Sprintf("`%s` fully matches the regex %q", m.Name, m.Value)
+	case labels.MatchNotRegexp:
+		return fmt.Sprintf("`%s` does not match the regex %q", m.Name, m.Value)
+	}
+	return m.String()
+}
+
+func describeAt(ts *int64, startOrEnd parser.ItemType) string {
+	switch {
+	case startOrEnd == parser.START:
+		return ", pinned to the start of the query range (@ start())"
+	case startOrEnd == parser.END:
+		return ", pinned to the end of the query range (@ end())"
+	case ts != nil:
+		return fmt.Sprintf(", pinned to %s (@ modifier)", time.UnixMilli(*ts).UTC().Format(time.RFC3339))
+	}
+	return ""
+}
+
+func describeSetOperation(op parser.ItemType, lhs, rhs string) string {
+	switch op {
+	case parser.LAND:
+		return fmt.Sprintf("Keep the series of %s that also exist in %s (and)", lhs, rhs)
+	case parser.LOR:
+		return fmt.Sprintf("Combine all series of %s with the series of %s that have no counterpart in %s (or)", lhs, rhs, lhs)
+	default:
+		return fmt.Sprintf("Keep the series of %s that do not exist in %s (unless)", lhs, rhs)
+	}
+}
+
+func describeArithmetic(op parser.ItemType, lhs, rhs string) string {
+	switch op {
+	case parser.ADD:
+		return fmt.Sprintf("Add %s and %s", lhs, rhs)
+	case parser.SUB:
+		return fmt.Sprintf("Subtract %s from %s", rhs, lhs)
+	case parser.MUL:
+		return fmt.Sprintf("Multiply %s by %s", lhs, rhs)
+	case parser.DIV:
+		return fmt.Sprintf("Divide %s by %s", lhs, rhs)
+	case parser.MOD:
+		return fmt.Sprintf("Compute the remainder of %s divided by %s", lhs, rhs)
+	case parser.POW:
+		return fmt.Sprintf("Raise %s to the power of %s", lhs, rhs)
+	case parser.ATAN2:
+		return fmt.Sprintf("Compute atan2 of %s and %s", lhs, rhs)
+	}
+	return fmt.Sprintf("Combine %s and %s with `%s`", lhs, rhs, op)
+}
+
+func groupingKind(without bool) string {
+	if without {
+		return "all labels except"
+	}
+	return "labels"
+}
+
+func joinRefs(refs []string) string {
+	switch len(refs) {
+	case 1:
+		return refs[0]
+	case 2:
+		return refs[0] + " and " + refs[1]
+	}
+	return strings.Join(refs[:len(refs)-1], ", ") + " and " + refs[len(refs)-1]
+}
+
+func formatLabels(names []string) string {
+	if len(names) == 0 {
+		return "no labels"
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "`" + name + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func formatDuration(d time.Duration) string {
+	return model.Duration(d).String()
+}
+
+// selectorOf returns the vector selector directly referenced by expr, if any.
+func selectorOf(expr parser.Expr) *parser.VectorSelector {
+	switch n := expr.(type) {
+	case *parser.VectorSelector:
+		return n
+	case *parser.MatrixSelector:
+		return n.VectorSelector.(*parser.VectorSelector)
+	case *parser.ParenExpr:
+		return selectorOf(n.Expr)
+	case *parser.StepInvariantExpr:
+		return selectorOf(n.Expr)
+	}
+	return nil
+}
+
+// argumentIndex returns the index of the argument whose labels a function
+// call carries over to its result.
+func argumentIndex(n *parser.Call) int {
+	for i, t := range n.Func.ArgTypes {
+		if i < len(n.Args) && (t == parser.ValueTypeVector || t == parser.ValueTypeMatrix) {
+			return i
+		}
+	}
+	return 0
+}
+
+// nameKeepingFunctions lists functions that return their input samples
+// unchanged and therefore keep the metric name.
+var nameKeepingFunctions = []string{
+	"first_over_time", "last_over_time", "label_join", "label_replace",
+	"sort", "sort_by_label", "sort_by_label_desc", "sort_desc",
+}
+
+var functionDescriptions = map[string]string{
+	"abs":                          "the absolute value of each sample",
+	"absent":                       "returns 1 if the selector matches no series, and nothing otherwise",
+	"absent_over_time":             "returns 1 if the selector had no samples in the window, and nothing otherwise",
+	"avg_over_time":                "the average of each series' samples within the window",
+	"ceil":                         "round each value up to the nearest integer",
+	"changes":                      "how many times each series changed its value within the window",
+	"clamp":                        "limit each value to the given minimum and maximum",
+	"clamp_max":                    "limit each value to the given maximum",
+	"clamp_min":                    "limit each value to the given minimum",
+	"count_over_time":              "the number of samples of each series within the window",
+	"delta":                        "the difference between the first and last value of each gauge series within the window",
+	"deriv":                        "the per-second derivative of each gauge series within the window, using linear regression",
+	"exp":                          "e raised to the power of each value",
+	"floor":                        "round each value down to the nearest integer",
+	"histogram_quantile":           "estimate the given quantile from the histogram buckets (`le` label), per remaining label set",
+	"histogram_fraction":           "estimate the fraction of observations between the given bounds of the histogram",
+	"histogram_count":              "the number of observations of each native histogram",
+	"histogram_sum":                "the sum of observations of each native histogram",
+	"histogram_avg":                "the average observation of each native histogram",
+	"idelta":                       "the difference between the last two samples of each gauge series within the window",
+	"increase":                     "how much each counter increased within the window, corrected for counter resets and extrapolated to the window boundaries",
+	"irate":                        "the per-second rate of increase of each counter based on the last two samples within the window",
+	"label_join":                   "join the values of the source labels into the destination label",
+	"label_replace":                "write a regex replacement of the source label into the destination label",
+	"last_over_time":               "the most recent sample of each series within the window",
+	"first_over_time":              "the oldest sample of each series within the window",
+	"ln":                           "the natural logarithm of each value",
+	"max_over_time":                "the maximum of each series' samples within the window",
+	"min_over_time":                "the minimum of each series' samples within the window",
+	"predict_linear":               "predict the value of each series the given number of seconds from now, using linear regression over the window",
+	"present_over_time":            "returns 1 for each series that had any sample within the window",
+	"quantile_over_time":           "the given quantile of each series' samples within the window",
+	"rate":                         "the per-second average rate of increase of each counter within the window, corrected for counter resets",
+	"resets":                       "how many times each counter was reset within the window",
+	"round":                        "round each value to the nearest integer (or multiple of the given number)",
+	"scalar":                       "convert the single-series input into a scalar (NaN if it does not contain exactly one series)",
+	"sort":                         "sort the series by value in ascending order",
+	"sort_desc":                    "sort the series by value in descending order",
+	"sqrt":                         "the square root of each value",
+	"stddev_over_time":             "the standard deviation of each series' samples within the window",
+	"sum_over_time":                "the sum of each series' samples within the window",
+	"time":                         "the evaluation timestamp in seconds since the Unix epoch",
+	"timestamp":                    "the timestamp of each sample in seconds since the Unix epoch",
+	"vector":                       "convert the scalar into a single series without labels",
+	"double_exponential_smoothing": "smooth each series within the window using double exponential smoothing",
+}
+
+var aggregationDescriptions = map[string]string{
+	"sum":          "add up",
+	"avg":          "average",
+	"min":          "take the minimum of",
+	"max":          "take the maximum of",
+	"count":        "count the series in",
+	"group":        "group (value 1) the series of",
+	"stddev":       "compute the standard deviation of",
+	"stdvar":       "compute the variance of",
+	"quantile":     "compute the given quantile of",
+	"count_values": "count the series with each distinct value in",
+	"topk":         "select the series with the largest values from",
+	"bottomk":      "select the series with the smallest values from",
+	"limitk":       "select a deterministic sample of series from",
+	"limit_ratio":  "select a deterministic ratio of series from",
+}
+
+var comparisonDescriptions = map[string]string{
+	"==": "equal to",
+	"!=": "not equal to",
+	">":  "greater than",
+	"<":  "less than",
+	">=": "greater than or equal to",
+	"<=": "less than or equal to",
+}
+
+// labelSet tracks what is known about the labels of intermediate results.
+type labelSet struct {
+	exact    bool
+	labels   map[string]struct{}
+	excluded map[string]struct{}
+}
+
+func newLabelSet() *labelSet {
+	return &labelSet{labels: map[string]struct{}{}, excluded: map[string]struct{}{}}
+}
+
+func newExactLabelSet() *labelSet {
+	ls := newLabelSet()
+	ls.exact = true
+	return ls
+}
+
+// selectorLabelSet returns the labels known to be present on every series a
+// selector matches.
+func selectorLabelSet(vs *parser.VectorSelector) *labelSet {
+	ls := newLabelSet()
+	for _, m := range vs.LabelMatchers {
+		if !m.Matches("") {
+			ls.add(m.Name)
+		}
+	}
+	return ls
+}
+
+func (ls *labelSet) add(name string) {
+	ls.labels[name] = struct{}{}
+	delete(ls.excluded, name)
+}
+
+func (ls *labelSet) drop(name string) {
+	delete(ls.labels, name)
+	if !ls.exact {
+		ls.excluded[name] = struct{}{}
+	}
+}
+
+func (ls *labelSet) keep(names []string) {
+	ls.exact = true
+	ls.labels = map[string]struct{}{}
+	ls.excluded = map[string]struct{}{}
+	for _, name := range names {
+		ls.labels[name] = struct{}{}
+	}
+}
+
+func (ls *labelSet) without(names []string) {
+	for _, name := range names {
+		ls.drop(name)
+	}
+}
+
+func (ls *labelSet) union(other *labelSet) *labelSet {
+	result := newLabelSet()
+	result.exact = ls.exact && other.exact
+	for name := range ls.labels {
+		if _, ok := other.labels[name]; ok || result.exact {
+			result.labels[name] = struct{}{}
+		}
+	}
+	for name := range other.labels {
+		if result.exact {
+			result.labels[name] = struct{}{}
+		}
+	}
+	for name := range ls.excluded {
+		if _, ok := other.excluded[name]; ok {
+			result.excluded[name] = struct{}{}
+		}
+	}
+	return result
+}
+
+func (ls *labelSet) output(valueType parser.ValueType) OutputLabels {
+	if valueType == parser.ValueTypeScalar || valueType == parser.ValueTypeString {
+		return OutputLabels{Exact: true, Labels: []string{}, Description: fmt.Sprintf("a %s has no labels", valueType)}
+	}
+
+	out := OutputLabels{
+		Exact:    ls.exact,
+		Labels:   sortedKeys(ls.labels),
+		Excluded: sortedKeys(ls.excluded),
+	}
+	switch {
+	case ls.exact && len(out.Labels) == 0:
+		out.Description = "the result has no labels"
+	case ls.exact:
+		out.Description = "the result has exactly the labels " + formatLabels(out.Labels)
+	default:
+		out.Description = "the result keeps the labels of the selected series"
+		if len(out.Excluded) > 0 {
+			out.Description += " except " + formatLabels(out.Excluded)
+		}
+		if len(out.Labels) > 0 {
+			out.Description += "; it always includes " + formatLabels(out.Labels)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,145 @@
+package promql
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		query string
+		// steps holds a fragment expected in each step, in order
+		steps    []string
+		exact    bool
+		labels   []string
+		excluded []string
+	}{
+		{
+			query: `sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))`,
+			steps: []string{
+				"`code` fully matches the regex \"5..\"",
+				"within the preceding 5m window",
+				"Compute `rate`",
+				"one series per distinct combination of `job`",
+			},
+			exact:  true,
+			labels: []string{"job"},
+		},
+		{
+			query:    `sum without (instance) (up)`,
+			steps:    []string{"metric `up`", "all labels except `instance`"},
+			labels:   []string{},
+			excluded: []string{"__name__", "instance"},
+		},
+		{
+			query:    `rate(http_requests_total[5m] offset 1h)`,
+			steps:    []string{"shifted 1h into the past (offset)", "5m window", "Compute `rate`"},
+			labels:   []string{},
+			excluded: []string{"__name__"},
+		},
+		{
+			query:  `http_requests_total @ 1700000000`,
+			steps:  []string{"pinned to 2023-11-14T22:13:20Z (@ modifier)"},
+			labels: []string{"__name__"},
+		},
+		{
+			query:  `up @ end()`,
+			steps:  []string{"pinned to the end of the query range (@ end())"},
+			labels: []string{"__name__"},
+		},
+		{
+			query: `a / on (job) group_left (team) b`,
+			steps: []string{
+				"metric `a`",
+				"metric `b`",
+				"Divide step 1 by step 2, pairing series that have equal values of `job` (many-to-one",
+			},
+			labels:   []string{"team"},
+			excluded: []string{"__name__"},
+		},
+		{
+			query:    `a * ignoring (code) b`,
+			steps:    []string{"metric `a`", "metric `b`", "identical labels apart from `code`"},
+			labels:   []string{},
+			excluded: []string{"__name__", "code"},
+		},
+		{
+			query:  `a and on (job) b`,
+			steps:  []string{"metric `a`", "metric `b`", "Keep the series of step 1 that also exist in step 2 (and)"},
+			labels: []string{"__name__"},
+		},
+		{
+			query:  `topk(3, sum by (pod) (x))`,
+			steps:  []string{"metric `x`", "combination of `pod`", "the selected series keep all their labels"},
+			exact:  true,
+			labels: []string{"pod"},
+		},
+		{
+			query:  `count_values("v", up)`,
+			steps:  []string{"metric `up`", "stored in the `v` label"},
+			exact:  true,
+			labels: []string{"v"},
+		},
+		{
+			query:  `histogram_quantile(0.9, sum by (le) (rate(x_bucket[5m])))`,
+			steps:  []string{"x_bucket", "5m window", "Compute `rate`", "combination of `le`", "Compute `histogram_quantile`"},
+			exact:  true,
+			labels: []string{},
+		},
+		{
+			query:  `label_replace(up, "host", "$1", "instance", "(.*):.*")`,
+			steps:  []string{"metric `up`", "Compute `label_replace`"},
+			labels: []string{"__name__", "host"},
+		},
+		{
+			query:    `max_over_time(up[1h:5m])`,
+			steps:    []string{"metric `up`", "over the preceding 1h window at a 5m resolution (subquery)", "Compute `max_over_time`"},
+			labels:   []string{},
+			excluded: []string{"__name__"},
+		},
+		{
+			query:  `up > 0`,
+			steps:  []string{"metric `up`", "Keep only the series of step 1 whose value is greater than the number 0"},
+			labels: []string{"__name__"},
+		},
+		{
+			query:    `up > bool 0`,
+			steps:    []string{"metric `up`", "returning 1 for true and 0 for false"},
+			labels:   []string{},
+			excluded: []string{"__name__"},
+		},
+		{
+			query:  `time()`,
+			steps:  []string{"Compute `time`"},
+			exact:  true,
+			labels: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			ex, err := Explain(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ex.Steps) != len(tt.steps) {
+				t.Fatalf("expected %d steps, got %q", len(tt.steps), ex.Steps)
+			}
+			for i, fragment := range tt.steps {
+				if !strings.Contains(ex.Steps[i], fragment) {
+					t.Errorf("step %d %q does not contain %q", i+1, ex.Steps[i], fragment)
+				}
+			}
+			out := ex.OutputLabels
+			if out.Exact != tt.exact || !slices.Equal(out.Labels, tt.labels) || !slices.Equal(out.Excluded, tt.excluded) {
+				t.Errorf("unexpected output labels %+v", out)
+			}
+		})
+	}
+}
+
+func TestExplainInvalid(t *testing.T) {
+	if _, err := Explain(`sum(rate(x[5m])`); err == nil {
+		t.Error("expected a parse error")
+	}
+}
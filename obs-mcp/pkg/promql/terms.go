@@ -0,0 +1,121 @@
+package promql
+
+import (
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Term is an operand of one of the binary operators an expression is built
+// of, such as the left-hand side of the threshold comparison of an alert.
+type Term struct {
+	Expr string `json:"expr"`
+	// Condition is set when the term is compared against a constant.
+	Condition *Condition `json:"condition,omitempty"`
+}
+
+// Condition is a comparison of a term against a constant threshold.
+type Condition struct {
+	Op        string  `json:"op"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Holds reports whether v satisfies the condition.
+func (c *Condition) Holds(v float64) bool {
+	switch c.Op {
+	case "==":
+		return v == c.Threshold
+	case "!=":
+		return v != c.Threshold
+	case ">":
+		return v > c.Threshold
+	case "<":
+		return v < c.Threshold
+	case ">=":
+		return v >= c.Threshold
+	case "<=":
+		return v <= c.Threshold
+	}
+	return false
+}
+
+// Terms breaks query down into the operands of its binary operators,
+// outermost first. Number literals are left out; a term compared against one
+// carries the comparison as its condition. Operands which are not binary
+// expressions themselves, such as aggregations or function calls, are not
+// broken down further.
+func Terms(query string) ([]Term, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []Term
+	seen := map[string]bool{}
+	add := func(term Term) {
+		if !seen[term.Expr] {
+			seen[term.Expr] = true
+			terms = append(terms, term)
+		}
+	}
+
+	var walk func(parser.Expr)
+	walk = func(node parser.Expr) {
+		bin, ok := unwrap(node).(*parser.BinaryExpr)
+		if !ok {
+			return
+		}
+		lhs, rhs := unwrap(bin.LHS), unwrap(bin.RHS)
+		lhsNum, lhsIsNum := lhs.(*parser.NumberLiteral)
+		rhsNum, rhsIsNum := rhs.(*parser.NumberLiteral)
+
+		if bin.Op.IsComparisonOperator() && !bin.ReturnBool && lhsIsNum != rhsIsNum {
+			if rhsIsNum {
+				add(Term{Expr: lhs.String(), Condition: &Condition{Op: bin.Op.String(), Threshold: rhsNum.Val}})
+				walk(lhs)
+			} else {
+				add(Term{Expr: rhs.String(), Condition: &Condition{Op: flipComparison(bin.Op.String()), Threshold: lhsNum.Val}})
+				walk(rhs)
+			}
+			return
+		}
+
+		for _, operand := range []parser.Expr{lhs, rhs} {
+			if _, isNum := operand.(*parser.NumberLiteral); isNum {
+				continue
+			}
+			add(Term{Expr: operand.String()})
+			walk(operand)
+		}
+	}
+	walk(expr)
+
+	return terms, nil
+}
+
+func unwrap(node parser.Expr) parser.Expr {
+	for {
+		switch n := node.(type) {
+		case *parser.ParenExpr:
+			node = n.Expr
+		case *parser.StepInvariantExpr:
+			node = n.Expr
+		default:
+			return node
+		}
+	}
+}
+
+// flipComparison returns the operator for swapped operands, e.g. "<" for
+// "0.5 > x".
+func flipComparison(op string) string {
+	switch op {
+	case ">":
+		return "<"
+	case "<":
+		return ">"
+	case ">=":
+		return "<="
+	case "<=":
+		return ">="
+	}
+	return op
+}
@@ -0,0 +1,120 @@
+package promql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Term
+	}{
+		{
+			query: "up",
+			want:  nil,
+		},
+		{
+			query: `sum(rate(errors_total[5m])) / sum(rate(requests_total[5m])) > 0.05`,
+			want: []Term{
+				{Expr: "sum(rate(errors_total[5m])) / sum(rate(requests_total[5m]))", Condition: &Condition{Op: ">", Threshold: 0.05}},
+				{Expr: "sum(rate(errors_total[5m]))"},
+				{Expr: "sum(rate(requests_total[5m]))"},
+			},
+		},
+		{
+			query: `0.9 < node_memory_used_ratio`,
+			want: []Term{
+				{Expr: "node_memory_used_ratio", Condition: &Condition{Op: ">", Threshold: 0.9}},
+			},
+		},
+		{
+			query: `up == 0 and on (job) job:critical unless on (instance) maintenance or absent(up)`,
+			want: []Term{
+				{Expr: "up == 0 and on (job) job:critical unless on (instance) maintenance"},
+				{Expr: "up == 0 and on (job) job:critical"},
+				{Expr: "up == 0"},
+				{Expr: "up", Condition: &Condition{Op: "==", Threshold: 0}},
+				{Expr: "job:critical"},
+				{Expr: "maintenance"},
+				{Expr: "absent(up)"},
+			},
+		},
+		{
+			query: `((disk_free / (disk_size)) * 100) < (10)`,
+			want: []Term{
+				{Expr: "(disk_free / (disk_size)) * 100", Condition: &Condition{Op: "<", Threshold: 10}},
+				{Expr: "disk_free / (disk_size)"},
+				{Expr: "disk_free"},
+				{Expr: "disk_size"},
+			},
+		},
+		{
+			// bool comparisons return 0 or 1 instead of filtering, so they
+			// are no condition
+			query: `sum(up > bool 0) < 2`,
+			want: []Term{
+				{Expr: "sum(up > bool 0)", Condition: &Condition{Op: "<", Threshold: 2}},
+			},
+		},
+		{
+			query: `up > bool 0`,
+			want: []Term{
+				{Expr: "up"},
+			},
+		},
+		{
+			// Repeated operands are reported once
+			query: `rate(a[5m]) > 1 or rate(a[5m]) < -1`,
+			want: []Term{
+				{Expr: "rate(a[5m]) > 1"},
+				{Expr: "rate(a[5m])", Condition: &Condition{Op: ">", Threshold: 1}},
+				{Expr: "rate(a[5m]) < -1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := Terms(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected terms")
+				for _, term := range tt.want {
+					t.Errorf("  %s %+v", term.Expr, term.Condition)
+				}
+				t.Errorf("got")
+				for _, term := range got {
+					t.Errorf("  %s %+v", term.Expr, term.Condition)
+				}
+			}
+		})
+	}
+
+	if _, err := Terms("up >"); err == nil {
+		t.Error("expected an invalid query to be rejected")
+	}
+}
+
+func TestConditionHolds(t *testing.T) {
+	tests := []struct {
+		op   string
+		v    float64
+		want bool
+	}{
+		{op: ">", v: 2, want: true},
+		{op: ">", v: 1},
+		{op: ">=", v: 1, want: true},
+		{op: "<", v: 0, want: true},
+		{op: "<=", v: 2},
+		{op: "==", v: 1, want: true},
+		{op: "!=", v: 1},
+	}
+	for _, tt := range tests {
+		c := &Condition{Op: tt.op, Threshold: 1}
+		if got := c.Holds(tt.v); got != tt.want {
+			t.Errorf("%v %s 1 = %v, want %v", tt.v, tt.op, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package ratelimit protects the datasources from runaway clients, with
+// per-client token buckets for tool calls and a global cap on concurrent
+// upstream queries.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/auth"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// LocalClient is the client key of stdio mode, which has a single client.
+	LocalClient = "local"
+	// maxIdleClients bounds the number of idle token buckets kept in memory.
+	maxIdleClients = 10000
+)
+
+type clientKey struct{}
+
+// WithClientAddress returns a context identifying unauthenticated callers
+// by their address.
+func WithClientAddress(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientKey{}, addr)
+}
+
+// ClientKey identifies the caller of a tool for rate limiting: the
+// authenticated user, else the client address, else the local stdio client.
+func ClientKey(ctx context.Context) string {
+	if identity, ok := auth.IdentityFrom(ctx); ok {
+		return "user:" + identity.Username
+	}
+	if addr, ok := ctx.Value(clientKey{}).(string); ok && addr != "" {
+		return "addr:" + addr
+	}
+	return LocalClient
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter is a token bucket rate limiter per client.
+type Limiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter allows each client perSecond calls per second on average, and
+// bursts of up to burst calls.
+func NewLimiter(perSecond float64, burst int) *Limiter {
+	return &Limiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of client. When the bucket is empty it
+// returns false and how long to wait until a token is available.
+func (l *Limiter) Allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxIdleClients {
+			l.prune(now)
+		}
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[client] = b
+	}
+	b.lastSeen = now
+
+	reservation := b.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// prune forgets clients whose bucket has refilled since their last call,
+// which is equivalent to starting from a new bucket.
+func (l *Limiter) prune(now time.Time) {
+	refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.lastSeen) > refill {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// String describes the limit for error messages.
+func (l *Limiter) String() string {
+	return fmt.Sprintf("%g tool calls per second with bursts of %d", float64(l.limit), l.burst)
+}
+
+// QueueTimeoutError is returned for upstream queries which waited too long
+// for a free slot.
+type QueueTimeoutError struct {
+	MaxConcurrent int
+	Waited        time.Duration
+}
+
+func (e *QueueTimeoutError) Error() string {
+	return fmt.Sprintf("gave up after waiting %s for one of the %d concurrent query slots", e.Waited, e.MaxConcurrent)
+}
+
+// ConcurrencyLimiter caps the number of concurrent upstream requests. Requests
+// over the cap wait in a queue for up to the queue timeout.
+type ConcurrencyLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+func NewConcurrencyLimiter(maxConcurrent int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		slots:        make(chan struct{}, maxConcurrent),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire waits for a free slot and returns the function releasing it.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context) (func(), error) {
+	release := func() { <-c.slots }
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(c.queueTimeout)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, &QueueTimeoutError{MaxConcurrent: cap(c.slots), Waited: time.Since(start).Round(time.Millisecond)}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RoundTripper holds a slot during every request made through next.
+func (c *ConcurrencyLimiter) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		release, err := c.Acquire(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		// Prometheus keeps working until the whole response is read
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+		return resp, nil
+	})
+}
+
+// releasingBody releases the slot of a request once its body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
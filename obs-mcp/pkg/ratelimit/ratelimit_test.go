@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inecas/obs-mcp/pkg/auth"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	l := NewLimiter(2, 3)
+	now := time.Unix(1700000000, 0)
+
+	for i := range 3 {
+		if ok, _ := l.Allow("alice", now); !ok {
+			t.Fatalf("call %d of the burst was rejected", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("alice", now)
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("expected a call over the burst to be rejected for 500ms, got %v %s", ok, retryAfter)
+	}
+	// A rejected call does not consume a token
+	if ok, retryAfter := l.Allow("alice", now.Add(250*time.Millisecond)); ok || retryAfter != 250*time.Millisecond {
+		t.Errorf("expected the retry after to shrink to 250ms, got %v %s", ok, retryAfter)
+	}
+	if ok, _ := l.Allow("alice", now.Add(500*time.Millisecond)); !ok {
+		t.Error("expected a call to be allowed once a token is refilled")
+	}
+
+	// Clients have their own buckets
+	if ok, _ := l.Allow("bob", now); !ok {
+		t.Error("expected another client to be allowed")
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	l := NewLimiter(1, 2)
+	now := time.Unix(1700000000, 0)
+	l.Allow("idle", now)
+	l.Allow("active", now.Add(time.Second))
+
+	// The bucket of idle refilled after 2s
+	l.prune(now.Add(2500 * time.Millisecond))
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("expected the refilled bucket to be pruned")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("expected the bucket still refilling to be kept")
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	ctx := context.Background()
+	if key := ClientKey(ctx); key != LocalClient {
+		t.Errorf("expected the local client, got %s", key)
+	}
+
+	ctx = WithClientAddress(ctx, "10.0.0.1:43210")
+	if key := ClientKey(ctx); key != "addr:10.0.0.1:43210" {
+		t.Errorf("expected the client address, got %s", key)
+	}
+
+	ctx = auth.WithIdentity(ctx, &auth.Identity{Username: "alice"})
+	if key := ClientKey(ctx); key != "user:alice" {
+		t.Errorf("expected the authenticated user to take precedence, got %s", key)
+	}
+}
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	c := NewConcurrencyLimiter(1, 200*time.Millisecond)
+	release, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue times out while the slot is held
+	_, err = c.Acquire(context.Background())
+	var timeout *QueueTimeoutError
+	if !errors.As(err, &timeout) || timeout.MaxConcurrent != 1 || timeout.Waited < 200*time.Millisecond {
+		t.Errorf("expected a queue timeout, got %v", err)
+	}
+
+	// Canceling the caller stops waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	slow := NewConcurrencyLimiter(1, time.Hour)
+	if _, err := slow.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := slow.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the cancellation of the caller, got %v", err)
+	}
+
+	// A waiting request gets the slot once it is released
+	waiting := make(chan error)
+	go func() {
+		release, err := c.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		waiting <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	release()
+	if err := <-waiting; err != nil {
+		t.Errorf("expected the released slot to be acquired, got %v", err)
+	}
+}
+
+// closeCounter counts the calls of Close.
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestConcurrencyLimiterRoundTripper(t *testing.T) {
+	c := NewConcurrencyLimiter(1, 10*time.Millisecond)
+	body := &closeCounter{Reader: strings.NewReader("{}")}
+	next := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: body}, nil
+	})
+	rt := c.RoundTripper(next)
+
+	req, err := http.NewRequest(http.MethodGet, "http://prometheus/api/v1/query", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The slot is held until the body is closed
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Error("expected a second request to wait for the slot")
+	}
+	_ = resp.Body.Close()
+	_ = resp.Body.Close()
+	if body.closed != 2 {
+		t.Errorf("expected the body to be closed twice, got %d", body.closed)
+	}
+	if len(c.slots) != 0 {
+		t.Errorf("expected the slot to be released once, %d in use", len(c.slots))
+	}
+	resp, err = rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("expected the released slot to be reused, got %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Failed requests release their slot right away
+	failing := c.RoundTripper(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}))
+	if _, err := failing.RoundTrip(req); err == nil {
+		t.Fatal("expected the error of the request")
+	}
+	if len(c.slots) != 0 {
+		t.Errorf("expected the slot of the failed request to be released, %d in use", len(c.slots))
+	}
+}
@@ -0,0 +1,218 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Changes a change-point search looks for.
+const (
+	// ChangeMeanVariance detects shifts of the level or of the variance.
+	ChangeMeanVariance = "mean_variance"
+	// ChangeMean detects shifts of the level only, assuming the noise is the
+	// same throughout the series.
+	ChangeMean = "mean"
+)
+
+var Changes = []string{ChangeMeanVariance, ChangeMean}
+
+// ChangepointOptions configure Changepoints.
+type ChangepointOptions struct {
+	// Change is one of Changes.
+	Change string
+	// MinSegment is the least number of samples between change points.
+	MinSegment int
+	// Penalty multiplies the cost of adding a change point, which defaults
+	// to the Bayesian information criterion. Higher values find fewer
+	// change points.
+	Penalty float64
+}
+
+// Segment summarizes the samples between two change points, from index
+// Start up to but not including End.
+type Segment struct {
+	Start  int
+	End    int
+	Mean   float64
+	StdDev float64
+}
+
+// Changepoint is the index of the first sample after a change, with the
+// segments on both sides of it.
+type Changepoint struct {
+	Index  int
+	Before Segment
+	After  Segment
+	// Score is the decrease of the cost from splitting the two segments,
+	// which is twice the log-likelihood ratio of the split: the higher, the
+	// more significant the change.
+	Score float64
+}
+
+// Changepoints finds the change points of values with PELT (pruned exact
+// linear time), which minimizes the total cost of the segments under a
+// Gaussian model plus a penalty for each change point.
+func Changepoints(values []float64, opts ChangepointOptions) ([]Changepoint, error) {
+	if !slices.Contains(Changes, opts.Change) {
+		return nil, fmt.Errorf("unknown change %q, expected one of %s", opts.Change, strings.Join(Changes, ", "))
+	}
+	if opts.MinSegment < 2 {
+		return nil, fmt.Errorf("the minimum segment must be at least 2 samples")
+	}
+	if opts.Penalty <= 0 {
+		opts.Penalty = 1
+	}
+
+	n := len(values)
+	if n < 2*opts.MinSegment {
+		return nil, nil
+	}
+	c := newSegmentCost(values, opts.Change)
+	if c.constant {
+		return nil, nil
+	}
+
+	// Each change point adds the parameters of a segment and its location
+	params := 3.0
+	if opts.Change == ChangeMean {
+		params = 2
+	}
+	beta := opts.Penalty * params * math.Log(float64(n))
+
+	// best[t] is the least cost of values[:t], whose last segment starts at
+	// last[t]
+	best := make([]float64, n+1)
+	last := make([]int, n+1)
+	for t := 1; t <= n; t++ {
+		best[t] = math.Inf(1)
+	}
+	best[0] = -beta
+
+	candidates := []int{0}
+	for t := opts.MinSegment; t <= n; t++ {
+		for _, s := range candidates {
+			if t-s < opts.MinSegment {
+				continue
+			}
+			if cost := best[s] + c.cost(s, t) + beta; cost < best[t] {
+				best[t] = cost
+				last[t] = s
+			}
+		}
+
+		// Prune the starts which cannot be optimal for any later end
+		pruned := candidates[:0]
+		for _, s := range candidates {
+			if t-s < opts.MinSegment || best[s]+c.cost(s, t) <= best[t] {
+				pruned = append(pruned, s)
+			}
+		}
+		candidates = pruned
+		if t+opts.MinSegment <= n {
+			candidates = append(candidates, t)
+		}
+	}
+
+	var bounds []int
+	for t := n; t > 0; t = last[t] {
+		bounds = append(bounds, t)
+	}
+	bounds = append(bounds, 0)
+	slices.Reverse(bounds)
+
+	var changepoints []Changepoint
+	for i := 1; i < len(bounds)-1; i++ {
+		start, split, end := bounds[i-1], bounds[i], bounds[i+1]
+		changepoints = append(changepoints, Changepoint{
+			Index:  split,
+			Before: c.segment(start, split),
+			After:  c.segment(split, end),
+			Score:  c.cost(start, end) - c.cost(start, split) - c.cost(split, end),
+		})
+	}
+	return changepoints, nil
+}
+
+// MostSignificant returns the n changepoints with the highest score, in the
+// order of their index.
+func MostSignificant(changepoints []Changepoint, n int) []Changepoint {
+	if len(changepoints) <= n {
+		return changepoints
+	}
+	top := slices.Clone(changepoints)
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Score > top[j].Score })
+	top = top[:n]
+	sort.Slice(top, func(i, j int) bool { return top[i].Index < top[j].Index })
+	return top
+}
+
+// segmentCost computes the cost of segments from prefix sums.
+type segmentCost struct {
+	change string
+	sums   []float64
+	// squares are the prefix sums of the squared deviations from the mean,
+	// for numerical stability.
+	squares []float64
+	mean    float64
+	// noise is the variance of the noise assumed by the mean model.
+	noise float64
+	// floor is the least variance of a segment, so that constant segments
+	// have a finite cost.
+	floor    float64
+	constant bool
+}
+
+func newSegmentCost(values []float64, change string) *segmentCost {
+	n := len(values)
+	c := &segmentCost{change: change, sums: make([]float64, n+1), squares: make([]float64, n+1)}
+	for _, v := range values {
+		c.mean += v
+	}
+	c.mean /= float64(n)
+	for i, v := range values {
+		d := v - c.mean
+		c.sums[i+1] = c.sums[i] + d
+		c.squares[i+1] = c.squares[i] + d*d
+	}
+
+	variance := c.squares[n] / float64(n)
+	if variance == 0 {
+		c.constant = true
+		return c
+	}
+	c.floor = variance * 1e-6
+
+	// The noise is estimated from the differences of consecutive samples,
+	// which level shifts barely affect: the median absolute difference of
+	// normal noise is 0.6745 * sqrt(2) standard deviations
+	diffs := make([]float64, n-1)
+	for i := range diffs {
+		diffs[i] = math.Abs(values[i+1] - values[i])
+	}
+	slices.Sort(diffs)
+	sd := diffs[len(diffs)/2] / (0.6745 * math.Sqrt2)
+	c.noise = max(sd*sd, c.floor)
+	return c
+}
+
+// cost returns the cost of the segment values[s:t], twice its negative
+// log-likelihood up to a constant.
+func (c *segmentCost) cost(s, t int) float64 {
+	m := float64(t - s)
+	sum := c.sums[t] - c.sums[s]
+	deviations := c.squares[t] - c.squares[s] - sum*sum/m
+	if c.change == ChangeMean {
+		return deviations / c.noise
+	}
+	return m * math.Log(max(deviations/m, c.floor))
+}
+
+func (c *segmentCost) segment(s, t int) Segment {
+	m := float64(t - s)
+	sum := c.sums[t] - c.sums[s]
+	variance := max((c.squares[t]-c.squares[s]-sum*sum/m)/m, 0)
+	return Segment{Start: s, End: t, Mean: c.mean + sum/m, StdDev: math.Sqrt(variance)}
+}
@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPearson(t *testing.T) {
+	xs := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		name   string
+		ys     []float64
+		want   float64
+		wantOK bool
+	}{
+		{name: "proportional", ys: []float64{2, 4, 6, 8, 10}, want: 1, wantOK: true},
+		{name: "inverse", ys: []float64{5, 4, 3, 2, 1}, want: -1, wantOK: true},
+		{name: "uncorrelated", ys: []float64{1, -1, 0, -1, 1}, want: 0, wantOK: true},
+		{name: "constant", ys: []float64{3, 3, 3, 3, 3}},
+		{name: "length mismatch", ys: []float64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Pearson(xs, tt.ys)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Pearson() = %g, %v, want %g, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestChangepoints(t *testing.T) {
+	// A level shift at 100 and a variance shift at 200
+	rng := rand.New(rand.NewSource(1))
+	var values []float64
+	for i := 0; i < 300; i++ {
+		switch {
+		case i < 100:
+			values = append(values, 10+rng.NormFloat64())
+		case i < 200:
+			values = append(values, 15+rng.NormFloat64())
+		default:
+			values = append(values, 15+4*rng.NormFloat64())
+		}
+	}
+
+	changepoints, err := Changepoints(values, ChangepointOptions{Change: ChangeMeanVariance, MinSegment: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changepoints) != 2 {
+		t.Fatalf("expected 2 change points, got %+v", changepoints)
+	}
+	level, variance := changepoints[0], changepoints[1]
+	if level.Index < 98 || level.Index > 102 || math.Abs(level.After.Mean-level.Before.Mean-5) > 0.5 {
+		t.Errorf("expected the level to rise by 5 at 100, got %+v", level)
+	}
+	if variance.Index < 195 || variance.Index > 205 || variance.After.StdDev < 3*variance.Before.StdDev {
+		t.Errorf("expected the variance to grow at 200, got %+v", variance)
+	}
+
+	// Only the level shift is significant enough
+	if top := MostSignificant(changepoints, 1); len(top) != 1 || top[0].Index != level.Index {
+		t.Errorf("expected the level shift to be the most significant, got %+v", top)
+	}
+
+	// A higher penalty finds fewer change points
+	changepoints, err = Changepoints(values, ChangepointOptions{Change: ChangeMean, MinSegment: 5, Penalty: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changepoints) != 1 || changepoints[0].Index != level.Index {
+		t.Errorf("expected only the level shift, got %+v", changepoints)
+	}
+
+	if changepoints, _ := Changepoints(make([]float64, 50), ChangepointOptions{Change: ChangeMean, MinSegment: 5}); len(changepoints) != 0 {
+		t.Errorf("expected no change points in a constant series, got %+v", changepoints)
+	}
+}
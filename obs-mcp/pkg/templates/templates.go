@@ -0,0 +1,318 @@
+// Package templates is a library of named, parameterized PromQL queries that
+// encode how to answer common questions, so that they need not be written
+// from scratch every time.
+package templates
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.yaml.in/yaml/v2"
+)
+
+//go:embed default.yaml
+var defaultTemplates []byte
+
+// Parameter types. Values are validated and formatted for their place in the
+// query according to their type.
+const (
+	// TypeString is a label name, inserted as is.
+	TypeString = "string"
+	// TypeLabelValue is escaped for use inside a double quoted label value.
+	TypeLabelValue = "label_value"
+	// TypeRegex is a regular expression escaped for use inside a double
+	// quoted =~ matcher.
+	TypeRegex = "regex"
+	// TypeDuration is a PromQL duration such as 5m.
+	TypeDuration = "duration"
+	// TypeNumber is a floating point number.
+	TypeNumber = "number"
+	// TypeInteger is a whole number.
+	TypeInteger = "integer"
+)
+
+var (
+	parameterTypes = []string{TypeString, TypeLabelValue, TypeRegex, TypeDuration, TypeNumber, TypeInteger}
+	identifier     = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// sampleValues are used to check that templates render valid queries.
+var sampleValues = map[string]string{
+	TypeString:     "job",
+	TypeLabelValue: "value",
+	TypeRegex:      "value.*",
+	TypeDuration:   "5m",
+	TypeNumber:     "1",
+	TypeInteger:    "1",
+}
+
+// Parameter is an argument of a template.
+type Parameter struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type" json:"type"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Required    bool   `yaml:"required,omitempty" json:"required,omitempty"`
+	// Default is used when an optional parameter is not given.
+	Default string `yaml:"default,omitempty" json:"default,omitempty"`
+	// Enum, when not empty, lists the accepted values.
+	Enum []string `yaml:"enum,omitempty" json:"enum,omitempty"`
+}
+
+// Template is a named PromQL query with parameters, written with the
+// text/template syntax: {{ .namespace }}.
+type Template struct {
+	Name        string      `yaml:"name" json:"name"`
+	Description string      `yaml:"description" json:"description"`
+	Query       string      `yaml:"query" json:"query"`
+	Parameters  []Parameter `yaml:"parameters,omitempty" json:"parameters"`
+
+	tmpl *template.Template
+}
+
+type file struct {
+	Templates []*Template `yaml:"templates"`
+}
+
+// Library is a set of templates looked up by name.
+type Library struct {
+	byName map[string]*Template
+}
+
+// Load returns the default templates together with the templates of the file
+// at path, which replace default templates of the same name. An empty path
+// loads the defaults only.
+func Load(path string) (*Library, error) {
+	lib := &Library{byName: map[string]*Template{}}
+	if err := lib.add(defaultTemplates); err != nil {
+		return nil, fmt.Errorf("invalid default query templates: %w", err)
+	}
+	if path == "" {
+		return lib, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading query templates: %w", err)
+	}
+	if err := lib.add(content); err != nil {
+		return nil, fmt.Errorf("invalid query templates file %s: %w", path, err)
+	}
+	return lib, nil
+}
+
+func (l *Library) add(content []byte) error {
+	var f file
+	if err := yaml.UnmarshalStrict(content, &f); err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, t := range f.Templates {
+		if names[t.Name] {
+			return fmt.Errorf("duplicate template %q", t.Name)
+		}
+		names[t.Name] = true
+		if err := t.compile(); err != nil {
+			return fmt.Errorf("template %q: %w", t.Name, err)
+		}
+		l.byName[t.Name] = t
+	}
+	return nil
+}
+
+// compile parses the query template and checks that it renders a valid
+// expression from sample values of its parameters.
+func (t *Template) compile() error {
+	if !identifier.MatchString(t.Name) {
+		return fmt.Errorf("name must be an identifier")
+	}
+	if t.Query == "" {
+		return fmt.Errorf("query must not be empty")
+	}
+
+	samples := map[string]any{}
+	for i, p := range t.Parameters {
+		if !identifier.MatchString(p.Name) {
+			return fmt.Errorf("parameter %d: name must be an identifier", i)
+		}
+		if slices.ContainsFunc(t.Parameters[:i], func(other Parameter) bool { return other.Name == p.Name }) {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		if p.Type == "" {
+			t.Parameters[i].Type = TypeString
+			p.Type = TypeString
+		}
+		if !slices.Contains(parameterTypes, p.Type) {
+			return fmt.Errorf("parameter %s: unknown type %q, expected one of %s", p.Name, p.Type, strings.Join(parameterTypes, ", "))
+		}
+		if p.Required && p.Default != "" {
+			return fmt.Errorf("parameter %s: required parameters cannot have a default", p.Name)
+		}
+		if p.Default != "" {
+			if _, err := p.format(p.Default); err != nil {
+				return fmt.Errorf("parameter %s: invalid default: %w", p.Name, err)
+			}
+		}
+
+		switch {
+		case len(p.Enum) > 0:
+			samples[p.Name] = p.Enum[0]
+		case p.Default != "":
+			samples[p.Name] = p.Default
+		default:
+			samples[p.Name] = sampleValues[p.Type]
+		}
+	}
+
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Query)
+	if err != nil {
+		return err
+	}
+	t.tmpl = tmpl
+
+	if _, err := t.Render(samples); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Render returns the query for args, the parameter values by name, which
+// may be strings or numbers.
+func (t *Template) Render(args map[string]any) (string, error) {
+	for name := range args {
+		if !slices.ContainsFunc(t.Parameters, func(p Parameter) bool { return p.Name == name }) {
+			return "", fmt.Errorf("unknown parameter %q of template %s", name, t.Name)
+		}
+	}
+
+	values := map[string]string{}
+	for _, p := range t.Parameters {
+		raw, ok := args[p.Name]
+		if !ok || raw == nil {
+			if p.Required {
+				return "", fmt.Errorf("parameter %q of template %s is required", p.Name, t.Name)
+			}
+			raw = p.Default
+		}
+
+		value, err := stringValue(raw)
+		if err != nil {
+			return "", fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+		if value == "" && !p.Required {
+			values[p.Name] = ""
+			continue
+		}
+		if values[p.Name], err = p.format(value); err != nil {
+			return "", fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+	}
+
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, values); err != nil {
+		return "", err
+	}
+
+	expr, err := parser.ParseExpr(b.String())
+	if err != nil {
+		return "", fmt.Errorf("template %s rendered an invalid query %q: %w", t.Name, b.String(), err)
+	}
+	return expr.String(), nil
+}
+
+// stringValue converts an argument to a string.
+func stringValue(raw any) (string, error) {
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v, expected a string or a number", raw)
+}
+
+// format validates value and formats it for the query.
+func (p Parameter) format(value string) (string, error) {
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, value) {
+		return "", fmt.Errorf("value %q is not one of %s", value, strings.Join(p.Enum, ", "))
+	}
+
+	switch p.Type {
+	case TypeLabelValue:
+		return escape(value), nil
+	case TypeRegex:
+		if _, err := regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return "", fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return escape(value), nil
+	case TypeDuration:
+		d, err := model.ParseDuration(value)
+		if err != nil {
+			return "", err
+		}
+		return d.String(), nil
+	case TypeNumber:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid number %q", value)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	case TypeInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid integer %q", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	}
+	if !identifier.MatchString(value) {
+		return "", fmt.Errorf("invalid label name %q", value)
+	}
+	return value, nil
+}
+
+// escape escapes s for use inside a double quoted PromQL string.
+func escape(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
+
+// Get returns the template called name.
+func (l *Library) Get(name string) (*Template, error) {
+	t, ok := l.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown query template %q, available templates: %s", name, strings.Join(l.Names(), ", "))
+	}
+	return t, nil
+}
+
+// Names returns the sorted names of all templates.
+func (l *Library) Names() []string {
+	names := make([]string, 0, len(l.byName))
+	for name := range l.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns all templates sorted by name.
+func (l *Library) List() []*Template {
+	list := make([]*Template, 0, len(l.byName))
+	for _, name := range l.Names() {
+		list = append(list, l.byName[name])
+	}
+	return list
+}
@@ -0,0 +1,207 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			name: "valid",
+			content: `
+templates:
+  - name: by_label
+    query: 'sum by ({{ .label }}) (up{job=~"{{ .jobs }}"})'
+    parameters:
+      - name: label
+        default: instance
+      - name: jobs
+        type: regex
+        enum: ["api.*", "db"]
+`,
+		},
+		{
+			name: "duplicate name",
+			content: `
+templates:
+  - name: up
+    query: up
+  - name: up
+    query: up == 0
+`,
+			err: `duplicate template "up"`,
+		},
+		{
+			name: "duplicate parameter",
+			content: `
+templates:
+  - name: up
+    query: 'up{job="{{ .job }}"}'
+    parameters:
+      - name: job
+        type: label_value
+      - name: job
+        type: label_value
+`,
+			err: `duplicate parameter "job"`,
+		},
+		{
+			name: "bad default",
+			content: `
+templates:
+  - name: rate
+    query: 'rate(up[{{ .window }}])'
+    parameters:
+      - name: window
+        type: duration
+        default: five minutes
+`,
+			err: "parameter window: invalid default",
+		},
+		{
+			name: "default outside the enum",
+			content: `
+templates:
+  - name: up
+    query: 'up{job="{{ .job }}"}'
+    parameters:
+      - name: job
+        type: label_value
+        enum: [api, db]
+        default: web
+`,
+			err: `value "web" is not one of api, db`,
+		},
+		{
+			name: "enum rendering an invalid query",
+			content: `
+templates:
+  - name: up
+    query: 'sum by ({{ .label }}) (up)'
+    parameters:
+      - name: label
+        type: label_value
+        enum: ["a b"]
+`,
+			err: "rendered an invalid query",
+		},
+		{
+			name: "bad regex default",
+			content: `
+templates:
+  - name: up
+    query: 'up{job=~"{{ .jobs }}"}'
+    parameters:
+      - name: jobs
+        type: regex
+        default: "api("
+`,
+			err: "invalid regular expression",
+		},
+		{
+			name: "label name default",
+			content: `
+templates:
+  - name: up
+    query: 'sum by ({{ .label }}) (up)'
+    parameters:
+      - name: label
+        default: "job) or vector(1"
+`,
+			err: "invalid label name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Library{byName: map[string]*Template{}}).add([]byte(tt.content))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("expected an error containing %q", tt.err)
+			case err != nil && !strings.Contains(err.Error(), tt.err):
+				t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	lib := &Library{byName: map[string]*Template{}}
+	err := lib.add([]byte(`
+templates:
+  - name: by_label
+    query: 'sum by ({{ .label }}) (rate(up{job="{{ .job }}", instance=~"{{ .instances }}"}[{{ .window }}])) > {{ .threshold }}'
+    parameters:
+      - name: label
+        default: instance
+      - name: job
+        type: label_value
+        required: true
+      - name: instances
+        type: regex
+        default: ".*"
+      - name: window
+        type: duration
+        default: 5m
+      - name: threshold
+        type: number
+        default: "0"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := lib.Get("by_label")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args map[string]any
+		want string
+		err  string
+	}{
+		{
+			args: map[string]any{"job": `a"b`},
+			want: `sum by (instance) (rate(up{instance=~".*",job="a\"b"}[5m])) > 0`,
+		},
+		{
+			args: map[string]any{"job": "api", "label": "pod", "window": "1h", "threshold": 0.5},
+			want: `sum by (pod) (rate(up{instance=~".*",job="api"}[1h])) > 0.5`,
+		},
+		{args: map[string]any{}, err: `parameter "job" of template by_label is required`},
+		{args: map[string]any{"job": "api", "label": "pod-name"}, err: `invalid label name "pod-name"`},
+		{args: map[string]any{"job": "api", "label": "job)"}, err: "invalid label name"},
+		{args: map[string]any{"job": "api", "window": "5 minutes"}, err: `parameter "window"`},
+		{args: map[string]any{"job": "api", "threshold": "high"}, err: `invalid number "high"`},
+		{args: map[string]any{"job": "api", "namespace": "default"}, err: `unknown parameter "namespace"`},
+	}
+	for _, tt := range tests {
+		got, err := tmpl.Render(tt.args)
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Render(%v): expected an error containing %q, got %q, %v", tt.args, tt.err, got, err)
+			}
+		case err != nil:
+			t.Errorf("Render(%v): unexpected error: %v", tt.args, err)
+		case got != tt.want:
+			t.Errorf("Render(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	lib, err := Load("")
+	if err != nil {
+		t.Fatalf("loading the default templates: %v", err)
+	}
+	if len(lib.Names()) == 0 {
+		t.Fatal("expected default templates")
+	}
+}
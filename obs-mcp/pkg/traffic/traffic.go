@@ -0,0 +1,330 @@
+// Package traffic records the requests made to the datasources and replays
+// them, so that a conversation captured against a live cluster can be played
+// back without it.
+//
+// Every exchange is stored as a JSON file in a directory per datasource,
+// numbered in the order the requests were made. Request headers are not
+// stored, so recordings hold no credentials.
+package traffic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// timeParams are the query parameters that depend on when a request was
+// made. Replay falls back to matching without them.
+var timeParams = []string{"start", "end", "time"}
+
+// Exchange is a recorded request and its response.
+type Exchange struct {
+	// Endpoint is the request path relative to the API root, e.g.
+	// /api/v1/query_range, so that recordings do not depend on the URL.
+	Endpoint string `json:"endpoint"`
+	// Params are the query and form parameters of the request.
+	Params url.Values `json:"params,omitempty"`
+
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+	// Error is the transport error of requests that got no response.
+	Error string `json:"error,omitempty"`
+}
+
+// endpoint strips the API root from path.
+func endpoint(path string) string {
+	if i := strings.Index(path, "/api/"); i >= 0 {
+		return path[i:]
+	}
+	return path
+}
+
+// requestParams returns the query parameters of req merged with its form
+// body, restoring the body for the next round tripper.
+func requestParams(req *http.Request) (url.Values, error) {
+	params := req.URL.Query()
+	if req.Body == nil || req.Body == http.NoBody {
+		return params, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range form {
+			params[name] = append(params[name], values...)
+		}
+	}
+	return params, nil
+}
+
+// key identifies requests by endpoint and normalized parameters: sorted, and
+// without empty values and the ignored parameters.
+func key(endpoint string, params url.Values, ignored ...string) string {
+	normalized := url.Values{}
+	for name, values := range params {
+		if slices.Contains(ignored, name) {
+			continue
+		}
+		for _, value := range values {
+			if value != "" {
+				normalized.Add(name, value)
+			}
+		}
+		slices.Sort(normalized[name])
+	}
+	// Encode sorts by name
+	return endpoint + "?" + normalized.Encode()
+}
+
+// Recorder stores the exchanges of the datasources in a directory.
+type Recorder struct {
+	dir string
+
+	mu   sync.Mutex
+	next map[string]int
+}
+
+// NewRecorder records into dir, creating it if needed. Exchanges already in
+// dir are kept and new ones are numbered after them.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating recording directory: %w", err)
+	}
+	return &Recorder{dir: dir, next: map[string]int{}}, nil
+}
+
+// RoundTripper records the requests to datasource made through next.
+func (r *Recorder) RoundTripper(datasource string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		params, err := requestParams(req)
+		if err != nil {
+			return nil, fmt.Errorf("error reading request to record: %w", err)
+		}
+		exchange := &Exchange{Endpoint: endpoint(req.URL.Path), Params: params}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			exchange.Error = err.Error()
+			if saveErr := r.save(datasource, exchange); saveErr != nil {
+				return nil, errors.Join(err, saveErr)
+			}
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading response to record: %w", err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		exchange.Status = resp.StatusCode
+		exchange.ContentType = resp.Header.Get("Content-Type")
+		exchange.Body = string(body)
+		if err := r.save(datasource, exchange); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+}
+
+func (r *Recorder) save(datasource string, exchange *Exchange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := filepath.Join(r.dir, datasource)
+	if _, ok := r.next[datasource]; !ok {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("error creating recording directory: %w", err)
+		}
+		files, err := exchangeFiles(dir)
+		if err != nil {
+			return err
+		}
+		r.next[datasource] = 1
+		if len(files) > 0 {
+			last, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(files[len(files)-1]), ".json"))
+			r.next[datasource] = last + 1
+		}
+	}
+
+	content, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%06d.json", r.next[datasource]))
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("error recording exchange: %w", err)
+	}
+	r.next[datasource]++
+	return nil
+}
+
+// exchangeFiles returns the numbered exchange files in dir, in order.
+func exchangeFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading recording directory: %w", err)
+	}
+
+	type numbered struct {
+		n    int
+		path string
+	}
+	var files []numbered
+	for _, entry := range entries {
+		n, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || err != nil {
+			continue
+		}
+		files = append(files, numbered{n: n, path: filepath.Join(dir, entry.Name())})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].n < files[j].n })
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.path
+	}
+	return paths, nil
+}
+
+// Player serves recorded exchanges instead of making requests.
+type Player struct {
+	dir string
+}
+
+// NewPlayer replays the recording in dir.
+func NewPlayer(dir string) (*Player, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening recording: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("recording %s is not a directory", dir)
+	}
+	return &Player{dir: dir}, nil
+}
+
+// RoundTripper answers the requests to datasource with its recorded
+// exchanges. A request is matched on its endpoint and normalized parameters,
+// or failing that on the same without the time parameters, since relative
+// times like now-1h differ between the recording and the replay. Requests
+// matching several exchanges get them in the recorded order, the last one
+// being repeated.
+func (p *Player) RoundTripper(datasource string) (http.RoundTripper, error) {
+	files, err := exchangeFiles(filepath.Join(p.dir, datasource))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &replay{exact: map[string]*queue{}, timeless: map[string]*queue{}}
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading recorded exchange: %w", err)
+		}
+		exchange := &Exchange{}
+		if err := json.Unmarshal(content, exchange); err != nil {
+			return nil, fmt.Errorf("invalid recorded exchange %s: %w", path, err)
+		}
+		r.add(r.exact, key(exchange.Endpoint, exchange.Params), exchange)
+		r.add(r.timeless, key(exchange.Endpoint, exchange.Params, timeParams...), exchange)
+	}
+	return r, nil
+}
+
+type queue struct {
+	exchanges []*Exchange
+	served    int
+}
+
+type replay struct {
+	mu       sync.Mutex
+	exact    map[string]*queue
+	timeless map[string]*queue
+}
+
+func (r *replay) add(queues map[string]*queue, key string, exchange *Exchange) {
+	q, ok := queues[key]
+	if !ok {
+		q = &queue{}
+		queues[key] = q
+	}
+	q.exchanges = append(q.exchanges, exchange)
+}
+
+func (r *replay) RoundTrip(req *http.Request) (*http.Response, error) {
+	params, err := requestParams(req)
+	if err != nil {
+		return nil, err
+	}
+	ep := endpoint(req.URL.Path)
+
+	r.mu.Lock()
+	q, ok := r.exact[key(ep, params)]
+	if !ok {
+		q, ok = r.timeless[key(ep, params, timeParams...)]
+	}
+	var exchange *Exchange
+	if ok {
+		exchange = q.exchanges[min(q.served, len(q.exchanges)-1)]
+		q.served++
+	}
+	r.mu.Unlock()
+
+	if exchange == nil {
+		return nil, fmt.Errorf("no recorded response for %s", key(ep, params))
+	}
+	if exchange.Error != "" {
+		return nil, errors.New(exchange.Error)
+	}
+
+	header := http.Header{}
+	if exchange.ContentType != "" {
+		header.Set("Content-Type", exchange.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(exchange.Body)),
+		ContentLength: int64(len(exchange.Body)),
+		Request:       req,
+	}, nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
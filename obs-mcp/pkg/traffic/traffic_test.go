@@ -0,0 +1,103 @@
+package traffic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// newAPI returns a v1 API client for url using roundTripper.
+func newAPI(t *testing.T, url string, roundTripper http.RoundTripper) v1.API {
+	t.Helper()
+	client, err := api.NewClient(api.Config{Address: url, RoundTripper: roundTripper})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v1.NewAPI(client)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	requests := 0
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Form.Get("query") {
+		case "up":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"api"},"value":[1700000000,"1"]}]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		}
+	}))
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := newAPI(t, prometheus.URL+"/prefix", recorder.RoundTripper("main", nil))
+
+	ctx := context.Background()
+	recordedAt := time.Unix(1700000000, 0)
+	want, _, err := recorded.Query(ctx, "up", recordedAt)
+	if err != nil {
+		t.Fatalf("recording query: %v", err)
+	}
+	if _, _, err := recorded.Query(ctx, "sum(", recordedAt); err == nil {
+		t.Fatal("expected the invalid query to fail")
+	}
+	prometheus.Close()
+
+	player, err := NewPlayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTripper, err := player.RoundTripper("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The replay uses another URL, as a bug report would
+	replayed := newAPI(t, "http://replay.invalid", roundTripper)
+
+	tests := []struct {
+		name      string
+		query     string
+		at        time.Time
+		wantError string
+	}{
+		{name: "same time", query: "up", at: recordedAt},
+		{name: "other time", query: "up", at: recordedAt.Add(time.Hour)},
+		{name: "recorded error", query: "sum(", at: recordedAt, wantError: "parse error"},
+		{name: "not recorded", query: "down", at: recordedAt, wantError: "no recorded response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := replayed.Query(ctx, tt.query, tt.at)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("expected error %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("replaying query: %v", err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("replayed %s, recorded %s", got, want)
+			}
+		})
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests to Prometheus, got %d", requests)
+	}
+}